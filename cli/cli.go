@@ -0,0 +1,277 @@
+// Package cli is the kubernetes-deploy command line, for people and CI pipelines.
+//
+//	kubernetes-deploy ls
+//	kubernetes-deploy deploy <tag> [--wait | --watch]
+//	kubernetes-deploy status [--watch]
+//	kubernetes-deploy wait [--watch] [--timeout 10m]
+//	kubernetes-deploy history
+//	kubernetes-deploy rollback [revision]
+//	kubernetes-deploy logs [--tail 100]
+//	kubernetes-deploy events [--warnings] [--since 1h]
+//	kubernetes-deploy restart
+//	kubernetes-deploy scale <replicas>
+//
+// The cluster comes from an entry of an environments file named by --context, or else
+// from the KUBERNETES_* environment variables. --namespace, --deployment and --container
+// override either. Every command prints a table by default, or `-o wide`, `-o json` or `-o yaml`.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Exit codes, so CI pipelines can tell failures apart
+const (
+	ExitOK            = 0
+	ExitError         = 1
+	ExitUsage         = 2
+	ExitPolicyDenied  = 3
+	ExitDeployAborted = 4
+	ExitRolloutFailed = 5
+)
+
+// Output formats
+const (
+	OutputTable = "table"
+	OutputWide  = "wide"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// CLI runs commands against a single deployment.
+type CLI struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Client *http.Client
+	// Now defaults to time.Now, and is used to work out ages.
+	Now func() time.Time
+}
+
+// options holds every flag. Each command only registers the ones it uses.
+type options struct {
+	environments string
+	context      string
+	namespace    string
+	deployment   string
+	container    string
+	output       string
+
+	user     string
+	wait     bool
+	watch    bool
+	timeout  time.Duration
+	interval time.Duration
+	tail     int
+	since    time.Duration
+	warnings bool
+}
+
+// invocation is a parsed command line, with the cluster it runs against
+type invocation struct {
+	options     *options
+	args        []string
+	environment deploy.EnvironmentConfig
+	cluster     *deploy.KubernetesClusterNamespace
+}
+
+// usageError is returned for a command line that cannot be run as given
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+// exitError carries a specific exit code for an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Run runs the command in args, which excludes the program name, and returns the exit code
+func (c *CLI) Run(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return ExitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		return ExitOK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(c.Stderr, "error: unknown command %q\n\n", args[0])
+		c.usage()
+		return ExitUsage
+	}
+
+	opts := &options{}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.Stderr, "Usage: kubernetes-deploy %s [flags]\n\n%s\n\nFlags:\n", cmd.usage, cmd.summary)
+		flags.PrintDefaults()
+	}
+	registerGlobalFlags(flags, opts)
+	if cmd.flags != nil {
+		cmd.flags(flags, opts)
+	}
+
+	positional, err := parseInterspersed(flags, args[1:])
+	if err == flag.ErrHelp {
+		return ExitOK
+	}
+	if err != nil {
+		return ExitUsage
+	}
+
+	err = c.run(cmd, opts, positional)
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "error: %s\n", err.Error())
+	}
+	return exitCode(err)
+}
+
+func (c *CLI) run(cmd *command, opts *options, args []string) error {
+	if len(args) < cmd.minArgs || len(args) > cmd.maxArgs {
+		return &usageError{fmt.Sprintf("usage: kubernetes-deploy %s", cmd.usage)}
+	}
+	switch opts.output {
+	case OutputTable, OutputWide, OutputJSON, OutputYAML:
+	default:
+		return &usageError{fmt.Sprintf("unknown output format %q, expected table, wide, json or yaml", opts.output)}
+	}
+
+	environment, err := loadEnvironment(opts)
+	if err != nil {
+		return err
+	}
+
+	return cmd.run(c, &invocation{
+		options:     opts,
+		args:        args,
+		environment: environment,
+		cluster:     environment.Cluster(c.Client),
+	})
+}
+
+// registerGlobalFlags adds the flags every command accepts
+func registerGlobalFlags(flags *flag.FlagSet, opts *options) {
+	environments := os.Getenv("KUBERNETES_DEPLOY_ENVIRONMENTS")
+	if environments == "" {
+		environments = "environments.json"
+	}
+	flags.StringVar(&opts.environments, "environments", environments, "environments file used with --context (env KUBERNETES_DEPLOY_ENVIRONMENTS)")
+	flags.StringVar(&opts.context, "context", os.Getenv("KUBERNETES_DEPLOY_CONTEXT"), "environment to use from the environments file (env KUBERNETES_DEPLOY_CONTEXT)")
+	flags.StringVar(&opts.namespace, "namespace", "", "Kubernetes namespace, overriding the environment")
+	flags.StringVar(&opts.namespace, "n", "", "shorthand for --namespace")
+	flags.StringVar(&opts.deployment, "deployment", "", "deployment name, overriding the environment")
+	flags.StringVar(&opts.container, "container", "", "container name, overriding the environment")
+	flags.StringVar(&opts.output, "output", OutputTable, "output format: table, wide, json or yaml")
+	flags.StringVar(&opts.output, "o", OutputTable, "shorthand for --output")
+}
+
+// parseInterspersed parses flags wherever they appear, e.g. `deploy abc123 -o json`, returning the other arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// loadEnvironment picks the cluster from the environments file or the KUBERNETES_* variables, then applies overrides
+func loadEnvironment(opts *options) (deploy.EnvironmentConfig, error) {
+	environment := deploy.EnvironmentConfig{
+		Description:    os.Getenv("DESCRIPTION"),
+		Endpoint:       os.Getenv("KUBERNETES_ENDPOINT"),
+		Namespace:      os.Getenv("KUBERNETES_NAMESPACE"),
+		DeploymentName: os.Getenv("KUBERNETES_DEPLOYMENT_NAME"),
+		ContainerName:  os.Getenv("KUBERNETES_DEPLOYMENT_CONTAINERNAME"),
+		ImagePrefix:    os.Getenv("KUBERNETES_DEPLOYMENT_IMAGE_PREFIX"),
+		TokenVariable:  "KUBERNETES_ENDPOINT_BEARER_TOKEN",
+	}
+
+	if opts.context != "" {
+		config, err := deploy.ReadEnvironments(opts.environments)
+		if err != nil {
+			return environment, err
+		}
+		var ok bool
+		environment, ok = config.Environments[opts.context]
+		if !ok {
+			return environment, &usageError{fmt.Sprintf("context %q not found in %s", opts.context, opts.environments)}
+		}
+	}
+
+	if opts.namespace != "" {
+		environment.Namespace = opts.namespace
+	}
+	if opts.deployment != "" {
+		environment.DeploymentName = opts.deployment
+	}
+	if opts.container != "" {
+		environment.ContainerName = opts.container
+	}
+
+	if environment.Endpoint == "" || environment.Namespace == "" {
+		return environment, &usageError{"no cluster configured: use --context, or set KUBERNETES_ENDPOINT and KUBERNETES_NAMESPACE"}
+	}
+	return environment, nil
+}
+
+// exitCode picks the exit code for the error a command returned
+func exitCode(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return ExitOK
+	case *usageError:
+		return ExitUsage
+	case *exitError:
+		return err.code
+	case *deploy.PolicyDeniedError:
+		return ExitPolicyDenied
+	case *deploy.DeployAbortedError:
+		return ExitDeployAborted
+	}
+	return ExitError
+}
+
+func (c *CLI) usage() {
+	lines := []string{"Usage: kubernetes-deploy <command> [flags]", "", "Commands:"}
+	for _, cmd := range commands {
+		lines = append(lines, fmt.Sprintf("  %-24s %s", cmd.usage, cmd.summary))
+	}
+	lines = append(lines, "", "Run `kubernetes-deploy <command> -h` for the flags of a command.")
+	fmt.Fprintln(c.Stderr, strings.Join(lines, "\n"))
+}
+
+// now is the CLI's time, falling back to time.Now
+func (c *CLI) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
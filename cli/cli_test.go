@@ -0,0 +1,472 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsage(t *testing.T) {
+	c, stdout, stderr := mockCLI(nil)
+
+	assert.Equal(t, ExitUsage, c.Run([]string{}))
+	assert.Contains(t, stderr.String(), "deploy <tag>")
+	assert.Equal(t, ExitOK, c.Run([]string{"help"}))
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestUnknownCommand(t *testing.T) {
+	c, _, stderr := mockCLI(nil)
+
+	assert.Equal(t, ExitUsage, c.Run([]string{"deploi", "abc123"}))
+	assert.Contains(t, stderr.String(), `error: unknown command "deploi"`)
+}
+
+func TestWrongArguments(t *testing.T) {
+	c, stdout, stderr, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitUsage, c.Run(append([]string{"deploy"}, context...)))
+	assert.Contains(t, stderr.String(), "error: usage: kubernetes-deploy deploy <tag>")
+	assert.Equal(t, ExitUsage, c.Run(append([]string{"ls", "-o", "xml"}, context...)))
+	assert.Contains(t, stderr.String(), `error: unknown output format "xml"`)
+	assert.Equal(t, ExitUsage, c.Run(append([]string{"scale", "many"}, context...)))
+	assert.Equal(t, ExitUsage, c.Run(append([]string{"rollback", "latest"}, context...)))
+	assert.Equal(t, ExitUsage, c.Run([]string{"ls", "--bogus"}))
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestUnknownContext(t *testing.T) {
+	c, _, stderr, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+	context[len(context)-1] = "production"
+
+	assert.Equal(t, ExitUsage, c.Run(append([]string{"ls"}, context...)))
+	assert.Contains(t, stderr.String(), `error: context "production" not found in`)
+}
+
+func TestLs(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"ls"}, context...)))
+	assert.Equal(t, "NAME                       STATUS             READY   RESTARTS   TAG      AGE\n"+
+		"myapp-deployment-1-abcde   Running            true    0          ccc333   2h\n"+
+		"myapp-deployment-1-fghij   ImagePullBackOff   false   3          ccc333   5m\n", stdout.String())
+}
+
+func TestLsWide(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"ls", "-o", "wide"}, context...)))
+	assert.Contains(t, stdout.String(), "DIGEST")
+	assert.Contains(t, stdout.String(), "sha256:056d   2017-03-30T14:00:00Z")
+}
+
+func TestLsJSON(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"ls", "-o", "json"}, context...)))
+	overview := &deploy.DeploymentOverview{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), overview))
+	assert.Equal(t, deploy.OverviewAPIVersion, overview.APIVersion)
+	assert.Equal(t, "myapp-deployment", overview.Deployment)
+	assert.Equal(t, 2, overview.Summary.Total)
+	assert.Equal(t, 2, len(overview.Pods))
+	assert.Equal(t, "myapp-deployment-1-fghij", overview.Pods[1].Name)
+	assert.Equal(t, "ImagePullBackOff", overview.Pods[1].Reason)
+	assert.Equal(t, 3, overview.Pods[1].Restarts)
+	assert.Equal(t, 2, overview.Rollout.DesiredReplicas)
+}
+
+func TestLsYAML(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{ready: 1})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"ls", "-o", "yaml"}, context...)))
+	assert.Equal(t, `apiVersion: kubernetes-deploy/v1
+kind: DeploymentOverview
+deployment: myapp-deployment
+rollout:
+  deployment: myapp-deployment
+  image: artifactory.myorg.com:5010/myapp-docker-image:ccc333
+  desiredReplicas: 2
+  updatedReplicas: 1
+  readyReplicas: 1
+  availableReplicas: 1
+  complete: false
+  failed: false
+summary:
+  total: 2
+  ready: 1
+  restarts: 3
+  tags:
+    - tag: ccc333
+      count: 2
+  waiting:
+    - reason: ImagePullBackOff
+      count: 1
+pods:
+  - name: myapp-deployment-1-abcde
+    status: Running
+    tag: ccc333
+    digest: sha256:056d
+    ready: true
+    restarts: 0
+    created: "2017-03-30T14:00:00Z"
+  - name: myapp-deployment-1-fghij
+    status: Running
+    reason: ImagePullBackOff
+    tag: ccc333
+    ready: false
+    restarts: 3
+    created: "2017-03-30T15:55:00Z"
+`, stdout.String())
+}
+
+func TestDeploy(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, stdout, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"deploy", "ddd444", "-o", "json"}, context...)))
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", cluster.patched)
+
+	result := Result{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &result))
+	assert.Equal(t, "deploy", result.Action)
+	assert.Equal(t, "myapp-deployment", result.Deployment)
+	assert.Equal(t, "ddd444", result.Tag)
+	assert.Equal(t, deploy.AuditResultSuccess, result.Result)
+	assert.Equal(t, 2, len(result.Pods))
+	assert.Nil(t, result.Rollout)
+}
+
+func TestDeployAndWait(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{progress: true})
+	defer cleanUp()
+
+	args := append([]string{"deploy", "ddd444", "--wait", "--interval", "1ms"}, context...)
+	assert.Equal(t, ExitOK, c.Run(args))
+	assert.Contains(t, stdout.String(), "rollout of myapp-deployment complete: 2 of 2 replicas updated and available")
+}
+
+func TestDeployRolloutTimeout(t *testing.T) {
+	c, stdout, stderr, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	args := append([]string{"deploy", "ddd444", "-o", "json", "--wait", "--timeout", "5ms", "--interval", "1ms"}, context...)
+	assert.Equal(t, ExitRolloutFailed, c.Run(args))
+	assert.Contains(t, stderr.String(), "error: timed out waiting for rollout of myapp-deployment")
+
+	result := Result{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &result))
+	assert.Equal(t, deploy.AuditResultFailure, result.Result)
+	assert.Equal(t, 0, result.Rollout.AvailableReplicas)
+}
+
+func TestDeployFailure(t *testing.T) {
+	c, stdout, stderr, context, cleanUp := mockStaging(&MockKubernetes{broken: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitError, c.Run(append([]string{"deploy", "ddd444"}, context...)))
+	assert.Contains(t, stderr.String(), "/deployments/myapp-deployment in namespace myapp-staging: received 500\n")
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestStatus(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{ready: 2})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"status", "-o", "wide"}, context...)))
+	assert.Equal(t, "DEPLOYMENT         DESIRED   UPDATED   READY   AVAILABLE   ROLLOUT    IMAGE\n"+
+		"myapp-deployment   2         2         2       2           complete   artifactory.myorg.com:5010/myapp-docker-image:ccc333\n", stdout.String())
+}
+
+func TestStatusFailed(t *testing.T) {
+	c, stdout, stderr, context, cleanUp := mockStaging(&MockKubernetes{failed: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitRolloutFailed, c.Run(append([]string{"status", "-o", "json"}, context...)))
+	assert.Contains(t, stderr.String(), "error: rollout of myapp-deployment exceeded its progress deadline")
+
+	status := deploy.RolloutStatus{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &status))
+	assert.True(t, status.Failed)
+}
+
+func TestWait(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{progress: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"wait", "--interval", "1ms", "-o", "json"}, context...)))
+	status := deploy.RolloutStatus{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &status))
+	assert.True(t, status.Complete)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	c, _, stderr, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitRolloutFailed, c.Run(append([]string{"wait", "--timeout", "5ms", "--interval", "1ms"}, context...)))
+	assert.Contains(t, stderr.String(), "error: timed out waiting for rollout of myapp-deployment")
+}
+
+func TestDeployAndWatch(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{progress: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"deploy", "ddd444", "--watch"}, context...)))
+	lines := strings.Split(stdout.String(), "\n")
+	assert.Equal(t, "[0s] myapp-deployment progressing: 2 desired, 1 updated, 1 ready, 1 available; pods ccc333 x2; waiting ImagePullBackOff x1", lines[0])
+	assert.Equal(t, "[0s] myapp-deployment complete: 2 desired, 2 updated, 2 ready, 2 available; pods ccc333 x2; waiting ImagePullBackOff x1", lines[1])
+	assert.Contains(t, stdout.String(), "rollout of myapp-deployment complete")
+}
+
+func TestStatusWatch(t *testing.T) {
+	c, stdout, stderr, context, cleanUp := mockStaging(&MockKubernetes{progress: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"status", "--watch", "-o", "json"}, context...)))
+	assert.Equal(t, 2, strings.Count(stderr.String(), "[0s] myapp-deployment"))
+
+	status := deploy.RolloutStatus{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &status))
+	assert.True(t, status.Complete)
+}
+
+func TestStatusWatchTimeout(t *testing.T) {
+	c, _, stderr, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitRolloutFailed, c.Run(append([]string{"status", "--watch", "--timeout", "20ms", "--interval", "1ms"}, context...)))
+	assert.Contains(t, stderr.String(), "error: timed out waiting for rollout of myapp-deployment")
+}
+
+func TestStatusWatchFailed(t *testing.T) {
+	c, _, stderr, context, cleanUp := mockStaging(&MockKubernetes{failed: true})
+	defer cleanUp()
+
+	assert.Equal(t, ExitRolloutFailed, c.Run(append([]string{"status", "--watch"}, context...)))
+	assert.Contains(t, stderr.String(), "error: rollout of myapp-deployment exceeded its progress deadline")
+}
+
+func TestHistory(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"history"}, context...)))
+	assert.Equal(t, "REVISION   IMAGE                                                  REPLICAS   AGE\n"+
+		"2          artifactory.myorg.com:5010/myapp-docker-image:ccc333   2          2d\n"+
+		"1          artifactory.myorg.com:5010/myapp-docker-image:aaa111   0          3d\n", stdout.String())
+}
+
+func TestRollback(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, stdout, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"rollback"}, context...)))
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:aaa111", cluster.patched)
+	assert.Equal(t, "rolled back myapp-deployment to the previous revision\n", stdout.String())
+
+	assert.Equal(t, ExitError, c.Run(append([]string{"rollback", "7"}, context...)))
+}
+
+func TestLogs(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, stdout, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"logs", "--tail", "5"}, context...)))
+	assert.Equal(t, "==> myapp-deployment-1-abcde <==\nlistening on :8080\n\n==> myapp-deployment-1-fghij <==\nlistening on :8080\n", stdout.String())
+	assert.Equal(t, "container=myapp-container&tailLines=5", cluster.logQuery)
+}
+
+func TestEvents(t *testing.T) {
+	c, stdout, _, context, cleanUp := mockStaging(&MockKubernetes{})
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"events", "--warnings", "--since", "1h"}, context...)))
+	assert.Equal(t, "LAST SEEN   TYPE      REASON    OBJECT                         MESSAGE\n"+
+		"5m          Warning   BackOff   pod/myapp-deployment-1-fghij   Back-off pulling image\n", stdout.String())
+}
+
+func TestRestart(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, stdout, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"restart"}, context...)))
+	assert.Equal(t, "restarted myapp-deployment\n", stdout.String())
+	assert.Contains(t, cluster.patchBody, deploy.RestartedAtAnnotation)
+}
+
+func TestScale(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, stdout, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	assert.Equal(t, ExitOK, c.Run(append([]string{"scale", "4", "-o", "yaml"}, context...)))
+	assert.Equal(t, "action: scale\ndeployment: myapp-deployment\nreplicas: 4\nresult: success\n", stdout.String())
+	assert.Contains(t, cluster.patchBody, `"replicas":4`)
+}
+
+func TestOverrides(t *testing.T) {
+	cluster := &MockKubernetes{}
+	c, _, _, context, cleanUp := mockStaging(cluster)
+	defer cleanUp()
+
+	args := append([]string{"deploy", "ddd444", "-n", "myapp-preview", "--deployment", "preview", "--container", "web"}, context...)
+	assert.Equal(t, ExitOK, c.Run(args))
+	assert.Equal(t, "/apis/extensions/v1beta1/namespaces/myapp-preview/deployments/preview", cluster.patchPath)
+	assert.Contains(t, cluster.patchBody, `"name":"web"`)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, exitCode(nil))
+	assert.Equal(t, ExitError, exitCode(fmt.Errorf("received 500")))
+	assert.Equal(t, ExitUsage, exitCode(&usageError{"usage"}))
+	assert.Equal(t, ExitPolicyDenied, exitCode(&deploy.PolicyDeniedError{}))
+	assert.Equal(t, ExitDeployAborted, exitCode(&deploy.DeployAbortedError{Err: fmt.Errorf("migration failed")}))
+	assert.Equal(t, ExitRolloutFailed, exitCode(&exitError{code: ExitRolloutFailed, err: fmt.Errorf("timed out")}))
+}
+
+//
+// MOCK DATA
+//
+
+// mockCLI writes to buffers, and thinks it is 4pm on 30 March 2017
+func mockCLI(client *http.Client) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	c := &CLI{
+		Stdout: stdout,
+		Stderr: stderr,
+		Client: client,
+		Now: func() time.Time {
+			return time.Date(2017, 3, 30, 16, 0, 0, 0, time.UTC)
+		},
+	}
+	return c, stdout, stderr
+}
+
+// mockStaging serves cluster and writes an environments file for it, returning the
+// CLI, its output, the flags that pick the staging context and a clean up function
+func mockStaging(cluster *MockKubernetes) (*CLI, *bytes.Buffer, *bytes.Buffer, []string, func()) {
+	server := httptest.NewTLSServer(cluster)
+	dir, _ := ioutil.TempDir("", "environments")
+	path := filepath.Join(dir, "environments.json")
+	ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"environments":{"staging":{
+		"endpoint": %q,
+		"namespace": "myapp-staging",
+		"deploymentName": "myapp-deployment",
+		"containerName": "myapp-container",
+		"imagePrefix": "artifactory.myorg.com:5010/myapp-docker-image"
+	}}}`, strings.TrimPrefix(server.URL, "https://"))), 0600)
+
+	c, stdout, stderr := mockCLI(server.Client())
+	context := []string{"--environments", path, "--context", "staging"}
+	return c, stdout, stderr, context, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// MockKubernetes serves two pods, myapp-deployment, its two ReplicaSets, events and logs.
+// With progress set, one more replica becomes ready each time the deployment is fetched,
+// and a watch streams the rest of the rollout.
+// With broken set, every request fails.
+type MockKubernetes struct {
+	mutex     sync.Mutex
+	patched   string
+	patchPath string
+	patchBody string
+	logQuery  string
+	progress  bool
+	failed    bool
+	broken    bool
+	ready     int
+}
+
+func (c *MockKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch {
+	case c.broken:
+		w.WriteHeader(http.StatusInternalServerError)
+	case strings.HasSuffix(r.URL.Path, "/pods"):
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"myapp-deployment-1-abcde","creationTimestamp":"2017-03-30T14:00:00Z"},"status":{"phase":"Running",
+			 "containerStatuses":[{"image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333","imageID":"docker-pullable://artifactory.myorg.com:5010/myapp-docker-image@sha256:056d","ready":true}]}},
+			{"metadata":{"name":"myapp-deployment-1-fghij","creationTimestamp":"2017-03-30T15:55:00Z"},"status":{"phase":"Running",
+			 "containerStatuses":[{"image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333","ready":false,"restartCount":3,"state":{"waiting":{"reason":"ImagePullBackOff"}}}]}},
+			{"metadata":{"name":"other-deployment-1-klmno"},"status":{"phase":"Running"}}
+		]}`))
+	case strings.HasSuffix(r.URL.Path, "/log"):
+		c.logQuery = r.URL.RawQuery
+		w.Write([]byte("listening on :8080\n"))
+	case strings.HasSuffix(r.URL.Path, "/events"):
+		w.Write([]byte(`{"items":[
+			{"involvedObject":{"kind":"Pod","name":"myapp-deployment-1-fghij"},"reason":"BackOff","message":"Back-off pulling image","type":"Warning","count":4,"lastTimestamp":"2017-03-30T15:55:00Z"},
+			{"involvedObject":{"kind":"Pod","name":"myapp-deployment-1-fghij"},"reason":"Failed","message":"Error: ErrImagePull","type":"Warning","count":1,"lastTimestamp":"2017-03-30T12:00:00Z"},
+			{"involvedObject":{"kind":"Pod","name":"myapp-deployment-1-abcde"},"reason":"Started","message":"Started container","type":"Normal","count":1,"lastTimestamp":"2017-03-30T15:56:00Z"},
+			{"involvedObject":{"kind":"Pod","name":"other-deployment-1-klmno"},"reason":"BackOff","message":"Back-off","type":"Warning","count":1,"lastTimestamp":"2017-03-30T15:57:00Z"}
+		]}`))
+	case strings.HasSuffix(r.URL.Path, "/replicasets"):
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"myapp-deployment-1","creationTimestamp":"2017-03-27T12:00:00Z","annotations":{"deployment.kubernetes.io/revision":"1"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:aaa111"}]}}},"status":{"replicas":0}},
+			{"metadata":{"name":"myapp-deployment-2","creationTimestamp":"2017-03-28T12:00:00Z","annotations":{"deployment.kubernetes.io/revision":"2"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}},"status":{"replicas":2}}
+		]}`))
+	case strings.Contains(r.URL.Path, "/deployments/"):
+		if r.Method == http.MethodPatch {
+			raw, _ := ioutil.ReadAll(r.Body)
+			c.patchPath, c.patchBody = r.URL.Path, string(raw)
+			patch := &deploy.Deployment{}
+			json.Unmarshal(raw, patch)
+			if len(patch.Spec.Template.Spec.Containers) > 0 {
+				c.patched = patch.Spec.Template.Spec.Containers[0].Image
+			}
+		}
+		w.Write(c.deployment())
+		if c.progress && c.ready < 2 {
+			c.ready++
+		}
+	case strings.HasSuffix(r.URL.Path, "/deployments") && r.URL.Query().Get("watch") == "true":
+		// with progress set, the rest of the rollout arrives as changes
+		for c.progress && c.ready < 2 {
+			c.ready++
+			fmt.Fprintf(w, `{"type":"MODIFIED","object":%s}`+"\n", c.deployment())
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (c *MockKubernetes) deployment() []byte {
+	conditions := `[]`
+	if c.failed {
+		conditions = `[{"type":"Progressing","status":"False","reason":"ProgressDeadlineExceeded"}]`
+	}
+	return []byte(fmt.Sprintf(`{"metadata":{"name":"myapp-deployment","generation":1},"spec":{"replicas":2,
+		"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}},
+		"status":{"observedGeneration":1,"replicas":2,"updatedReplicas":%d,"readyReplicas":%d,"availableReplicas":%d,"conditions":%s}}`,
+		c.ready, c.ready, c.ready, conditions))
+}
@@ -0,0 +1,416 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// command is a subcommand, with the number of arguments it takes
+type command struct {
+	name    string
+	usage   string
+	summary string
+	minArgs int
+	maxArgs int
+	flags   func(flags *flag.FlagSet, opts *options)
+	run     func(c *CLI, inv *invocation) error
+}
+
+var commands = []*command{
+	{name: "ls", usage: "ls", summary: "list the pods of the deployment", run: (*CLI).ls},
+	{name: "deploy", usage: "deploy <tag>", summary: "deploy the image with this tag", minArgs: 1, maxArgs: 1, flags: deployFlags, run: (*CLI).deploy},
+	{name: "status", usage: "status", summary: "show how far the rollout has got", flags: watchFlags, run: (*CLI).status},
+	{name: "wait", usage: "wait", summary: "wait for the rollout to finish", flags: watchFlags, run: (*CLI).wait},
+	{name: "history", usage: "history", summary: "list the revisions of the deployment", run: (*CLI).history},
+	{name: "rollback", usage: "rollback [revision]", summary: "deploy an earlier revision again, by default the previous one", maxArgs: 1, flags: rollbackFlags, run: (*CLI).rollback},
+	{name: "logs", usage: "logs", summary: "show the logs of each pod", flags: logsFlags, run: (*CLI).logs},
+	{name: "events", usage: "events", summary: "list recent Kubernetes events about the deployment", flags: eventsFlags, run: (*CLI).events},
+	{name: "restart", usage: "restart", summary: "replace every pod, keeping the image", flags: waitFlags, run: (*CLI).restart},
+	{name: "scale", usage: "scale <replicas>", summary: "change the number of replicas", minArgs: 1, maxArgs: 1, run: (*CLI).scale},
+}
+
+// findCommand looks up a command by name
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func deployFlags(flags *flag.FlagSet, opts *options) {
+	flags.StringVar(&opts.user, "user", os.Getenv("USER"), "who asked for the deploy, checked by approval policies")
+	waitFlags(flags, opts)
+}
+
+func rollbackFlags(flags *flag.FlagSet, opts *options) {
+	flags.StringVar(&opts.user, "user", os.Getenv("USER"), "who asked for the rollback")
+	waitFlags(flags, opts)
+}
+
+func waitFlags(flags *flag.FlagSet, opts *options) {
+	flags.BoolVar(&opts.wait, "wait", false, "wait for the rollout to finish")
+	watchFlags(flags, opts)
+}
+
+func watchFlags(flags *flag.FlagSet, opts *options) {
+	flags.BoolVar(&opts.watch, "watch", false, "follow the rollout until it finishes, redrawing its progress")
+	flags.DurationVar(&opts.timeout, "timeout", 10*time.Minute, "how long to wait for the rollout")
+	flags.DurationVar(&opts.interval, "interval", 2*time.Second, "how often to check on the rollout, or to redraw it when watching")
+}
+
+func logsFlags(flags *flag.FlagSet, opts *options) {
+	flags.IntVar(&opts.tail, "tail", 100, "lines from the end of each pod's logs, or 0 for all of them")
+}
+
+func eventsFlags(flags *flag.FlagSet, opts *options) {
+	flags.BoolVar(&opts.warnings, "warnings", false, "only show warnings")
+	flags.DurationVar(&opts.since, "since", 0, "only show events seen within this duration, e.g. 1h")
+}
+
+func (c *CLI) ls(inv *invocation) error {
+	overview, err := inv.cluster.GetOverview()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve pod list: %s", err.Error())
+	}
+
+	return c.print(inv, overview, func(wide bool) *table {
+		return c.podTable(overview.Pods, wide)
+	})
+}
+
+func (c *CLI) deploy(inv *invocation) error {
+	tag := inv.args[0]
+	started := time.Now()
+	err := inv.cluster.DeployWithRequest(deploy.DeployRequest{
+		Tag:  tag,
+		User: inv.options.user,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := Result{Action: "deploy", Deployment: inv.environment.DeploymentName, Tag: tag, Result: deploy.AuditResultSuccess}
+	rolloutErr := c.waitIfAsked(inv, &result, fmt.Sprintf("Deploying %s to %s", tag, inv.environment.DeploymentName))
+
+	podList, err := inv.cluster.GetPodList()
+	if err == nil {
+		result.Pods = podList.Overview()
+	}
+
+	// Show any problems Kubernetes reported since the deploy, e.g. failed image pulls
+	eventList, err := inv.cluster.GetEventList()
+	if err == nil {
+		result.Warnings = newEvents(eventList.FilterByDeployment(inv.environment.DeploymentName).Since(started).Warnings())
+	}
+
+	err = c.print(inv, result, func(wide bool) *table {
+		t := c.podTable(result.Pods, wide)
+		if result.Rollout != nil {
+			t.footer = append(t.footer, "", rolloutLine(result.Rollout))
+		}
+		if len(result.Warnings) > 0 {
+			t.footer = append(t.footer, "")
+		}
+		for _, event := range result.Warnings {
+			t.footer = append(t.footer, fmt.Sprintf("%s %s: %s", event.Reason, event.Object, event.Message))
+		}
+		return t
+	})
+	if rolloutErr != nil {
+		return rolloutErr
+	}
+	return err
+}
+
+func (c *CLI) status(inv *invocation) error {
+	if inv.options.watch {
+		return c.wait(inv)
+	}
+
+	deployment, err := inv.cluster.GetDeployment()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve deployment: %s", err.Error())
+	}
+
+	status := deploy.NewRolloutStatus(deployment, inv.environment.ContainerName)
+	err = c.print(inv, status, func(wide bool) *table {
+		return rolloutTable(status, wide)
+	})
+	if err == nil && status.Failed {
+		return &exitError{code: ExitRolloutFailed, err: fmt.Errorf("rollout of %s exceeded its progress deadline", status.Deployment)}
+	}
+	return err
+}
+
+func (c *CLI) wait(inv *invocation) error {
+	deployment, err := c.followRollout(inv, fmt.Sprintf("Rollout of %s", inv.environment.DeploymentName))
+	if deployment == nil {
+		return err
+	}
+
+	// the last frame of a watch already shows the status
+	printErr := error(nil)
+	if !inv.options.watch || !c.isTable(inv) {
+		status := deploy.NewRolloutStatus(deployment, inv.environment.ContainerName)
+		printErr = c.print(inv, status, func(wide bool) *table {
+			return rolloutTable(status, wide)
+		})
+	}
+	if err != nil {
+		return &exitError{code: ExitRolloutFailed, err: err}
+	}
+	return printErr
+}
+
+func (c *CLI) history(inv *invocation) error {
+	revisions, err := inv.cluster.History()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve history: %s", err.Error())
+	}
+
+	return c.print(inv, revisions, func(wide bool) *table {
+		t := &table{headers: []string{"REVISION", "IMAGE", "REPLICAS", "AGE"}}
+		if wide {
+			t.headers = append(t.headers, "NAME", "CREATED")
+		}
+		for _, revision := range revisions {
+			row := []string{
+				strconv.FormatInt(revision.Number, 10),
+				revision.Image,
+				strconv.Itoa(revision.Replicas),
+				age(revision.Created, c.now()),
+			}
+			if wide {
+				row = append(row, revision.Name, timestamp(revision.Created))
+			}
+			t.rows = append(t.rows, row)
+		}
+		return t
+	})
+}
+
+func (c *CLI) rollback(inv *invocation) error {
+	var revision int64
+	if len(inv.args) == 1 {
+		var err error
+		revision, err = strconv.ParseInt(inv.args[0], 10, 64)
+		if err != nil || revision < 0 {
+			return &usageError{fmt.Sprintf("revision must be a number, not %q", inv.args[0])}
+		}
+	}
+
+	err := inv.cluster.Rollback(deploy.DeployRequest{User: inv.options.user}, revision)
+	if err != nil {
+		return err
+	}
+
+	result := Result{Action: "rollback", Deployment: inv.environment.DeploymentName, Revision: revision, Result: deploy.AuditResultSuccess}
+	rolloutErr := c.waitIfAsked(inv, &result, fmt.Sprintf("Rolling back %s", inv.environment.DeploymentName))
+	return c.printResult(inv, result, rolloutErr)
+}
+
+func (c *CLI) logs(inv *invocation) error {
+	logs, err := inv.cluster.GetPodLogs(inv.environment.ContainerName, inv.options.tail)
+	if err != nil {
+		return err
+	}
+
+	return c.print(inv, logs, func(wide bool) *table {
+		t := &table{}
+		for i, pod := range logs {
+			if len(logs) > 1 {
+				if i > 0 {
+					t.footer = append(t.footer, "")
+				}
+				t.footer = append(t.footer, fmt.Sprintf("==> %s <==", pod.Pod))
+			}
+			t.footer = append(t.footer, strings.TrimRight(pod.Logs, "\n"))
+		}
+		return t
+	})
+}
+
+func (c *CLI) events(inv *invocation) error {
+	eventList, err := inv.cluster.GetEventList()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve events: %s", err.Error())
+	}
+
+	if inv.environment.DeploymentName != "" {
+		eventList = eventList.FilterByDeployment(inv.environment.DeploymentName)
+	}
+	if inv.options.since > 0 {
+		eventList = eventList.Since(c.now().Add(-inv.options.since))
+	}
+	if inv.options.warnings {
+		eventList = eventList.Warnings()
+	}
+
+	events := newEvents(eventList)
+	return c.print(inv, events, func(wide bool) *table {
+		t := &table{headers: []string{"LAST SEEN", "TYPE", "REASON", "OBJECT", "MESSAGE"}}
+		if wide {
+			t.headers = append(t.headers, "COUNT")
+		}
+		for _, event := range events {
+			row := []string{age(event.LastSeen, c.now()), event.Type, event.Reason, event.Object, event.Message}
+			if wide {
+				row = append(row, strconv.Itoa(event.Count))
+			}
+			t.rows = append(t.rows, row)
+		}
+		return t
+	})
+}
+
+func (c *CLI) restart(inv *invocation) error {
+	err := inv.cluster.Restart()
+	if err != nil {
+		return err
+	}
+
+	result := Result{Action: "restart", Deployment: inv.environment.DeploymentName, Result: deploy.AuditResultSuccess}
+	rolloutErr := c.waitIfAsked(inv, &result, fmt.Sprintf("Restarting %s", inv.environment.DeploymentName))
+	return c.printResult(inv, result, rolloutErr)
+}
+
+func (c *CLI) scale(inv *invocation) error {
+	replicas, err := strconv.Atoi(inv.args[0])
+	if err != nil || replicas < 0 {
+		return &usageError{fmt.Sprintf("replicas must be a number, not %q", inv.args[0])}
+	}
+
+	err = inv.cluster.Scale(replicas)
+	if err != nil {
+		return err
+	}
+
+	result := Result{Action: "scale", Deployment: inv.environment.DeploymentName, Replicas: &replicas, Result: deploy.AuditResultSuccess}
+	return c.printResult(inv, result, nil)
+}
+
+// printResult prints the outcome of a change, returning rolloutErr in preference to any printing error
+func (c *CLI) printResult(inv *invocation, result Result, rolloutErr error) error {
+	err := c.print(inv, result, func(wide bool) *table {
+		t := &table{footer: []string{resultLine(result)}}
+		if result.Rollout != nil {
+			t.footer = append(t.footer, rolloutLine(result.Rollout))
+		}
+		return t
+	})
+	if rolloutErr != nil {
+		return rolloutErr
+	}
+	return err
+}
+
+// waitIfAsked waits for the rollout when --wait or --watch was given, adding its status to the result
+func (c *CLI) waitIfAsked(inv *invocation, result *Result, title string) error {
+	if !inv.options.wait && !inv.options.watch {
+		return nil
+	}
+
+	deployment, err := c.followRollout(inv, title)
+	if deployment != nil {
+		result.Rollout = deploy.NewRolloutStatus(deployment, inv.environment.ContainerName)
+	}
+	if err != nil {
+		result.Result = deploy.AuditResultFailure
+		return &exitError{code: ExitRolloutFailed, err: err}
+	}
+	return nil
+}
+
+// followRollout waits until the rollout finishes, watching it when --watch was given. The deployment is
+// returned along with the error when the rollout failed or timed out.
+func (c *CLI) followRollout(inv *invocation, title string) (*deploy.Deployment, error) {
+	if inv.options.watch {
+		return c.watchRollout(inv, title)
+	}
+
+	waiter, ok := inv.cluster.DeployMaker.(deploy.RolloutWaiter)
+	if !ok {
+		return nil, fmt.Errorf("deployer cannot wait for its rollout")
+	}
+	return waiter.WaitForRollout(inv.options.timeout, inv.options.interval)
+}
+
+// podTable lists pods, adding their digest and creation time when wide
+func (c *CLI) podTable(pods []deploy.PodItem, wide bool) *table {
+	t := &table{headers: []string{"NAME", "STATUS", "READY", "RESTARTS", "TAG", "AGE"}}
+	if wide {
+		t.headers = append(t.headers, "DIGEST", "CREATED")
+	}
+	for _, pod := range pods {
+		status := pod.Status
+		if pod.Reason != "" {
+			status = pod.Reason
+		}
+		row := []string{pod.Name, status, strconv.FormatBool(pod.Ready), strconv.Itoa(pod.Restarts), pod.Tag, age(pod.Created, c.now())}
+		if wide {
+			row = append(row, pod.Digest, timestamp(pod.Created))
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+// rolloutTable shows the replica counts of a rollout, adding the image when wide
+func rolloutTable(status *deploy.RolloutStatus, wide bool) *table {
+	t := &table{headers: []string{"DEPLOYMENT", "DESIRED", "UPDATED", "READY", "AVAILABLE", "ROLLOUT"}}
+	row := []string{
+		status.Deployment,
+		strconv.Itoa(status.DesiredReplicas),
+		strconv.Itoa(status.UpdatedReplicas),
+		strconv.Itoa(status.ReadyReplicas),
+		strconv.Itoa(status.AvailableReplicas),
+		rolloutState(status),
+	}
+	if wide {
+		t.headers = append(t.headers, "IMAGE")
+		row = append(row, status.Image)
+	}
+	t.rows = [][]string{row}
+	return t
+}
+
+// rolloutLine describes a rollout in a sentence
+func rolloutLine(status *deploy.RolloutStatus) string {
+	return fmt.Sprintf("rollout of %s %s: %d of %d replicas updated and available",
+		status.Deployment, rolloutState(status), status.AvailableReplicas, status.DesiredReplicas)
+}
+
+// rolloutState is complete, failed or progressing
+func rolloutState(status *deploy.RolloutStatus) string {
+	switch {
+	case status.Failed:
+		return "failed"
+	case status.Complete:
+		return "complete"
+	}
+	return "progressing"
+}
+
+// resultLine describes the outcome of a change in a sentence
+func resultLine(result Result) string {
+	switch result.Action {
+	case "rollback":
+		if result.Revision == 0 {
+			return fmt.Sprintf("rolled back %s to the previous revision", result.Deployment)
+		}
+		return fmt.Sprintf("rolled back %s to revision %d", result.Deployment, result.Revision)
+	case "restart":
+		return fmt.Sprintf("restarted %s", result.Deployment)
+	case "scale":
+		return fmt.Sprintf("scaled %s to %d replicas", result.Deployment, *result.Replicas)
+	}
+	return fmt.Sprintf("deployed %s to %s", result.Tag, result.Deployment)
+}
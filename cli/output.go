@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Event is a Kubernetes event about the deployment, its ReplicaSets or its pods.
+type Event struct {
+	LastSeen time.Time `json:"lastSeen"`
+	Type     string    `json:"type"`
+	Reason   string    `json:"reason"`
+	Object   string    `json:"object"`
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+}
+
+// Result is the outcome of a deploy, rollback, restart or scale.
+type Result struct {
+	Action     string                `json:"action"`
+	Deployment string                `json:"deployment"`
+	Tag        string                `json:"tag,omitempty"`
+	Revision   int64                 `json:"revision,omitempty"`
+	Replicas   *int                  `json:"replicas,omitempty"`
+	Result     string                `json:"result"`
+	Rollout    *deploy.RolloutStatus `json:"rollout,omitempty"`
+	Pods       []deploy.PodItem      `json:"pods,omitempty"`
+	Warnings   []Event               `json:"warnings,omitempty"`
+}
+
+func newEvents(eventList *deploy.EventList) []Event {
+	events := []Event{}
+	for _, item := range eventList.Items {
+		events = append(events, Event{
+			LastSeen: item.Timestamp(),
+			Type:     item.Type,
+			Reason:   item.Reason,
+			Object:   strings.ToLower(item.InvolvedObject.Kind) + "/" + item.InvolvedObject.Name,
+			Message:  item.Message,
+			Count:    item.Count,
+		})
+	}
+	return events
+}
+
+// table is the human readable output of a command: aligned columns under headers, then any footer lines
+type table struct {
+	headers []string
+	rows    [][]string
+	footer  []string
+}
+
+func (t *table) write(w io.Writer) error {
+	if len(t.headers) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		err := tw.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	for _, line := range t.footer {
+		_, err := fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// print writes value as JSON or YAML, or else the table built by render
+func (c *CLI) print(inv *invocation, value interface{}, render func(wide bool) *table) error {
+	switch inv.options.output {
+	case OutputJSON:
+		encoder := json.NewEncoder(c.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case OutputYAML:
+		out, err := deploy.MarshalYAML(value)
+		if err != nil {
+			return err
+		}
+		_, err = c.Stdout.Write(out)
+		return err
+	}
+	return render(inv.options.output == OutputWide).write(c.Stdout)
+}
+
+// age is how long ago t was, in the largest whole unit, e.g. `5m` or `3d`
+func age(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < time.Minute:
+		return fmt.Sprintf("%ds", int(elapsed.Seconds()))
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm", int(elapsed.Minutes()))
+	case elapsed < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(elapsed.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(elapsed.Hours()/24))
+}
+
+// timestamp formats t for wide tables
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAge(t *testing.T) {
+	now := time.Date(2017, 3, 30, 16, 0, 0, 0, time.UTC)
+	assert.Equal(t, "42s", age(now.Add(-42*time.Second), now))
+	assert.Equal(t, "5m", age(now.Add(-5*time.Minute), now))
+	assert.Equal(t, "47h", age(now.Add(-47*time.Hour), now))
+	assert.Equal(t, "3d", age(now.Add(-80*time.Hour), now))
+	assert.Equal(t, "<unknown>", age(time.Time{}, now))
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// watchRollout follows the rollout through the Kubernetes watch API, drawing its progress until it completes, fails
+// or times out. The progress goes to stderr when stdout is kept for JSON or YAML. The deployment is returned along
+// with the error when the rollout failed or timed out. Watch reconnects with a backoff, so only errors it cannot
+// retry, such as the deployment being deleted, end the watch early.
+func (c *CLI) watchRollout(inv *invocation, title string) (*deploy.Deployment, error) {
+	watcher, ok := inv.cluster.DeployMaker.(deploy.DeploymentWatcher)
+	if !ok {
+		return nil, fmt.Errorf("deployer cannot watch its deployment")
+	}
+
+	out := c.Stdout
+	if !c.isTable(inv) {
+		out = c.Stderr
+	}
+	view := &rolloutView{out: out, live: isTerminal(out)}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := make(chan *deploy.Deployment)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watcher.Watch(stop, changes)
+	}()
+
+	started := time.Now()
+	timeout := time.After(inv.options.timeout)
+	redraw := time.NewTicker(inv.options.interval)
+	defer redraw.Stop()
+
+	var deployment *deploy.Deployment
+	for {
+		select {
+		case deployment = <-changes:
+		case <-redraw.C:
+			if deployment == nil {
+				continue
+			}
+		case err := <-watchErr:
+			return nil, err
+		case <-timeout:
+			return deployment, fmt.Errorf("timed out waiting for rollout of %s", inv.environment.DeploymentName)
+		}
+
+		// pods are not watched, so their tags and waiting reasons are brought up to date on every redraw
+		overview := deploy.NewDeploymentOverview(inv.environment.DeploymentName, nil)
+		if podList, err := inv.cluster.GetPodList(); err == nil {
+			overview = deploy.NewDeploymentOverview(inv.environment.DeploymentName, podList.Overview())
+		}
+		overview.Rollout = deploy.NewRolloutStatus(deployment, inv.environment.ContainerName)
+		view.draw(title, overview, time.Since(started))
+
+		if deployment.RolloutComplete() {
+			return deployment, nil
+		}
+		if deployment.RolloutFailed() {
+			return deployment, fmt.Errorf("rollout of %s exceeded its progress deadline", inv.environment.DeploymentName)
+		}
+	}
+}
+
+// rolloutView draws rollout progress. On a terminal each frame replaces the one before,
+// otherwise a line is printed each time the progress changes.
+type rolloutView struct {
+	out  io.Writer
+	live bool
+	// lines is the height of the last frame, to move back over it
+	lines int
+	// last is the last line printed when not live
+	last string
+}
+
+func (v *rolloutView) draw(title string, overview *deploy.DeploymentOverview, elapsed time.Duration) error {
+	elapsed = elapsed.Round(time.Second)
+	if !v.live {
+		line := progressLine(overview)
+		if line == v.last {
+			return nil
+		}
+		v.last = line
+		_, err := fmt.Fprintf(v.out, "[%s] %s\n", elapsed, line)
+		return err
+	}
+
+	frame := &bytes.Buffer{}
+	fmt.Fprintf(frame, "%s (%s)\n\n", title, elapsed)
+	rolloutTable(overview.Rollout, false).write(frame)
+
+	tags := &table{headers: []string{"TAG", "PODS"}}
+	for _, tag := range overview.Summary.Tags {
+		tags.rows = append(tags.rows, []string{tag.Tag, strconv.Itoa(tag.Count)})
+	}
+	frame.WriteString("\n")
+	tags.write(frame)
+
+	if len(overview.Summary.Waiting) > 0 {
+		waiting := &table{headers: []string{"WAITING", "PODS"}}
+		for _, reason := range overview.Summary.Waiting {
+			waiting.rows = append(waiting.rows, []string{reason.Reason, strconv.Itoa(reason.Count)})
+		}
+		frame.WriteString("\n")
+		waiting.write(frame)
+	}
+
+	if v.lines > 0 {
+		// move up to the start of the last frame and clear everything below
+		fmt.Fprintf(v.out, "\x1b[%dA\x1b[J", v.lines)
+	}
+	v.lines = strings.Count(frame.String(), "\n")
+	_, err := v.out.Write(frame.Bytes())
+	return err
+}
+
+// progressLine describes the rollout and its pods on one line, e.g. for CI logs
+func progressLine(overview *deploy.DeploymentOverview) string {
+	status := overview.Rollout
+	line := fmt.Sprintf("%s %s: %d desired, %d updated, %d ready, %d available",
+		status.Deployment, rolloutState(status), status.DesiredReplicas, status.UpdatedReplicas, status.ReadyReplicas, status.AvailableReplicas)
+
+	tags := []string{}
+	for _, tag := range overview.Summary.Tags {
+		tags = append(tags, fmt.Sprintf("%s x%d", tag.Tag, tag.Count))
+	}
+	if len(tags) > 0 {
+		line += "; pods " + strings.Join(tags, ", ")
+	}
+
+	reasons := []string{}
+	for _, reason := range overview.Summary.Waiting {
+		reasons = append(reasons, fmt.Sprintf("%s x%d", reason.Reason, reason.Count))
+	}
+	if len(reasons) > 0 {
+		line += "; waiting " + strings.Join(reasons, ", ")
+	}
+	return line
+}
+
+// isTable is true unless the output is JSON or YAML
+func (c *CLI) isTable(inv *invocation) bool {
+	return inv.options.output == OutputTable || inv.options.output == OutputWide
+}
+
+// isTerminal is true when w is a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
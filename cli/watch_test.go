@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutViewLive(t *testing.T) {
+	out := &bytes.Buffer{}
+	view := &rolloutView{out: out, live: true}
+
+	overview := deploy.NewDeploymentOverview("myapp-deployment", []deploy.PodItem{
+		{Tag: "ccc333", Ready: true},
+		{Tag: "ddd444", Reason: "ImagePullBackOff"},
+	})
+	overview.Rollout = &deploy.RolloutStatus{Deployment: "myapp-deployment", DesiredReplicas: 2, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+	frame := "Rollout of myapp-deployment (3s)\n\n" +
+		"DEPLOYMENT         DESIRED   UPDATED   READY   AVAILABLE   ROLLOUT\n" +
+		"myapp-deployment   2         1         1       1           progressing\n\n" +
+		"TAG      PODS\n" +
+		"ccc333   1\n" +
+		"ddd444   1\n\n" +
+		"WAITING            PODS\n" +
+		"ImagePullBackOff   1\n"
+
+	assert.Nil(t, view.draw("Rollout of myapp-deployment", overview, 2600*time.Millisecond))
+	assert.Equal(t, frame, out.String())
+
+	out.Reset()
+	assert.Nil(t, view.draw("Rollout of myapp-deployment", overview, 2600*time.Millisecond))
+	assert.Equal(t, "\x1b[11A\x1b[J"+frame, out.String())
+}
+
+func TestRolloutViewLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	view := &rolloutView{out: out}
+
+	overview := deploy.NewDeploymentOverview("myapp-deployment", nil)
+	overview.Rollout = &deploy.RolloutStatus{Deployment: "myapp-deployment", DesiredReplicas: 2}
+	view.draw("Rollout of myapp-deployment", overview, time.Second)
+	view.draw("Rollout of myapp-deployment", overview, 2*time.Second)
+	overview.Rollout = &deploy.RolloutStatus{Deployment: "myapp-deployment", DesiredReplicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2, Complete: true}
+	view.draw("Rollout of myapp-deployment", overview, 3*time.Second)
+
+	assert.Equal(t, "[1s] myapp-deployment progressing: 2 desired, 0 updated, 0 ready, 0 available\n"+
+		"[3s] myapp-deployment complete: 2 desired, 2 updated, 2 ready, 2 available\n", out.String())
+}
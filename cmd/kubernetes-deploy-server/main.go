@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/Unity-Technologies/kubernetes-deploy/metrics"
+	"github.com/Unity-Technologies/kubernetes-deploy/server"
+	"github.com/Unity-Technologies/kubernetes-deploy/slack"
+	"github.com/Unity-Technologies/kubernetes-deploy/tracing"
+	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// kubernetes-deploy-server serves the REST API for every environment in an environments file.
+//
+// API keys are read from DEPLOY_API_KEYS as `key=user,key=user`, and
+// HMAC secrets from DEPLOY_HMAC_SECRETS as `keyid=secret,keyid=secret`.
+// Slack slash commands are answered on /slack when SLACK_SIGNING_SECRET is set,
+// and Prometheus metrics are served on /metrics with -metrics. With -cache, each environment's
+// namespace is followed with the watch API, so reads and rollout metrics make no extra API calls.
+// With -log-level debug, every Kubernetes API call is logged, without its token.
+// With -trace, each request, deploy and API call is recorded as an OpenTelemetry span written to stdout,
+// continuing the trace of any `traceparent` header the request carries.
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	environmentsPath := flag.String("environments", "environments.json", "environments file")
+	qps := flag.Float64("qps", deploy.DefaultQPS, "Kubernetes API calls per second, across all environments")
+	burst := flag.Int("burst", deploy.DefaultBurst, "Kubernetes API calls allowed in a burst above --qps")
+	serveMetrics := flag.Bool("metrics", false, "serve Prometheus metrics on /metrics")
+	cacheNamespaces := flag.Bool("cache", false, "follow each environment's namespace with the watch API instead of polling it")
+	logLevel := flag.String("log-level", "info", "debug, info, warn or error")
+	traceSpans := flag.Bool("trace", false, "write OpenTelemetry spans of requests, deploys and API calls to stdout")
+	flag.Parse()
+
+	level, err := deploy.ParseLogLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := &deploy.TextLogger{Output: log.New(os.Stderr, "", log.LstdFlags), Level: level}
+
+	// .env is optional here, the variables may already be set
+	godotenv.Load()
+
+	var apiTransport http.RoundTripper = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if level <= deploy.LevelDebug {
+		apiTransport = &deploy.LoggingTransport{Transport: apiTransport, Logger: logger}
+	}
+	var m *metrics.Metrics
+	if *serveMetrics {
+		m = metrics.NewMetrics()
+		apiTransport = m.Transport(apiTransport)
+	}
+	var tracer *tracing.Tracer
+	if *traceSpans {
+		tracer, err = newStdoutTracer()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiTransport = &deploy.TracingTransport{Transport: apiTransport}
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 30,
+		Transport: &deploy.RetryTransport{
+			Transport: &deploy.RateLimitTransport{
+				Transport: apiTransport,
+				// every environment shares the limiter, so a burst of calls cannot overwhelm the API servers
+				Limiter: &deploy.RateLimiter{QPS: *qps, Burst: *burst},
+				Report:  logThrottledCall,
+			},
+		},
+	}
+
+	environments, err := deploy.LoadEnvironments(*environmentsPath, client)
+	if err != nil {
+		log.Fatalf("Unable to load environments due to %s", err.Error())
+	}
+
+	// the server runs until it exits, so the caches are never stopped
+	stop := make(chan struct{})
+	for _, name := range environments.Names() {
+		environments.Environments[name].Logger = logger
+		if tracer != nil {
+			environments.Environments[name].Tracer = tracer
+		}
+		if *cacheNamespaces {
+			followNamespace(name, environments.Environments[name], stop)
+		}
+		if m != nil {
+			m.Instrument(name, environments.Environments[name])
+		}
+	}
+
+	auth := server.AnyAuthenticator{}
+	if keys := parsePairs(os.Getenv("DEPLOY_API_KEYS")); len(keys) > 0 {
+		auth = append(auth, server.APIKeys(keys))
+	}
+	if secrets := parsePairs(os.Getenv("DEPLOY_HMAC_SECRETS")); len(secrets) > 0 {
+		auth = append(auth, &server.HMACAuth{Secrets: secrets})
+	}
+	if len(auth) == 0 {
+		log.Fatal("Set DEPLOY_API_KEYS or DEPLOY_HMAC_SECRETS")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", traced(tracer, &server.Server{Environments: environments, Auth: auth}))
+	if m != nil {
+		mux.Handle("/metrics", m)
+	}
+	if secret := os.Getenv("SLACK_SIGNING_SECRET"); secret != "" {
+		mux.Handle("/slack", traced(tracer, &slack.Handler{
+			Environments:  environments,
+			SigningSecret: secret,
+			Client:        &http.Client{Timeout: time.Second * 10},
+		}))
+	}
+
+	log.Printf("Serving %d environments on %s", len(environments.Names()), *listen)
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		// a deploy can wait up to 10 minutes for its rollout before answering, and status
+		// streams set their own write deadline for each event
+		WriteTimeout: 15 * time.Minute,
+		IdleTimeout:  2 * time.Minute,
+	}
+	log.Fatal(httpServer.ListenAndServe())
+}
+
+// followNamespace gives the cluster namespace a NamespaceCache of its deployer's namespace, kept up to date until stop is closed
+func followNamespace(name string, cluster *deploy.KubernetesClusterNamespace, stop <-chan struct{}) {
+	deployer, ok := cluster.DeployMaker.(*deploy.KubernetesDeployer)
+	if !ok {
+		return
+	}
+	cache := &deploy.NamespaceCache{
+		Client:             deployer.Client,
+		Endpoint:           deployer.Endpoint,
+		Namespace:          deployer.Namespace,
+		BearerTokenService: deployer.BearerTokenService,
+		ErrorHandler: func(kind string, err error) {
+			log.Printf("Unable to follow %s of %s due to %s", kind, name, err.Error())
+		},
+	}
+	go cache.Run(stop)
+	cluster.Cache = cache
+}
+
+// newStdoutTracer records spans with the OpenTelemetry SDK, writing each one to stdout as it ends
+func newStdoutTracer() (*tracing.Tracer, error) {
+	exporter, err := stdouttrace.New()
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))), nil
+}
+
+// traced serves handler within the trace of each request, when there is a tracer
+func traced(tracer *tracing.Tracer, handler http.Handler) http.Handler {
+	if tracer == nil {
+		return handler
+	}
+	return &tracing.Handler{Handler: handler, Tracer: tracer}
+}
+
+// logThrottledCall logs calls that waited a second or more for the rate limit, with the
+// API Priority and Fairness flow schema the API server put them in
+func logThrottledCall(call deploy.APICall) {
+	if call.Wait >= time.Second {
+		log.Printf("Waited %s for the rate limit before %s %s (flow schema %q, priority level %q)",
+			call.Wait, call.Method, call.Path, call.FlowSchemaUID, call.PriorityLevelUID)
+	}
+}
+
+// parsePairs reads `a=b,c=d` into a map
+func parsePairs(value string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) == 2 && parts[0] != "" {
+			pairs[parts[0]] = parts[1]
+		}
+	}
+	return pairs
+}
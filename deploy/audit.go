@@ -0,0 +1,203 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in a DeployAuditRecord
+const (
+	AuditActionDeploy   = "deploy"
+	AuditActionRollback = "rollback"
+)
+
+// Results recorded in a DeployAuditRecord
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+	AuditResultDenied  = "denied"
+	AuditResultAborted = "aborted"
+)
+
+// DeployAuditRecord describes a single deploy or rollback attempt, successful or not.
+type DeployAuditRecord struct {
+	Action          string    `json:"action"`
+	User            string    `json:"user"`
+	Time            time.Time `json:"time"`
+	Cluster         string    `json:"cluster"`
+	Namespace       string    `json:"namespace"`
+	Deployment      string    `json:"deployment"`
+	OldImage        string    `json:"oldImage"`
+	NewImage        string    `json:"newImage"`
+	Result          string    `json:"result"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// DeployAuditor represents any struct that records deploy attempts, e.g. to a file or a webhook.
+// Errors are ignored by KubernetesClusterNamespace so that a broken auditor never fails a deploy.
+type DeployAuditor interface {
+	AuditDeploy(record DeployAuditRecord) error
+}
+
+// DeployTarget represents any Deployer that can report which deployment it changes,
+// and the image running there now
+type DeployTarget interface {
+	Location() (namespace string, deploymentName string)
+	CurrentImage() (string, error)
+}
+
+// MultiAuditor sends each record to every auditor, e.g. a file and a webhook.
+type MultiAuditor []DeployAuditor
+
+// AuditDeploy records to every auditor even when one fails, returning the first error
+func (m MultiAuditor) AuditDeploy(record DeployAuditRecord) error {
+	var result error
+	for _, auditor := range m {
+		err := auditor.AuditDeploy(record)
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// WriterAuditor writes each record as a line of JSON, e.g. to os.Stdout.
+type WriterAuditor struct {
+	Writer io.Writer
+	mutex  sync.Mutex
+}
+
+// AuditDeploy writes the record as a line of JSON
+func (w *WriterAuditor) AuditDeploy(record DeployAuditRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return json.NewEncoder(w.Writer).Encode(record)
+}
+
+// FileAuditor appends each record as a line of JSON to the file at Path.
+type FileAuditor struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// AuditDeploy appends the record to the file, creating it when needed
+func (f *FileAuditor) AuditDeploy(record DeployAuditRecord) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(record)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WebhookAuditor posts each record as JSON to URL.
+// Each post gives up after Timeout (default 5 seconds), whatever the Client's own timeout,
+// so a webhook that hangs cannot hold up a deploy that has already been made.
+type WebhookAuditor struct {
+	Client  *http.Client
+	URL     string
+	Timeout time.Duration
+}
+
+// AuditDeploy posts the record to the webhook
+func (w *WebhookAuditor) AuditDeploy(record DeployAuditRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewBuffer(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("received %v", res.StatusCode)
+	}
+	return nil
+}
+
+// newAuditRecord starts a record for a deploy to target, looking up the image running there now
+func (n *KubernetesClusterNamespace) newAuditRecord(action string, req DeployRequest, target Deployer) DeployAuditRecord {
+	record := DeployAuditRecord{
+		Action:     action,
+		User:       req.User,
+		Time:       req.Time,
+		Cluster:    n.Description,
+		Deployment: n.DeploymentName,
+		NewImage:   req.Image,
+	}
+	if record.NewImage == "" {
+		record.NewImage = req.Tag
+	}
+
+	if deployTarget, ok := target.(DeployTarget); ok && n.Auditor != nil {
+		record.Namespace, record.Deployment = deployTarget.Location()
+		record.OldImage, _ = deployTarget.CurrentImage()
+	}
+	return record
+}
+
+// audit runs the deploy and records how it went
+func (n *KubernetesClusterNamespace) audit(record DeployAuditRecord, deploy func() error) error {
+	started := time.Now()
+	err := deploy()
+	duration := time.Since(started)
+	n.logDeploy(record, duration, err)
+	if n.Auditor == nil {
+		return err
+	}
+
+	record.DurationSeconds = duration.Seconds()
+	record.Result = AuditResult(err)
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	n.Auditor.AuditDeploy(record)
+	return err
+}
+
+// AuditResult is the result recorded for a deploy that returned err
+func AuditResult(err error) string {
+	var denied *PolicyDeniedError
+	var aborted *DeployAbortedError
+	switch {
+	case err == nil:
+		return AuditResultSuccess
+	case errors.As(err, &denied):
+		return AuditResultDenied
+	case errors.As(err, &aborted):
+		return AuditResultAborted
+	}
+	return AuditResultFailure
+}
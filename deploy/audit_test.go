@@ -0,0 +1,191 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSuccessfulDeploy(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	cluster.images["myapp-deployment"] = "artifactory.myorg.com:5010/myapp-docker-image:old"
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	output := &bytes.Buffer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		Description: "staging",
+		DeployMaker: mockKubernetesDeployer(server),
+		Auditor:     &WriterAuditor{Writer: output},
+	}
+
+	err := clusterNamespace.DeployWithRequest(DeployRequest{Tag: "abc123", User: "alice"})
+	assert.Nil(t, err)
+
+	record := DeployAuditRecord{}
+	json.Unmarshal(output.Bytes(), &record)
+	assert.Equal(t, AuditActionDeploy, record.Action)
+	assert.Equal(t, "alice", record.User)
+	assert.False(t, record.Time.IsZero())
+	assert.Equal(t, "staging", record.Cluster)
+	assert.Equal(t, "myapp-development", record.Namespace)
+	assert.Equal(t, "myapp-deployment", record.Deployment)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:old", record.OldImage)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:abc123", record.NewImage)
+	assert.Equal(t, AuditResultSuccess, record.Result)
+	assert.Equal(t, "", record.Error)
+}
+
+func TestAuditDeniedDeploy(t *testing.T) {
+	auditor := &MockAuditor{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{},
+		Policies:    []DeployPolicy{&ApprovalPolicy{Required: 1}},
+		Auditor:     auditor,
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(auditor.records))
+	assert.Equal(t, AuditResultDenied, auditor.records[0].Result)
+	assert.Equal(t, "abc123", auditor.records[0].NewImage)
+	assert.Equal(t, err.Error(), auditor.records[0].Error)
+}
+
+func TestAuditFailedDeploy(t *testing.T) {
+	auditor := &MockAuditor{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{err: fmt.Errorf("received 500")},
+		Auditor:     auditor,
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "received 500")
+	assert.Equal(t, AuditResultFailure, auditor.records[0].Result)
+	assert.Equal(t, "received 500", auditor.records[0].Error)
+}
+
+func TestAuditResultOfWrappedErrors(t *testing.T) {
+	denied := &PolicyDeniedError{Violations: []PolicyViolation{{Rule: "freeze", Reason: "frozen"}}}
+	assert.Equal(t, AuditResultDenied, AuditResult(fmt.Errorf("checking policies: %w", denied)))
+	aborted := &DeployAbortedError{Err: &APIError{StatusCode: 500}}
+	assert.Equal(t, AuditResultAborted, AuditResult(fmt.Errorf("before patch: %w", aborted)))
+	assert.Equal(t, AuditResultFailure, AuditResult(fmt.Errorf("rollout: %w", &APIError{StatusCode: 500})))
+}
+
+func TestAuditorFailureDoesNotFailDeploy(t *testing.T) {
+	deployer := &MockDeployer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Auditor:     &MockAuditor{err: fmt.Errorf("disk full")},
+	}
+
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.Equal(t, []string{"abc123"}, deployer.deployed)
+}
+
+func TestAuditBlueGreenRollback(t *testing.T) {
+	cluster := newMockBlueGreenCluster("green")
+	cluster.images["myapp-blue"] = "artifactory.myorg.com:5010/myapp-docker-image:old"
+	cluster.images["myapp-green"] = "artifactory.myorg.com:5010/myapp-docker-image:new"
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	auditor := &MockAuditor{}
+	namespace, bg := mockBlueGreen(server)
+	namespace.Auditor = auditor
+
+	assert.Nil(t, namespace.RollbackBlueGreen(bg))
+	record := auditor.records[0]
+	assert.Equal(t, AuditActionRollback, record.Action)
+	assert.Equal(t, "myapp-blue", record.Deployment)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:new", record.OldImage)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:old", record.NewImage)
+	assert.Equal(t, AuditResultSuccess, record.Result)
+}
+
+func TestFileAuditorAppends(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	auditor := &FileAuditor{Path: filepath.Join(dir, "audit.jsonl")}
+
+	assert.Nil(t, auditor.AuditDeploy(DeployAuditRecord{Action: AuditActionDeploy, NewImage: "one"}))
+	assert.Nil(t, auditor.AuditDeploy(DeployAuditRecord{Action: AuditActionRollback, NewImage: "two"}))
+
+	raw, _ := ioutil.ReadFile(auditor.Path)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"newImage":"one"`)
+	assert.Contains(t, lines[1], `"action":"rollback"`)
+}
+
+func TestWebhookAuditor(t *testing.T) {
+	var contentType, body string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		if strings.Contains(body, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer webhook.Close()
+
+	auditor := &WebhookAuditor{Client: webhook.Client(), URL: webhook.URL}
+	assert.Nil(t, auditor.AuditDeploy(DeployAuditRecord{User: "alice"}))
+	assert.Equal(t, "application/json", contentType)
+	assert.Contains(t, body, `"user":"alice"`)
+
+	assert.EqualError(t, auditor.AuditDeploy(DeployAuditRecord{User: "fail"}), "received 500")
+}
+
+func TestWebhookAuditorTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer webhook.Close()
+	defer close(release)
+
+	// the client has no timeout of its own
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{},
+		Auditor:     &WebhookAuditor{Client: &http.Client{}, URL: webhook.URL, Timeout: 10 * time.Millisecond},
+	}
+	started := time.Now()
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestMultiAuditorContinuesAfterFailure(t *testing.T) {
+	broken := &MockAuditor{err: fmt.Errorf("disk full")}
+	working := &MockAuditor{}
+
+	err := MultiAuditor{broken, working}.AuditDeploy(DeployAuditRecord{User: "alice"})
+	assert.EqualError(t, err, "disk full")
+	assert.Equal(t, 1, len(working.records))
+}
+
+//
+// MOCK DATA
+//
+
+type MockAuditor struct {
+	records []DeployAuditRecord
+	err     error
+}
+
+func (a *MockAuditor) AuditDeploy(record DeployAuditRecord) error {
+	a.records = append(a.records, record)
+	return a.err
+}
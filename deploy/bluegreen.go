@@ -0,0 +1,243 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BlueGreen describes a pair of deployments, one per color, behind a single Service.
+// The Service selects the live color through a label in its selector, e.g. `color: blue`.
+type BlueGreen struct {
+	Service string
+	// Label is the selector label holding the color. Defaults to `color`.
+	Label string
+	Blue  *KubernetesDeployer
+	Green *KubernetesDeployer
+	// Warm is how long the previous color keeps running after cutover, ready for an instant rollback.
+	Warm time.Duration
+	// Timeout and Interval control waiting for the idle color to become available. They default to 10 minutes and 5 seconds.
+	Timeout  time.Duration
+	Interval time.Duration
+
+	// scaleDown is the pending scale-down of the previous color, while it is kept warm
+	mutex     sync.Mutex
+	scaleDown *time.Timer
+}
+
+// DeployBlueGreen deploys the container to the idle color, waits until it is fully available,
+// then switches the Service over to it. If the idle color never becomes available the Service is left alone.
+// Policies, hooks and the Auditor apply as they do to Deploy.
+//
+// Without Warm, the previous color is scaled to zero before DeployBlueGreen returns. Otherwise it is scaled
+// to zero in the background once Warm has passed, unless the Service has been switched back to it by then.
+// RollbackBlueGreen, another DeployBlueGreen or CancelScaleDown cancels the pending scale-down.
+func (n *KubernetesClusterNamespace) DeployBlueGreen(bg *BlueGreen, containerTag string) error {
+	bg.CancelScaleDown()
+	live, idle, err := n.blueGreenColors(bg)
+	if err != nil {
+		return err
+	}
+
+	target := &blueGreenTarget{cluster: n, bg: bg, idleColor: idle, live: bg.deployer(live), idle: bg.deployer(idle), service: n.ServiceClient}
+	req := DeployRequest{
+		Tag:   containerTag,
+		Image: target.idle.ImageName(containerTag),
+		Time:  time.Now(),
+	}
+	err = n.runDeployTo(target, req, func(deployer Deployer) error {
+		return deployer.Deploy(containerTag)
+	})
+	if err != nil {
+		return err
+	}
+
+	if bg.Warm <= 0 {
+		return n.scaleDownIdle(bg, live)
+	}
+	n.scheduleScaleDown(bg, live)
+	return nil
+}
+
+// RollbackBlueGreen switches the Service back to the previous color, scaling it up again if it
+// has already been scaled down. The color that was live keeps running.
+func (n *KubernetesClusterNamespace) RollbackBlueGreen(bg *BlueGreen) error {
+	bg.CancelScaleDown()
+	live, idle, err := n.blueGreenColors(bg)
+	if err != nil {
+		return err
+	}
+
+	liveDeployment, err := bg.deployer(live).Get()
+	if err != nil {
+		return err
+	}
+
+	record := n.newAuditRecord(AuditActionRollback, DeployRequest{Time: time.Now()}, bg.deployer(idle))
+	// the record was started with the idle color's image, which is what the Service goes back to
+	record.NewImage = record.OldImage
+	record.OldImage = liveDeployment.ContainerImage(bg.deployer(live).ContainerName)
+
+	return n.audit(record, func() error {
+		return n.switchColor(bg, n.ServiceClient, idle, bg.deployer(idle), liveDeployment.DesiredReplicas())
+	})
+}
+
+// CancelScaleDown stops the pending scale-down of the previous color, which then keeps running
+func (bg *BlueGreen) CancelScaleDown() {
+	bg.mutex.Lock()
+	defer bg.mutex.Unlock()
+
+	if bg.scaleDown != nil {
+		bg.scaleDown.Stop()
+		bg.scaleDown = nil
+	}
+}
+
+// scheduleScaleDown scales color to zero once Warm has passed, unless it is cancelled first
+func (n *KubernetesClusterNamespace) scheduleScaleDown(bg *BlueGreen, color string) {
+	bg.mutex.Lock()
+	defer bg.mutex.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(bg.Warm, func() {
+		bg.mutex.Lock()
+		defer bg.mutex.Unlock()
+		if bg.scaleDown != timer {
+			return
+		}
+		bg.scaleDown = nil
+
+		err := n.scaleDownIdle(bg, color)
+		if err != nil {
+			n.log(LevelError, "blue/green scale down failed", "environment", n.Description,
+				"service", bg.Service, "color", color, "error", err.Error())
+		}
+	})
+	bg.scaleDown = timer
+}
+
+// scaleDownIdle scales color to zero, after reading the Service selector again to check it is still idle
+func (n *KubernetesClusterNamespace) scaleDownIdle(bg *BlueGreen, color string) error {
+	_, idle, err := n.blueGreenColors(bg)
+	if err != nil {
+		return err
+	}
+	if idle != color {
+		n.log(LevelInfo, "blue/green scale down skipped, color is live again", "environment", n.Description,
+			"service", bg.Service, "color", color)
+		return nil
+	}
+	return bg.deployer(color).Scale(0)
+}
+
+// switchColor scales a color up, waits for it to be available, and points the Service at it through service
+func (n *KubernetesClusterNamespace) switchColor(bg *BlueGreen, service ServiceSelector, color string, deployer *KubernetesDeployer, replicas int) error {
+	err := deployer.Scale(replicas)
+	if err != nil {
+		return err
+	}
+
+	timeout, interval := bg.Timeout, bg.Interval
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	_, err = deployer.WaitForRollout(timeout, interval)
+	if err != nil {
+		return err
+	}
+
+	return service.SetSelector(bg.Service, map[string]string{bg.label(): color})
+}
+
+// blueGreenColors reads which color the Service currently selects
+func (n *KubernetesClusterNamespace) blueGreenColors(bg *BlueGreen) (live string, idle string, err error) {
+	if n.ServiceClient == nil {
+		return "", "", fmt.Errorf("missing ServiceClient")
+	}
+	if bg.Blue == nil || bg.Green == nil {
+		return "", "", fmt.Errorf("missing Blue or Green deployment")
+	}
+
+	selector, err := n.ServiceClient.Selector(bg.Service)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch selector[bg.label()] {
+	case "blue":
+		return "blue", "green", nil
+	case "green":
+		return "green", "blue", nil
+	}
+	return "", "", fmt.Errorf("service %s does not select blue or green with label %q", bg.Service, bg.label())
+}
+
+// label is the selector label holding the color
+func (bg *BlueGreen) label() string {
+	if bg.Label == "" {
+		return "color"
+	}
+	return bg.Label
+}
+
+// deployer for the color
+func (bg *BlueGreen) deployer(color string) *KubernetesDeployer {
+	if color == "blue" {
+		return bg.Blue
+	}
+	return bg.Green
+}
+
+// blueGreenTarget is what a blue/green deploy runs its hooks around. Deploying it deploys to the idle color
+// and switches the Service over. It is audited as the idle deployment, replacing the live color's image.
+type blueGreenTarget struct {
+	cluster   *KubernetesClusterNamespace
+	bg        *BlueGreen
+	idleColor string
+	live      *KubernetesDeployer
+	idle      *KubernetesDeployer
+	service   ServiceSelector
+}
+
+// Deploy the container to the idle color, scaled to match the live one, and switch the Service to it
+func (t *blueGreenTarget) Deploy(containerTag string) error {
+	liveDeployment, err := t.live.Get()
+	if err != nil {
+		return err
+	}
+
+	err = t.idle.Deploy(containerTag)
+	if err != nil {
+		return err
+	}
+	return t.cluster.switchColor(t.bg, t.service, t.idleColor, t.idle, liveDeployment.DesiredReplicas())
+}
+
+// WithContext binds both colors and the ServiceClient to ctx
+func (t *blueGreenTarget) WithContext(ctx context.Context) Deployer {
+	bound := *t
+	bound.live = t.live.WithContext(ctx).(*KubernetesDeployer)
+	bound.idle = t.idle.WithContext(ctx).(*KubernetesDeployer)
+	bound.service = serviceWithContext(t.service, ctx)
+	return &bound
+}
+
+// WaitForRollout waits for the idle color, so rollout hooks run once it is serving
+func (t *blueGreenTarget) WaitForRollout(timeout time.Duration, interval time.Duration) (*Deployment, error) {
+	return t.idle.WaitForRollout(timeout, interval)
+}
+
+// Location is the idle deployment, which the deploy changes
+func (t *blueGreenTarget) Location() (string, string) {
+	return t.idle.Location()
+}
+
+// CurrentImage is the image of the live color, which the deploy replaces
+func (t *blueGreenTarget) CurrentImage() (string, error) {
+	return t.live.CurrentImage()
+}
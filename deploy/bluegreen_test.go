@@ -0,0 +1,275 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployBlueGreen(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	err := namespace.DeployBlueGreen(bg, "abc123")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "green", cluster.selector["color"])
+	assert.Equal(t, "app", cluster.selector["app"])
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:abc123", cluster.images["myapp-green"])
+	assert.Equal(t, 3, cluster.replicas["myapp-green"])
+	assert.Equal(t, 0, cluster.replicas["myapp-blue"])
+}
+
+func TestBlueGreenWithoutTimeout(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	bg.Timeout = 0
+	err := namespace.DeployBlueGreen(bg, "abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, "green", cluster.selectedColor())
+
+	err = namespace.RollbackBlueGreen(bg)
+	assert.Nil(t, err)
+	assert.Equal(t, "blue", cluster.selectedColor())
+}
+
+func TestDeployBlueGreenLeavesServiceWhenIdleColorUnavailable(t *testing.T) {
+	cluster := newMockBlueGreenCluster("green")
+	cluster.unavailable = "myapp-blue"
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	err := namespace.DeployBlueGreen(bg, "abc123")
+
+	assert.EqualError(t, err, "timed out waiting for rollout of myapp-blue")
+	assert.Equal(t, "green", cluster.selector["color"])
+	assert.Equal(t, 3, cluster.replicas["myapp-green"])
+}
+
+func TestRollbackBlueGreen(t *testing.T) {
+	cluster := newMockBlueGreenCluster("green")
+	cluster.replicas["myapp-blue"] = 0
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	err := namespace.RollbackBlueGreen(bg)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "blue", cluster.selector["color"])
+	assert.Equal(t, 3, cluster.replicas["myapp-blue"])
+	assert.Equal(t, 3, cluster.replicas["myapp-green"])
+}
+
+func TestDeployBlueGreenScalesDownAfterWarm(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	bg.Warm = 5 * time.Millisecond
+	err := namespace.DeployBlueGreen(bg, "abc123")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, cluster.replicasOf("myapp-blue"))
+	for cluster.replicasOf("myapp-blue") != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "green", cluster.selectedColor())
+}
+
+func TestRollbackBlueGreenCancelsScaleDown(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	bg.Warm = 20 * time.Millisecond
+	assert.Nil(t, namespace.DeployBlueGreen(bg, "abc123"))
+	assert.Nil(t, namespace.RollbackBlueGreen(bg))
+
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, "blue", cluster.selectedColor())
+	assert.Equal(t, 3, cluster.replicasOf("myapp-blue"))
+	assert.Equal(t, 3, cluster.replicasOf("myapp-green"))
+}
+
+func TestBlueGreenScaleDownSkipsLiveColor(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	assert.Nil(t, namespace.scaleDownIdle(bg, "blue"))
+	assert.Equal(t, 3, cluster.replicasOf("myapp-blue"))
+
+	assert.Nil(t, namespace.scaleDownIdle(bg, "green"))
+	assert.Equal(t, 0, cluster.replicasOf("myapp-green"))
+}
+
+func TestDeployBlueGreenRunsHooks(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	stages := []string{}
+	namespace.Hooks.BeforePatch = []DeployHook{func(ctx *DeployContext) error {
+		stages = append(stages, "before "+ctx.Request.Image)
+		return nil
+	}}
+	namespace.Hooks.AfterRolloutSuccess = []DeployHook{func(ctx *DeployContext) error {
+		stages = append(stages, "after "+ctx.Deployment.Metadata.Name+" "+cluster.selectedColor())
+		return nil
+	}}
+	namespace.Hooks.RolloutInterval = time.Millisecond
+
+	assert.Nil(t, namespace.DeployBlueGreen(bg, "abc123"))
+	assert.Equal(t, []string{"before artifactory.myorg.com:5010/myapp-docker-image:abc123", "after myapp-green green"}, stages)
+}
+
+func TestDeployBlueGreenAbortedByHook(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	namespace.Hooks.BeforePatch = []DeployHook{func(ctx *DeployContext) error {
+		return fmt.Errorf("migration failed")
+	}}
+
+	err := namespace.DeployBlueGreen(bg, "abc123")
+	assert.EqualError(t, err, "deploy aborted by hook: migration failed")
+	assert.Equal(t, "blue", cluster.selectedColor())
+	assert.Equal(t, "", cluster.images["myapp-green"])
+	assert.Equal(t, 3, cluster.replicasOf("myapp-blue"))
+}
+
+func TestDeployBlueGreenUnknownColor(t *testing.T) {
+	cluster := newMockBlueGreenCluster("purple")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	namespace, bg := mockBlueGreen(server)
+	err := namespace.DeployBlueGreen(bg, "abc123")
+	assert.EqualError(t, err, `service myapp does not select blue or green with label "color"`)
+}
+
+func TestDeployBlueGreenWhenMissingServiceClient(t *testing.T) {
+	namespace := &KubernetesClusterNamespace{}
+	err := namespace.DeployBlueGreen(&BlueGreen{}, "abc123")
+	assert.EqualError(t, err, "missing ServiceClient")
+}
+
+//
+// MOCK DATA
+//
+
+// MockBlueGreenCluster serves a Service and a Deployment per color. Deployments are
+// immediately available unless named by unavailable.
+type MockBlueGreenCluster struct {
+	mutex       sync.Mutex
+	selector    map[string]string
+	replicas    map[string]int
+	images      map[string]string
+	unavailable string
+}
+
+func newMockBlueGreenCluster(color string) *MockBlueGreenCluster {
+	return &MockBlueGreenCluster{
+		selector: map[string]string{"app": "app", "color": color},
+		replicas: map[string]int{"myapp-blue": 3, "myapp-green": 3},
+		images:   map[string]string{},
+	}
+}
+
+func (c *MockBlueGreenCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	parts := strings.Split(r.URL.Path, "/")
+	name := parts[len(parts)-1]
+	raw, _ := ioutil.ReadAll(r.Body)
+
+	if strings.Contains(r.URL.Path, "/services/") {
+		if r.Method == http.MethodPatch {
+			patch := &serviceSelector{}
+			json.Unmarshal(raw, patch)
+			for key, value := range patch.Spec.Selector {
+				c.selector[key] = value
+			}
+		}
+		service := &serviceSelector{}
+		service.Spec.Selector = c.selector
+		json.NewEncoder(w).Encode(service)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		patch := &deploymentPatch{}
+		json.Unmarshal(raw, patch)
+		if patch.Spec.Replicas != nil {
+			c.replicas[name] = *patch.Spec.Replicas
+		}
+		for _, container := range patch.Spec.Template.Spec.Containers {
+			c.images[name] = container.Image
+		}
+	}
+
+	replicas := c.replicas[name]
+	available := replicas
+	if name == c.unavailable {
+		available = 0
+	}
+	fmt.Fprintf(w, `{"metadata":{"name":%q,"generation":2},"spec":{"replicas":%d,"template":{"spec":{"containers":[{"name":"myapp-container","image":%q}]}}},"status":{"observedGeneration":2,"replicas":%d,"updatedReplicas":%d,"availableReplicas":%d}}`,
+		name, replicas, c.images[name], replicas, replicas, available)
+}
+
+func (c *MockBlueGreenCluster) replicasOf(name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.replicas[name]
+}
+
+func (c *MockBlueGreenCluster) selectedColor() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.selector["color"]
+}
+
+func mockBlueGreen(server *httptest.Server) (*KubernetesClusterNamespace, *BlueGreen) {
+	blue := mockKubernetesDeployer(server)
+	blue.DeploymentName = "myapp-blue"
+	green := mockKubernetesDeployer(server)
+	green.DeploymentName = "myapp-green"
+
+	namespace := &KubernetesClusterNamespace{
+		ServiceClient: &KubernetesServiceClient{
+			Client:             server.Client(),
+			Endpoint:           blue.Endpoint,
+			Namespace:          blue.Namespace,
+			BearerTokenService: &MockBearerToken{},
+		},
+	}
+	return namespace, &BlueGreen{
+		Service:  "myapp",
+		Blue:     blue,
+		Green:    green,
+		Timeout:  5 * time.Millisecond,
+		Interval: time.Millisecond,
+	}
+}
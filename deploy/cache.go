@@ -0,0 +1,599 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of object kept by a NamespaceCache
+const (
+	KindPod        = "Pod"
+	KindReplicaSet = "ReplicaSet"
+	KindDeployment = "Deployment"
+)
+
+// Types of CacheEvent. Resyncs hand every object to the handlers again, changed or not.
+const (
+	CacheAdded    = "ADDED"
+	CacheModified = "MODIFIED"
+	CacheDeleted  = "DELETED"
+	CacheResync   = "RESYNC"
+)
+
+// cacheRetryDelay is how long a NamespaceCache waits before listing again after a failure
+var cacheRetryDelay = time.Second
+
+// CacheEvent is a change to an object in a NamespaceCache. Object is a PodMetadataContainer
+// or a *Deployment, and nil for ReplicaSets, which are only read as Revisions.
+type CacheEvent struct {
+	Type   string
+	Kind   string
+	Name   string
+	Object interface{}
+}
+
+// CacheEventHandler is called for each change to the cache, from the goroutine keeping that kind of object up to date.
+type CacheEventHandler func(event CacheEvent)
+
+// NamespaceCache keeps the pods, ReplicaSets and Deployments of a namespace in memory, listing each
+// once and then following the watch API, so that many readers cost no more API calls than one.
+// Set it as the Cache of a KubernetesClusterNamespace to read pods, deployments and history from it.
+//
+//	cache := &deploy.NamespaceCache{Client: client, Endpoint: endpoint, Namespace: namespace, BearerTokenService: tokens}
+//	go cache.Run(stop)
+//	cache.WaitForSync(stop)
+type NamespaceCache struct {
+	Client             *http.Client
+	Endpoint           string
+	Namespace          string
+	BearerTokenService BearerTokenRetriever
+	// ResyncPeriod is how often every object is handed to the handlers again. Zero never resyncs.
+	ResyncPeriod time.Duration
+	// ErrorHandler is told when listing or watching fails. The cache carries on, listing again shortly after.
+	ErrorHandler func(kind string, err error)
+
+	mutex    sync.RWMutex
+	handlers []CacheEventHandler
+	objects  map[string]map[string]interface{}
+	// podsByTag and podsByReplicaSet index pod names
+	podsByTag        map[string]map[string]bool
+	podsByReplicaSet map[string]map[string]bool
+	synced           map[string]bool
+	syncedOnce       sync.Once
+	syncedAll        chan struct{}
+}
+
+// cachedResource describes how to list and watch one kind of object
+type cachedResource struct {
+	kind string
+	path string
+	// decode parses an object from the API
+	decode func(raw []byte) (interface{}, error)
+}
+
+// cachedObjectMeta is the metadata every object has
+type cachedObjectMeta struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+}
+
+// AddEventHandler registers handler for every later change. Add handlers before Run to see the objects first listed.
+func (c *NamespaceCache) AddEventHandler(handler CacheEventHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// Run keeps the cache up to date until stop is closed
+func (c *NamespaceCache) Run(stop <-chan struct{}) {
+	c.init()
+
+	resources := []cachedResource{
+		{kind: KindPod, path: "/api/v1/namespaces/%s/pods", decode: func(raw []byte) (interface{}, error) {
+			pod := PodMetadataContainer{}
+			err := json.Unmarshal(raw, &pod)
+			return pod, err
+		}},
+		{kind: KindReplicaSet, path: "/apis/extensions/v1beta1/namespaces/%s/replicasets", decode: func(raw []byte) (interface{}, error) {
+			replicaSet := replicaSet{}
+			err := json.Unmarshal(raw, &replicaSet)
+			return replicaSet, err
+		}},
+		{kind: KindDeployment, path: "/apis/extensions/v1beta1/namespaces/%s/deployments", decode: func(raw []byte) (interface{}, error) {
+			deployment := &Deployment{}
+			err := json.Unmarshal(raw, deployment)
+			return deployment, err
+		}},
+	}
+
+	wait := sync.WaitGroup{}
+	for _, resource := range resources {
+		wait.Add(1)
+		go func(resource cachedResource) {
+			defer wait.Done()
+			c.reflect(resource, stop)
+		}(resource)
+	}
+
+	if c.ResyncPeriod > 0 {
+		c.resyncEvery(c.ResyncPeriod, stop)
+	}
+	wait.Wait()
+}
+
+// resyncEvery resyncs the handlers every period until stop is closed
+func (c *NamespaceCache) resyncEvery(period time.Duration, stop <-chan struct{}) {
+	resync := time.NewTicker(period)
+	defer resync.Stop()
+	for {
+		select {
+		case <-resync.C:
+			c.resync()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// WaitForSync waits until every kind of object has been listed, returning false if stop is closed first
+func (c *NamespaceCache) WaitForSync(stop <-chan struct{}) bool {
+	c.init()
+	select {
+	case <-c.syncedAll:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Synced is true once every kind of object has been listed
+func (c *NamespaceCache) Synced() bool {
+	c.init()
+	select {
+	case <-c.syncedAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// PodInformation returns every cached pod, making NamespaceCache a PodListRetriever
+func (c *NamespaceCache) PodInformation() (*PodList, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := []string{}
+	for name := range c.objects[KindPod] {
+		names = append(names, name)
+	}
+	return c.podList(names), nil
+}
+
+// PodsOfDeployment returns the cached pods of the named deployment, found through their ReplicaSets
+func (c *NamespaceCache) PodsOfDeployment(deploymentName string) *PodList {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := []string{}
+	for replicaSetName, object := range c.objects[KindReplicaSet] {
+		replicaSet := object.(replicaSet)
+		if !replicaSet.ownedBy(deploymentName) {
+			continue
+		}
+		for name := range c.podsByReplicaSet[replicaSetName] {
+			names = append(names, name)
+		}
+	}
+	return c.podList(names)
+}
+
+// PodsWithTag returns the cached pods running the tag, e.g. to count how far a deploy has got
+func (c *NamespaceCache) PodsWithTag(tag string) *PodList {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := []string{}
+	for name := range c.podsByTag[tag] {
+		names = append(names, name)
+	}
+	return c.podList(names)
+}
+
+// Deployment returns the cached deployment, or false when there is no such deployment
+func (c *NamespaceCache) Deployment(deploymentName string) (*Deployment, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	object, ok := c.objects[KindDeployment][deploymentName]
+	if !ok {
+		return nil, false
+	}
+	deployment := *object.(*Deployment)
+	return &deployment, true
+}
+
+// Revisions lists the revisions of the named deployment from its cached ReplicaSets, newest first
+func (c *NamespaceCache) Revisions(deploymentName string, containerName string) []Revision {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	replicaSets := []replicaSet{}
+	for _, object := range c.objects[KindReplicaSet] {
+		replicaSets = append(replicaSets, object.(replicaSet))
+	}
+	return revisionsOf(replicaSets, deploymentName, containerName)
+}
+
+// podList gathers the named pods, sorted by name. The caller holds the lock.
+func (c *NamespaceCache) podList(names []string) *PodList {
+	sort.Strings(names)
+	podList := &PodList{Items: []PodMetadataContainer{}}
+	for _, name := range names {
+		podList.Items = append(podList.Items, c.objects[KindPod][name].(PodMetadataContainer))
+	}
+	return podList
+}
+
+func (c *NamespaceCache) init() {
+	c.syncedOnce.Do(func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.objects = map[string]map[string]interface{}{KindPod: {}, KindReplicaSet: {}, KindDeployment: {}}
+		c.podsByTag = map[string]map[string]bool{}
+		c.podsByReplicaSet = map[string]map[string]bool{}
+		c.synced = map[string]bool{}
+		c.syncedAll = make(chan struct{})
+	})
+}
+
+// reflect lists then watches one kind of object until stop is closed. The watch is reopened from where
+// it got to when it ends, and the objects are listed again when it has expired or failed. Watches that end
+// without a change are reopened after a growing delay, so a server closing them straight away is not hammered.
+func (c *NamespaceCache) reflect(resource cachedResource, stop <-chan struct{}) {
+	backoff := &watchBackoff{}
+	for {
+		resourceVersion, err := c.list(resource)
+		relist := false
+		for err == nil && !relist && !stopped(stop) {
+			from := resourceVersion
+			resourceVersion, relist, err = c.watch(resource, resourceVersion, stop)
+			if resourceVersion != from {
+				backoff.reset()
+			}
+			if err == nil && !backoff.wait(stop) {
+				return
+			}
+		}
+		if stopped(stop) {
+			return
+		}
+		if err == nil {
+			continue
+		}
+
+		if c.ErrorHandler != nil {
+			c.ErrorHandler(resource.kind, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(cacheRetryDelay):
+		}
+	}
+}
+
+// list replaces the cached objects of one kind, a page at a time, returning the resource version to watch from
+func (c *NamespaceCache) list(resource cachedResource) (string, error) {
+	objects := map[string]interface{}{}
+	continueToken := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(DefaultPodPageSize))
+		if continueToken != "" {
+			query.Set("continue", continueToken)
+		}
+		res, err := c.get(context.Background(), resource, query)
+		if err != nil {
+			return "", err
+		}
+
+		list := &struct {
+			Metadata ListMetadata      `json:"metadata"`
+			Items    []json.RawMessage `json:"items"`
+		}{}
+		err = json.NewDecoder(res.Body).Decode(list)
+		res.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		for _, raw := range list.Items {
+			meta := &cachedObjectMeta{}
+			json.Unmarshal(raw, meta)
+			object, err := resource.decode(raw)
+			if err != nil {
+				return "", err
+			}
+			objects[meta.Metadata.Name] = object
+		}
+
+		continueToken = list.Metadata.Continue
+		if continueToken == "" {
+			c.replace(resource.kind, objects)
+			return list.Metadata.ResourceVersion, nil
+		}
+	}
+}
+
+// watch applies changes made after resourceVersion, returning the resource version it got to when the
+// stream ends, and whether the watch has expired so the objects need listing again
+func (c *NamespaceCache) watch(resource cachedResource, resourceVersion string, stop <-chan struct{}) (string, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	res, err := c.get(ctx, resource, query)
+	if err != nil {
+		if stopped(stop) {
+			return resourceVersion, false, nil
+		}
+		return resourceVersion, false, err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		event := &watchEvent{}
+		if decoder.Decode(event) != nil {
+			// the stream ended, timed out or was cancelled
+			return resourceVersion, false, nil
+		}
+
+		if event.Type == "ERROR" {
+			status := &watchStatus{}
+			json.Unmarshal(event.Object, status)
+			if status.Code == http.StatusGone {
+				return resourceVersion, true, nil
+			}
+			return resourceVersion, false, fmt.Errorf("watch failed: %s", status.Message)
+		}
+
+		meta := &cachedObjectMeta{}
+		json.Unmarshal(event.Object, meta)
+		object, err := resource.decode(event.Object)
+		if err != nil {
+			return resourceVersion, false, err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			c.set(resource.kind, meta.Metadata.Name, object)
+		case "DELETED":
+			c.delete(resource.kind, meta.Metadata.Name)
+		}
+		resourceVersion = meta.Metadata.ResourceVersion
+	}
+}
+
+// get sends a GET for resource, failing unless it succeeds
+func (c *NamespaceCache) get(ctx context.Context, resource cachedResource, query url.Values) (*http.Response, error) {
+	if c.Endpoint == "" || c.Namespace == "" {
+		return nil, fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	resourceURL := fmt.Sprintf("https://%s"+resource.path+"?%s", c.Endpoint, c.Namespace, query.Encode())
+	req, err := http.NewRequest(http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sendWithToken(ctx, c.Client, c.BearerTokenService, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		err := newAPIError(res, c.Namespace)
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// replace swaps the cached objects of one kind for a fresh list, telling the handlers what changed
+func (c *NamespaceCache) replace(kind string, objects map[string]interface{}) {
+	c.mutex.Lock()
+	events := []CacheEvent{}
+	for name := range c.objects[kind] {
+		if _, ok := objects[name]; !ok {
+			c.remove(kind, name)
+			events = append(events, CacheEvent{Type: CacheDeleted, Kind: kind, Name: name})
+		}
+	}
+	for name, object := range objects {
+		events = append(events, c.store(kind, name, object))
+	}
+	c.synced[kind] = true
+	if len(c.synced) == 3 {
+		select {
+		case <-c.syncedAll:
+		default:
+			close(c.syncedAll)
+		}
+	}
+	c.mutex.Unlock()
+
+	c.dispatch(events...)
+}
+
+// set caches an object that was added or modified, telling the handlers
+func (c *NamespaceCache) set(kind string, name string, object interface{}) {
+	c.mutex.Lock()
+	event := c.store(kind, name, object)
+	c.mutex.Unlock()
+
+	c.dispatch(event)
+}
+
+// delete removes an object from the cache, telling the handlers
+func (c *NamespaceCache) delete(kind string, name string) {
+	c.mutex.Lock()
+	c.remove(kind, name)
+	c.mutex.Unlock()
+
+	c.dispatch(CacheEvent{Type: CacheDeleted, Kind: kind, Name: name})
+}
+
+// resync tells the handlers about every object again
+func (c *NamespaceCache) resync() {
+	c.mutex.RLock()
+	events := []CacheEvent{}
+	for _, kind := range []string{KindPod, KindReplicaSet, KindDeployment} {
+		for name, object := range c.objects[kind] {
+			events = append(events, CacheEvent{Type: CacheResync, Kind: kind, Name: name, Object: eventObject(object)})
+		}
+	}
+	c.mutex.RUnlock()
+
+	c.dispatch(events...)
+}
+
+// store caches an object and indexes it. The caller holds the lock.
+func (c *NamespaceCache) store(kind string, name string, object interface{}) CacheEvent {
+	event := CacheEvent{Type: CacheAdded, Kind: kind, Name: name, Object: eventObject(object)}
+	if _, ok := c.objects[kind][name]; ok {
+		c.remove(kind, name)
+		event.Type = CacheModified
+	}
+
+	c.objects[kind][name] = object
+	if pod, ok := object.(PodMetadataContainer); ok {
+		addToIndex(c.podsByTag, podTag(pod), name)
+		addToIndex(c.podsByReplicaSet, podReplicaSet(pod), name)
+	}
+	return event
+}
+
+// remove uncaches an object and drops it from the indexes. The caller holds the lock.
+func (c *NamespaceCache) remove(kind string, name string) {
+	object, ok := c.objects[kind][name]
+	if !ok {
+		return
+	}
+	delete(c.objects[kind], name)
+	if pod, ok := object.(PodMetadataContainer); ok {
+		removeFromIndex(c.podsByTag, podTag(pod), name)
+		removeFromIndex(c.podsByReplicaSet, podReplicaSet(pod), name)
+	}
+}
+
+func (c *NamespaceCache) dispatch(events ...CacheEvent) {
+	c.mutex.RLock()
+	handlers := c.handlers
+	c.mutex.RUnlock()
+
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// stopped is true once stop is closed
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// eventObject is the object handed to event handlers, copied so they cannot change the cache
+func eventObject(object interface{}) interface{} {
+	switch object := object.(type) {
+	case PodMetadataContainer:
+		return object
+	case *Deployment:
+		deployment := *object
+		return &deployment
+	}
+	return nil
+}
+
+// podTag is the image tag of the pod's first container
+func podTag(pod PodMetadataContainer) string {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return ""
+	}
+	return formatPodImage(pod.Status.ContainerStatuses[0].Image)
+}
+
+// podReplicaSet is the name of the ReplicaSet that created the pod. Without an owner reference,
+// it is worked out from the pod name, which is the ReplicaSet name and a random suffix.
+func podReplicaSet(pod PodMetadataContainer) string {
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if owner.Kind == KindReplicaSet {
+			return owner.Name
+		}
+	}
+	if i := strings.LastIndex(pod.Metadata.Name, "-"); i > 0 {
+		return pod.Metadata.Name[:i]
+	}
+	return ""
+}
+
+func addToIndex(index map[string]map[string]bool, key string, name string) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = map[string]bool{}
+	}
+	index[key][name] = true
+}
+
+func removeFromIndex(index map[string]map[string]bool, key string, name string) {
+	delete(index[key], name)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// cached is true when the cluster namespace can read from its cache
+func (n *KubernetesClusterNamespace) cached() bool {
+	return n.Cache != nil && n.Cache.Synced()
+}
+
+// deploymentName is the name of the deployment, from the deployer when the cluster namespace has none
+func (n *KubernetesClusterNamespace) deploymentName() string {
+	if deployer, ok := n.DeployMaker.(*KubernetesDeployer); ok && n.DeploymentName == "" {
+		return deployer.DeploymentName
+	}
+	return n.DeploymentName
+}
+
+// containerName is the name of the deployed container, when the deployer knows it
+func (n *KubernetesClusterNamespace) containerName() string {
+	if deployer, ok := n.DeployMaker.(*KubernetesDeployer); ok {
+		return deployer.ContainerName
+	}
+	return ""
+}
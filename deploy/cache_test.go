@@ -0,0 +1,324 @@
+package deploy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceCacheSyncs(t *testing.T) {
+	cluster := newMockCacheCluster()
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	stop := make(chan struct{})
+	defer close(stop)
+	assert.False(t, cache.Synced())
+	go cache.Run(stop)
+
+	assert.True(t, cache.WaitForSync(stop))
+	assert.True(t, cache.Synced())
+
+	podList, err := cache.PodInformation()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"myapp-deployment-1-abcde", "myapp-deployment-2-fghij", "other-deployment-1-klmno"}, mockPodNames(podList.Items))
+	assert.Equal(t, []string{"myapp-deployment-1-abcde", "myapp-deployment-2-fghij"}, mockPodNames(cache.PodsOfDeployment("myapp-deployment").Items))
+	assert.Equal(t, []string{"myapp-deployment-2-fghij"}, mockPodNames(cache.PodsWithTag("ccc333").Items))
+	assert.Equal(t, 0, len(cache.PodsWithTag("zzz999").Items))
+
+	deployment, ok := cache.Deployment("myapp-deployment")
+	assert.True(t, ok)
+	assert.Equal(t, 2, deployment.Status.ReadyReplicas)
+	_, ok = cache.Deployment("missing")
+	assert.False(t, ok)
+
+	revisions := cache.Revisions("myapp-deployment", "myapp-container")
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, int64(2), revisions[0].Number)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ccc333", revisions[0].Image)
+
+	// the cache is only listed once, however often it is read
+	assert.Equal(t, 1, cluster.lists["pods"])
+}
+
+func TestNamespaceCacheFollowsWatch(t *testing.T) {
+	cluster := newMockCacheCluster()
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	events := make(chan CacheEvent, 100)
+	cache.AddEventHandler(func(event CacheEvent) {
+		if event.Kind == KindPod {
+			events <- event
+		}
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, CacheAdded, (<-events).Type)
+	}
+
+	cluster.send("pods", `{"type":"MODIFIED","object":`+mockCachePod("myapp-deployment-1-abcde", "ddd444", "11")+`}`)
+	event := <-events
+	assert.Equal(t, CacheModified, event.Type)
+	assert.Equal(t, "myapp-deployment-1-abcde", event.Name)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", event.Object.(PodMetadataContainer).Status.ContainerStatuses[0].Image)
+	assert.Equal(t, 0, len(cache.PodsWithTag("aaa111").Items))
+	assert.Equal(t, []string{"myapp-deployment-1-abcde"}, mockPodNames(cache.PodsWithTag("ddd444").Items))
+
+	cluster.send("pods", `{"type":"DELETED","object":`+mockCachePod("myapp-deployment-2-fghij", "ccc333", "12")+`}`)
+	event = <-events
+	assert.Equal(t, CacheDeleted, event.Type)
+	assert.Equal(t, []string{"myapp-deployment-1-abcde"}, mockPodNames(cache.PodsOfDeployment("myapp-deployment").Items))
+	assert.Equal(t, 0, len(cache.PodsWithTag("ccc333").Items))
+}
+
+func TestNamespaceCacheRelistsWhenWatchExpires(t *testing.T) {
+	cluster := newMockCacheCluster()
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	events := make(chan CacheEvent, 100)
+	cache.AddEventHandler(func(event CacheEvent) {
+		if event.Kind == KindPod {
+			events <- event
+		}
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+	for i := 0; i < 3; i++ {
+		<-events
+	}
+
+	// the pod disappears while the watch is expired, and is found missing when listed again
+	cluster.removePod("other-deployment-1-klmno")
+	cluster.send("pods", `{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}`)
+
+	event := <-events
+	assert.Equal(t, CacheDeleted, event.Type)
+	assert.Equal(t, "other-deployment-1-klmno", event.Name)
+	podList, _ := cache.PodInformation()
+	assert.Equal(t, 2, len(podList.Items))
+}
+
+func TestNamespaceCacheBacksOffClosedWatches(t *testing.T) {
+	cluster := newMockCacheCluster()
+	cluster.closeWatches = true
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	stop := make(chan struct{})
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+
+	// reopened once straight away, then only after watchRetryBaseDelay
+	assert.True(t, cluster.watchCount("pods") <= 2)
+}
+
+func TestNamespaceCacheResyncs(t *testing.T) {
+	server := httptest.NewTLSServer(newMockCacheCluster())
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	cache.ResyncPeriod = 5 * time.Millisecond
+	resyncs := make(chan CacheEvent, 100)
+	cache.AddEventHandler(func(event CacheEvent) {
+		if event.Type == CacheResync {
+			select {
+			case resyncs <- event:
+			default:
+			}
+		}
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+
+	kinds := map[string]bool{}
+	for len(kinds) < 3 {
+		kinds[(<-resyncs).Kind] = true
+	}
+	assert.Equal(t, map[string]bool{KindPod: true, KindReplicaSet: true, KindDeployment: true}, kinds)
+}
+
+func TestNamespaceCacheReportsErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	errors := make(chan error, 3)
+	cache.ErrorHandler = func(kind string, err error) {
+		errors <- fmt.Errorf("%s: %s", kind, err.Error())
+	}
+	stop := make(chan struct{})
+	go cache.Run(stop)
+
+	assert.Contains(t, (<-errors).Error(), ": received 403")
+	close(stop)
+	assert.False(t, cache.WaitForSync(stop))
+}
+
+func TestClusterNamespaceReadsFromCache(t *testing.T) {
+	server := httptest.NewTLSServer(newMockCacheCluster())
+	defer server.Close()
+
+	cache := mockNamespaceCache(server)
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+
+	// the deployer and pod retriever would fail, as they have no endpoint
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeploymentName: "myapp-deployment",
+		PodRetriever:   &KubernetesPodListRetriever{},
+		DeployMaker:    &KubernetesDeployer{ContainerName: "myapp-container"},
+		Cache:          cache,
+	}
+
+	podList, err := clusterNamespace.GetPodList()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(podList.Items))
+
+	overview, err := clusterNamespace.GetOverview()
+	assert.Nil(t, err)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ccc333", overview.Rollout.Image)
+	assert.Equal(t, 2, overview.Summary.Total)
+
+	revisions, err := clusterNamespace.History()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+
+	clusterNamespace.DeploymentName = "missing"
+	_, err = clusterNamespace.GetDeployment()
+	assert.EqualError(t, err, "deployment missing not found")
+}
+
+//
+// MOCK DATA
+//
+
+// MockCacheCluster lists pods, ReplicaSets and myapp-deployment at resourceVersion 10,
+// and streams the events given to send to the watch of each resource
+type MockCacheCluster struct {
+	mutex   sync.Mutex
+	pods    map[string]string
+	lists   map[string]int
+	watches map[string]chan string
+	// closeWatches ends every watch straight away, counting them in opened
+	closeWatches bool
+	opened       map[string]int
+}
+
+func newMockCacheCluster() *MockCacheCluster {
+	return &MockCacheCluster{
+		pods: map[string]string{
+			"myapp-deployment-1-abcde": mockCachePod("myapp-deployment-1-abcde", "aaa111", "8"),
+			"myapp-deployment-2-fghij": mockCachePod("myapp-deployment-2-fghij", "ccc333", "9"),
+			"other-deployment-1-klmno": mockCachePod("other-deployment-1-klmno", "bbb222", "10"),
+		},
+		lists:   map[string]int{},
+		opened:  map[string]int{},
+		watches: map[string]chan string{"pods": make(chan string, 10), "replicasets": make(chan string, 10), "deployments": make(chan string, 10)},
+	}
+}
+
+func (c *MockCacheCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if r.URL.Query().Get("watch") == "true" {
+		c.mutex.Lock()
+		c.opened[resource]++
+		closeWatches := c.closeWatches
+		c.mutex.Unlock()
+		w.(http.Flusher).Flush()
+		if closeWatches {
+			return
+		}
+		for {
+			select {
+			case event := <-c.watches[resource]:
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+				if strings.Contains(event, `"ERROR"`) {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lists[resource]++
+	items := []string{}
+	switch resource {
+	case "pods":
+		for _, pod := range c.pods {
+			items = append(items, pod)
+		}
+	case "replicasets":
+		items = []string{mockCacheReplicaSet(1, "aaa111"), mockCacheReplicaSet(2, "ccc333")}
+	case "deployments":
+		items = []string{`{"metadata":{"name":"myapp-deployment","resourceVersion":"7"},"spec":{"replicas":2,
+			"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}},
+			"status":{"replicas":2,"updatedReplicas":2,"readyReplicas":2,"availableReplicas":2}}`}
+	}
+	fmt.Fprintf(w, `{"metadata":{"resourceVersion":"10"},"items":[%s]}`, strings.Join(items, ","))
+}
+
+func (c *MockCacheCluster) send(resource string, event string) {
+	c.watches[resource] <- event
+}
+
+func (c *MockCacheCluster) watchCount(resource string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.opened[resource]
+}
+
+func (c *MockCacheCluster) removePod(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.pods, name)
+}
+
+func mockCachePod(name string, tag string, resourceVersion string) string {
+	return fmt.Sprintf(`{"metadata":{"name":%q,"resourceVersion":%q},"status":{"phase":"Running",
+		"containerStatuses":[{"image":"artifactory.myorg.com:5010/myapp-docker-image:%s","ready":true}]}}`, name, resourceVersion, tag)
+}
+
+func mockCacheReplicaSet(revision int, tag string) string {
+	return fmt.Sprintf(`{"metadata":{"name":"myapp-deployment-%d","annotations":{"deployment.kubernetes.io/revision":"%d"},
+		"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+		"spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:%s"}]}}}}`,
+		revision, revision, tag)
+}
+
+func mockNamespaceCache(server *httptest.Server) *NamespaceCache {
+	return &NamespaceCache{
+		Client:             server.Client(),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		BearerTokenService: &MockBearerToken{},
+	}
+}
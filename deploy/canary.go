@@ -0,0 +1,146 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Waiting reasons that mean a pod will not become healthy without intervention
+var unhealthyReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// KubernetesCanary deploys a new tag to a canary deployment running alongside the primary one,
+// and only deploys to the primary once the canary pods have stayed healthy.
+//
+// The canary deployment must already exist and share the primary's Service selector, so that
+// traffic is split roughly by replica count. It is scaled to zero when not in use.
+type KubernetesCanary struct {
+	Canary       *KubernetesDeployer
+	Primary      Deployer
+	PodRetriever PodListRetriever
+	// Steps are the canary replica counts, e.g. 1, 2, 4. Each is held for Hold.
+	Steps []int
+	Hold  time.Duration
+	// Interval is how often canary pods are checked while holding. Defaults to 5 seconds.
+	Interval time.Duration
+	// MaxRestarts is how many container restarts a canary pod may have before the canary fails.
+	MaxRestarts int
+}
+
+// Deploy the container to the canary a step at a time, then to the primary.
+// When a canary pod is unhealthy the canary is scaled to zero and the primary is left alone.
+// The canary is scaled to zero too when deploying to the primary fails.
+func (c *KubernetesCanary) Deploy(containerTag string) error {
+	if c.Canary == nil || c.Primary == nil || c.PodRetriever == nil {
+		return fmt.Errorf("missing Canary, Primary or PodRetriever")
+	}
+	if len(c.Steps) == 0 {
+		return fmt.Errorf("missing canary Steps")
+	}
+
+	err := c.Canary.Deploy(containerTag)
+	if err != nil {
+		return err
+	}
+
+	for _, replicas := range c.Steps {
+		err = c.Canary.Scale(replicas)
+		if err == nil {
+			err = c.hold(containerTag, replicas)
+		}
+		if err != nil {
+			return c.scaleDown(fmt.Errorf("canary failed at %d replicas: %s", replicas, err.Error()))
+		}
+	}
+
+	err = c.Primary.Deploy(containerTag)
+	if err != nil {
+		return c.scaleDown(err)
+	}
+	return c.Canary.Scale(0)
+}
+
+// WithContext returns a copy of the canary making the API calls of both deployments and of its
+// PodRetriever within ctx, so they are traced as children of the span ctx carries.
+func (c *KubernetesCanary) WithContext(ctx context.Context) Deployer {
+	bound := *c
+	if c.Canary != nil {
+		bound.Canary = c.Canary.WithContext(ctx).(*KubernetesDeployer)
+	}
+	bound.Primary = withContext(c.Primary, ctx)
+	bound.PodRetriever = podListWithContext(c.PodRetriever, ctx)
+	return &bound
+}
+
+// scaleDown scales the canary to zero after err, so no pods are left running a tag that failed,
+// and returns err along with any error scaling down
+func (c *KubernetesCanary) scaleDown(err error) error {
+	scaleErr := c.Canary.Scale(0)
+	if scaleErr != nil {
+		return fmt.Errorf("%s; scaling canary to 0 also failed: %s", err.Error(), scaleErr.Error())
+	}
+	return err
+}
+
+// hold checks the canary pods until Hold has passed. Pods may still be starting
+// during the hold, but must all be ready by the end of it.
+func (c *KubernetesCanary) hold(containerTag string, replicas int) error {
+	interval := c.Interval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(c.Hold)
+
+	for {
+		pods, err := c.canaryPods(containerTag)
+		if err != nil {
+			return err
+		}
+
+		for _, pod := range pods {
+			if pod.Restarts > c.MaxRestarts {
+				return fmt.Errorf("pod %s restarted %d times", pod.Name, pod.Restarts)
+			}
+			if unhealthyReasons[pod.Reason] {
+				return fmt.Errorf("pod %s is waiting with %s", pod.Name, pod.Reason)
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			ready := 0
+			for _, pod := range pods {
+				if pod.Ready {
+					ready++
+				}
+			}
+			if ready < replicas {
+				return fmt.Errorf("only %d of %d pods ready", ready, replicas)
+			}
+			return nil
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// canaryPods lists the canary deployment's pods running containerTag
+func (c *KubernetesCanary) canaryPods(containerTag string) ([]PodItem, error) {
+	podList, err := c.PodRetriever.PodInformation()
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []PodItem{}
+	for _, pod := range podList.PodsOfDeployment(c.Canary.DeploymentName).Overview() {
+		if pod.Tag == containerTag {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
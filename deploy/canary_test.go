@@ -0,0 +1,152 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanaryPromotesHealthyTag(t *testing.T) {
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{ready: true})
+	err := canary.Deploy("abc123")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abc123"}, primary.deployed)
+	assert.Equal(t, 4, len(*patches))
+	assert.Contains(t, (*patches)[0], "myapp-docker-image:abc123")
+	assert.Contains(t, (*patches)[1], `"replicas":1`)
+	assert.Contains(t, (*patches)[2], `"replicas":2`)
+	assert.Contains(t, (*patches)[3], `"replicas":0`)
+}
+
+func TestCanaryFailsOnRestarts(t *testing.T) {
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{ready: true, restarts: 3})
+	err := canary.Deploy("abc123")
+
+	assert.EqualError(t, err, "canary failed at 1 replicas: pod myapp-canary-1-a restarted 3 times")
+	assert.Equal(t, 0, len(primary.deployed))
+	assert.Contains(t, (*patches)[len(*patches)-1], `"replicas":0`)
+}
+
+func TestCanaryFailsOnImagePullBackOff(t *testing.T) {
+	server, _ := mockPatchServer()
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{reason: "ImagePullBackOff"})
+	err := canary.Deploy("abc123")
+
+	assert.EqualError(t, err, "canary failed at 1 replicas: pod myapp-canary-1-a is waiting with ImagePullBackOff")
+	assert.Equal(t, 0, len(primary.deployed))
+}
+
+func TestCanaryFailsWhenPodsNeverReady(t *testing.T) {
+	server, _ := mockPatchServer()
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{})
+	err := canary.Deploy("abc123")
+
+	assert.EqualError(t, err, "canary failed at 1 replicas: only 0 of 1 pods ready")
+	assert.Equal(t, 0, len(primary.deployed))
+}
+
+func TestCanaryScalesDownWhenPrimaryFails(t *testing.T) {
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{ready: true})
+	primary.err = fmt.Errorf("received 500")
+	err := canary.Deploy("abc123")
+
+	assert.EqualError(t, err, "received 500")
+	assert.Equal(t, 4, len(*patches))
+	assert.Contains(t, (*patches)[3], `"replicas":0`)
+}
+
+func TestCanaryReportsFailureToScaleDown(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(raw), `"replicas":0`) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	canary, primary := mockCanary(server, &MockCanaryPods{ready: true})
+	primary.err = fmt.Errorf("received 500")
+	err := canary.Deploy("abc123")
+
+	assert.Contains(t, err.Error(), "received 500; scaling canary to 0 also failed: PATCH https://")
+	assert.Contains(t, err.Error(), ": received 409")
+}
+
+func TestCanaryWhenMissingParameters(t *testing.T) {
+	canary := &KubernetesCanary{}
+	assert.EqualError(t, canary.Deploy("abc123"), "missing Canary, Primary or PodRetriever")
+}
+
+//
+// MOCK DATA
+//
+
+type MockCanaryPods struct {
+	ready    bool
+	restarts int
+	reason   string
+}
+
+// PodInformation returns two canary pods alongside a primary pod
+func (p *MockCanaryPods) PodInformation() (*PodList, error) {
+	pod := mockRunningPod("myapp-canary-1-a", "artifactory.myorg.com:5010/myapp-docker-image:abc123")
+	pod.Status.ContainerStatuses[0].Ready = p.ready
+	pod.Status.ContainerStatuses[0].RestartCount = p.restarts
+	if p.reason != "" {
+		pod.Status.ContainerStatuses[0].State.Waiting = &PodContainerStatusesStateWaiting{Reason: p.reason}
+	}
+
+	primary := mockRunningPod("myapp-deployment-1-a", "artifactory.myorg.com:5010/myapp-docker-image:old")
+	other := mockRunningPod("myapp-canary-1-b", "artifactory.myorg.com:5010/myapp-docker-image:abc123")
+	other.Status.ContainerStatuses[0].Ready = p.ready
+
+	return &PodList{Items: []PodMetadataContainer{pod, other, primary}}, nil
+}
+
+func mockPatchServer() (*httptest.Server, *[]string) {
+	patches := &[]string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		*patches = append(*patches, string(raw))
+		w.Write([]byte(`{}`))
+	}))
+	return server, patches
+}
+
+func mockCanary(server *httptest.Server, pods PodListRetriever) (*KubernetesCanary, *MockDeployer) {
+	canaryDeployer := mockKubernetesDeployer(server)
+	canaryDeployer.DeploymentName = "myapp-canary"
+	primary := &MockDeployer{}
+
+	return &KubernetesCanary{
+		Canary:       canaryDeployer,
+		Primary:      primary,
+		PodRetriever: pods,
+		Steps:        []int{1, 2},
+		Hold:         5 * time.Millisecond,
+		Interval:     time.Millisecond,
+		MaxRestarts:  1,
+	}, primary
+}
@@ -2,13 +2,17 @@ package deploy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
-// KubernetesDeployer updates a deployment via Kubernetes API
+// KubernetesDeployer updates a deployment via Kubernetes API.
+// ImageVerifier is optional, and checks the image exists before the deployment is changed.
 type KubernetesDeployer struct {
 	Client             *http.Client
 	Endpoint           string
@@ -17,31 +21,167 @@ type KubernetesDeployer struct {
 	ContainerName      string
 	ContainerImage     string
 	BearerTokenService BearerTokenRetriever
+	ImageVerifier      ImageVerifier
+
+	// ctx is the context its API calls are made within, set by WithContext
+	ctx context.Context
+}
+
+// WithContext returns a copy of the deployer making its API calls within ctx,
+// so they are traced as children of the span ctx carries.
+func (d *KubernetesDeployer) WithContext(ctx context.Context) Deployer {
+	bound := *d
+	bound.ctx = ctx
+	return &bound
 }
 
 // Deploy a container via Kubernetes API
 func (d *KubernetesDeployer) Deploy(containerTag string) error {
+	return d.DeployImage(containerTag, nil)
+}
+
+// DeployImage deploys a container by tag, or by digest when given one like `sha256:056d...`,
+// and records annotations on the deployment.
+func (d *KubernetesDeployer) DeployImage(tagOrDigest string, annotations map[string]string) error {
+	if d.ImageVerifier != nil {
+		digest, err := d.ImageVerifier.VerifyImage(d.ContainerImage, tagOrDigest)
+		if err != nil {
+			return err
+		}
+		annotations = withAnnotation(annotations, ImageDigestAnnotation, digest)
+	}
+
+	patch := deploymentPatch{}
+	patch.Metadata.Annotations = annotations
+	patch.Spec.Template.Spec.Containers = []containerPatch{
+		{Name: d.ContainerName, Image: d.ImageName(tagOrDigest)},
+	}
+	return d.patch(patch)
+}
+
+// ImageName is the full image name that will be deployed for a tag or digest
+func (d *KubernetesDeployer) ImageName(tagOrDigest string) string {
+	return fullImageName(d.ContainerImage, tagOrDigest)
+}
+
+// fullImageName joins an image with a tag, or with a digest when given one
+func fullImageName(image string, tagOrDigest string) string {
+	if strings.HasPrefix(tagOrDigest, "sha256:") {
+		return fmt.Sprintf("%s@%s", image, tagOrDigest)
+	}
+	return fmt.Sprintf("%s:%s", image, tagOrDigest)
+}
+
+// Scale changes the number of replicas in the deployment
+func (d *KubernetesDeployer) Scale(replicas int) error {
+	patch := deploymentPatch{}
+	patch.Spec.Replicas = &replicas
+	return d.patch(patch)
+}
+
+// Get retrieves the deployment via Kubernetes API
+func (d *KubernetesDeployer) Get() (*Deployment, error) {
+	if d.Endpoint == "" || d.Namespace == "" {
+		return nil, fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, d.deploymentURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.send(d.context(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, newAPIError(res, d.Namespace)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &Deployment{}
+	err = json.Unmarshal([]byte(body), deployment)
+	if err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// WaitForRollout polls the deployment every interval until the rollout completes,
+// fails, or timeout passes.
+func (d *KubernetesDeployer) WaitForRollout(timeout time.Duration, interval time.Duration) (*Deployment, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		deployment, err := d.Get()
+		if err != nil {
+			return nil, err
+		}
+		if deployment.RolloutComplete() {
+			return deployment, nil
+		}
+		if deployment.RolloutFailed() {
+			return deployment, fmt.Errorf("rollout of %s exceeded its progress deadline", d.DeploymentName)
+		}
+		if !time.Now().Before(deadline) {
+			return deployment, fmt.Errorf("timed out waiting for rollout of %s", d.DeploymentName)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// Location is the namespace and name of the deployment
+func (d *KubernetesDeployer) Location() (string, string) {
+	return d.Namespace, d.DeploymentName
+}
+
+// CurrentImage is the image of the container in the deployment now
+func (d *KubernetesDeployer) CurrentImage() (string, error) {
+	deployment, err := d.Get()
+	if err != nil {
+		return "", err
+	}
+	return deployment.ContainerImage(d.ContainerName), nil
+}
+
+// deploymentURL is the Kubernetes API path of the deployment
+func (d *KubernetesDeployer) deploymentURL() string {
+	return fmt.Sprintf("https://%s/apis/extensions/v1beta1/namespaces/%s/deployments/%s", d.Endpoint, d.Namespace, d.DeploymentName)
+}
+
+// patch sends a strategic merge patch for the deployment
+func (d *KubernetesDeployer) patch(patch deploymentPatch) error {
 	if d.Endpoint == "" || d.Namespace == "" {
 		return fmt.Errorf("missing Endpoint or Namespace information")
 	}
 
-	url := fmt.Sprintf("https://%s/apis/extensions/v1beta1/namespaces/%s/deployments/%s", d.Endpoint, d.Namespace, d.DeploymentName)
-	image := fmt.Sprintf(`{"spec":{"template":{"spec":{"containers":[{"name":"%s","image":"%s:%s"}]}}}}`, d.ContainerName, d.ContainerImage, containerTag)
-	payload := bytes.NewBuffer([]byte(image))
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	payload := bytes.NewBuffer(raw)
 
-	req, err := http.NewRequest(http.MethodPatch, url, payload)
+	req, err := http.NewRequest(http.MethodPatch, d.deploymentURL(), payload)
 	if err != nil {
 		return err
 	}
 	req.Header.Add("Content-Type", "application/strategic-merge-patch+json")
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", d.BearerTokenService.RetrieveToken()))
-	res, err := d.Client.Do(req)
+	res, err := d.send(d.context(), req)
 	if err != nil {
 		return err
 	}
-
 	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newAPIError(res, d.Namespace)
+	}
+
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return err
@@ -55,6 +195,76 @@ func (d *KubernetesDeployer) Deploy(containerTag string) error {
 	return nil
 }
 
+// context is the context set by WithContext, defaulting to Background
+func (d *KubernetesDeployer) context() context.Context {
+	return boundContext(d.ctx)
+}
+
+// send retrieves a token within its own span, and sends the request within ctx
+func (d *KubernetesDeployer) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return sendWithToken(ctx, d.Client, d.BearerTokenService, req)
+}
+
+// sendWithToken retrieves a token within its own span, and sends the request with it within ctx.
+// Every Kubernetes client sends its API calls this way, so they are traced within the span ctx carries.
+func sendWithToken(ctx context.Context, client *http.Client, tokens BearerTokenRetriever, req *http.Request) (*http.Response, error) {
+	_, span := StartSpan(ctx, "token.retrieve")
+	token := tokens.RetrieveToken()
+	span.End()
+
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	return client.Do(req.WithContext(ctx))
+}
+
+// boundContext is the context a client was bound to with WithContext, defaulting to Background
+func boundContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// withAnnotation copies annotations and adds one more, skipping empty values
+func withAnnotation(annotations map[string]string, key string, value string) map[string]string {
+	if value == "" {
+		return annotations
+	}
+
+	result := map[string]string{}
+	for k, v := range annotations {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// deploymentPatch is the subset of a Deployment that KubernetesDeployer changes
+type deploymentPatch struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas,omitempty"`
+		Template struct {
+			Metadata *templateMetadataPatch `json:"metadata,omitempty"`
+			Spec     struct {
+				Containers []containerPatch `json:"containers,omitempty"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// templateMetadataPatch adds annotations to the pod template, which replaces every pod
+type templateMetadataPatch struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// containerPatch changes the image of the container with the same name
+type containerPatch struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
 // PodDeployResponse is part of the deployment response coming back from Kubernetes
 type PodDeployResponse struct {
 	Status PodDeployStatus `json:"status"`
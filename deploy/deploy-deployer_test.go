@@ -0,0 +1,93 @@
+package deploy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployerDeploy(t *testing.T) {
+	var method, path, contentType, authorization, body string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		authorization = r.Header.Get("Authorization")
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		w.Write([]byte(`{"status":{"availableReplicas":4}}`))
+	}))
+	defer server.Close()
+
+	deployer := mockKubernetesDeployer(server)
+	err := deployer.Deploy("40716241027b9639db1f1067d5ea3b25087dd12e")
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, "/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-deployment", path)
+	assert.Equal(t, "application/strategic-merge-patch+json", contentType)
+	assert.Equal(t, "Bearer token", authorization)
+	assert.JSONEq(t, `{"metadata":{},"spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:40716241027b9639db1f1067d5ea3b25087dd12e"}]}}}}`, body)
+}
+
+func TestDeployerDeployImageByDigest(t *testing.T) {
+	var body string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	deployer := mockKubernetesDeployer(server)
+	err := deployer.DeployImage("sha256:056d", map[string]string{"kubernetes-deploy/promoted-from": "staging"})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"metadata":{"annotations":{"kubernetes-deploy/promoted-from":"staging"}},"spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image@sha256:056d"}]}}}}`, body)
+}
+
+func TestDeployerWhenMissingParameters(t *testing.T) {
+	deployer := &KubernetesDeployer{}
+	assert.EqualError(t, deployer.Deploy("abc"), "missing Endpoint or Namespace information")
+}
+
+func TestDeployerWhenPatchIsRejected(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind":"Status","status":"Failure","reason":"NotFound"}`))
+	}))
+	defer server.Close()
+
+	deployer := mockKubernetesDeployer(server)
+	err := deployer.Deploy("abc")
+	assert.Contains(t, err.Error(), "/deployments/myapp-deployment in namespace myapp-development: received 404")
+	assert.Equal(t, http.StatusNotFound, err.(*APIError).StatusCode)
+	assert.Equal(t, http.MethodPatch, err.(*APIError).Method)
+
+	assert.Contains(t, deployer.Scale(2).Error(), ": received 404")
+}
+
+//
+// MOCK DATA
+//
+
+type MockBearerToken struct{}
+
+func (*MockBearerToken) RetrieveToken() string {
+	return "token"
+}
+
+func mockKubernetesDeployer(server *httptest.Server) *KubernetesDeployer {
+	return &KubernetesDeployer{
+		Client:             server.Client(),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		DeploymentName:     "myapp-deployment",
+		ContainerName:      "myapp-container",
+		ContainerImage:     "artifactory.myorg.com:5010/myapp-docker-image",
+		BearerTokenService: &MockBearerToken{},
+	}
+}
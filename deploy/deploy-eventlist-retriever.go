@@ -0,0 +1,63 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// KubernetesEventListRetriever retrieves events via Kubernetes API
+type KubernetesEventListRetriever struct {
+	Client             *http.Client
+	Endpoint           string
+	Namespace          string
+	BearerTokenService BearerTokenRetriever
+
+	// ctx is the context its API calls are made within, set by WithContext
+	ctx context.Context
+}
+
+// WithContext returns a copy of the retriever making its API calls within ctx,
+// so they are traced as children of the span ctx carries.
+func (e *KubernetesEventListRetriever) WithContext(ctx context.Context) EventListRetriever {
+	bound := *e
+	bound.ctx = ctx
+	return &bound
+}
+
+// EventInformation retrieved from Kubernetes API
+func (e *KubernetesEventListRetriever) EventInformation() (*EventList, error) {
+	if e.Endpoint == "" || e.Namespace == "" {
+		return nil, fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	url := fmt.Sprintf("https://%s/api/v1/namespaces/%s/events", e.Endpoint, e.Namespace)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sendWithToken(boundContext(e.ctx), e.Client, e.BearerTokenService, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, newAPIError(res, e.Namespace)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	eventList := &EventList{}
+	err = json.Unmarshal([]byte(body), eventList)
+	if err != nil {
+		return nil, err
+	}
+
+	return eventList, nil
+}
@@ -0,0 +1,312 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// JobLabel is put on every Job the runner creates, holding the runner's Name
+const JobLabel = "kubernetes-deploy/job"
+
+// KubernetesJobRunner runs a Job on the image about to be deployed, e.g. `rake db:migrate`, via Kubernetes API.
+type KubernetesJobRunner struct {
+	Client             *http.Client
+	Endpoint           string
+	Namespace          string
+	BearerTokenService BearerTokenRetriever
+	// Name prefixes the name of each Job, which also gets a timestamp and a random suffix.
+	Name string
+	// Template is a Job manifest in JSON. `{{.Image}}` and `{{.Tag}}` are replaced with the image being deployed,
+	// escaped to go inside a JSON string.
+	Template       string
+	ContainerImage string
+	// Timeout and Interval control waiting for the Job to finish. They default to 10 minutes and 5 seconds.
+	Timeout  time.Duration
+	Interval time.Duration
+	// Retention is how many finished Jobs to keep. Older ones are deleted along with their pods.
+	Retention int
+
+	// ctx is the context its API calls are made within, set by WithContext
+	ctx context.Context
+}
+
+// WithContext returns a copy of the runner making its API calls within ctx,
+// so they are traced as children of the span ctx carries.
+func (j *KubernetesJobRunner) WithContext(ctx context.Context) *KubernetesJobRunner {
+	bound := *j
+	bound.ctx = ctx
+	return &bound
+}
+
+// JobResult is the outcome of a Job and the logs of its pods.
+type JobResult struct {
+	Name      string
+	Succeeded bool
+	Logs      string
+}
+
+// BeforePatchHook runs the Job before each deploy, within the deploy's span, aborting the deploy when it fails
+func (j *KubernetesJobRunner) BeforePatchHook() DeployHook {
+	return func(ctx *DeployContext) error {
+		result, err := j.WithContext(boundContext(ctx.Context)).Run(ctx.Request.Tag)
+		if err != nil && result != nil && result.Logs != "" {
+			return fmt.Errorf("%s\n%s", err.Error(), lastLines(result.Logs, 20))
+		}
+		return err
+	}
+}
+
+// Run creates the Job for the container tag and waits for it to complete or fail
+func (j *KubernetesJobRunner) Run(containerTag string) (*JobResult, error) {
+	if j.Endpoint == "" || j.Namespace == "" {
+		return nil, fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	job, err := j.render(containerTag)
+	if err != nil {
+		return nil, err
+	}
+	name := job["metadata"].(map[string]interface{})["name"].(string)
+
+	err = j.do(http.MethodPost, "/apis/batch/v1/namespaces/%s/jobs", job, nil, j.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &JobResult{Name: name}
+	result.Succeeded, err = j.wait(name)
+	result.Logs, _ = j.logs(name)
+	if err == nil && !result.Succeeded {
+		err = fmt.Errorf("job %s failed", name)
+	}
+
+	j.cleanUp()
+	return result, err
+}
+
+// render fills in the template, names the Job and labels it
+func (j *KubernetesJobRunner) render(containerTag string) (map[string]interface{}, error) {
+	tmpl, err := template.New(j.Name).Parse(j.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &bytes.Buffer{}
+	err = tmpl.Execute(rendered, map[string]string{
+		"Image": jsonEscape(fullImageName(j.ContainerImage, containerTag)),
+		"Tag":   jsonEscape(containerTag),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job := map[string]interface{}{}
+	err = json.Unmarshal(rendered.Bytes(), &job)
+	if err != nil {
+		return nil, fmt.Errorf("job template is not valid JSON: %s", err.Error())
+	}
+
+	metadata, ok := job["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		job["metadata"] = metadata
+	}
+	labels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		labels = map[string]interface{}{}
+		metadata["labels"] = labels
+	}
+	suffix, err := randomSuffix()
+	if err != nil {
+		return nil, err
+	}
+	metadata["name"] = fmt.Sprintf("%s-%d-%s", j.Name, time.Now().Unix(), suffix)
+	labels[JobLabel] = j.Name
+	return job, nil
+}
+
+// jsonEscape escapes a value to be put inside a JSON string, so it cannot add fields to the manifest
+func jsonEscape(value string) string {
+	raw, _ := json.Marshal(value)
+	return string(raw[1 : len(raw)-1])
+}
+
+// randomSuffix tells apart Jobs created in the same second
+func randomSuffix() (string, error) {
+	raw := make([]byte, 3)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// wait polls the Job until it has a Complete or Failed condition
+func (j *KubernetesJobRunner) wait(name string) (bool, error) {
+	timeout, interval := j.Timeout, j.Interval
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		job := &kubernetesJob{}
+		err := j.do(http.MethodGet, "/apis/batch/v1/namespaces/%s/jobs/%s", nil, job, j.Namespace, name)
+		if err != nil {
+			return false, err
+		}
+
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != "True" {
+				continue
+			}
+			switch condition.Type {
+			case "Complete":
+				return true, nil
+			case "Failed":
+				return false, nil
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return false, fmt.Errorf("timed out waiting for job %s", name)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// logs collects the logs of every pod the Job ran
+func (j *KubernetesJobRunner) logs(name string) (string, error) {
+	podList := &PodList{}
+	err := j.do(http.MethodGet, "/api/v1/namespaces/%s/pods?labelSelector=%s", nil, podList, j.Namespace, url.QueryEscape("job-name="+name))
+	if err != nil {
+		return "", err
+	}
+
+	logs := []string{}
+	for _, pod := range podList.Items {
+		raw := &bytes.Buffer{}
+		err := j.do(http.MethodGet, "/api/v1/namespaces/%s/pods/%s/log", nil, raw, j.Namespace, pod.Metadata.Name)
+		if err != nil {
+			return strings.Join(logs, "\n"), err
+		}
+		logs = append(logs, raw.String())
+	}
+	return strings.Join(logs, "\n"), nil
+}
+
+// cleanUp deletes finished Jobs beyond Retention, oldest first
+func (j *KubernetesJobRunner) cleanUp() error {
+	jobList := &kubernetesJobList{}
+	err := j.do(http.MethodGet, "/apis/batch/v1/namespaces/%s/jobs?labelSelector=%s", nil, jobList, j.Namespace, url.QueryEscape(JobLabel+"="+j.Name))
+	if err != nil {
+		return err
+	}
+
+	finished := []kubernetesJob{}
+	for _, job := range jobList.Items {
+		if job.finished() {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].Metadata.CreationTimestamp.After(finished[b].Metadata.CreationTimestamp)
+	})
+
+	for i := j.Retention; i < len(finished); i++ {
+		err := j.do(http.MethodDelete, "/apis/batch/v1/namespaces/%s/jobs/%s?propagationPolicy=Background", nil, nil, j.Namespace, finished[i].Metadata.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a request to the Kubernetes API. Responses are decoded as JSON, or copied as they are into a *bytes.Buffer.
+func (j *KubernetesJobRunner) do(method string, path string, body interface{}, out interface{}, args ...interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewBuffer(raw)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("https://%s", j.Endpoint)+fmt.Sprintf(path, args...), payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	res, err := sendWithToken(boundContext(j.ctx), j.Client, j.BearerTokenService, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newAPIError(res, j.Namespace)
+	}
+
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *bytes.Buffer:
+		_, err = out.Write(raw)
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// lastLines keeps the end of long logs for error messages
+func lastLines(logs string, n int) string {
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// kubernetesJobList holds a Kubernetes JobList.
+type kubernetesJobList struct {
+	Items []kubernetesJob `json:"items"`
+}
+
+// kubernetesJob is the part of a Kubernetes Job needed to follow it.
+type kubernetesJob struct {
+	Metadata PodMetadataDetail `json:"metadata"`
+	Status   struct {
+		Conditions []DeploymentCondition `json:"conditions"`
+	} `json:"status"`
+}
+
+// finished is true once the Job has completed or failed
+func (j *kubernetesJob) finished() bool {
+	for _, condition := range j.Status.Conditions {
+		if condition.Status == "True" && (condition.Type == "Complete" || condition.Type == "Failed") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRunnerSucceeds(t *testing.T) {
+	cluster := newMockJobCluster("Complete")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	runner := mockJobRunner(server)
+	result, err := runner.Run("abc123")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, "migrations\napplied", result.Logs)
+	assert.True(t, strings.HasPrefix(result.Name, "myapp-migrate-"))
+
+	created := cluster.created
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:abc123", created.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, []string{"rake", "db:migrate", "TAG=abc123"}, created.Spec.Template.Spec.Containers[0].Command)
+	assert.Equal(t, "myapp-migrate", created.Metadata.Labels[JobLabel])
+	assert.Equal(t, "rails", created.Metadata.Labels["app"])
+}
+
+func TestJobRunnerFails(t *testing.T) {
+	cluster := newMockJobCluster("Failed")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	runner := mockJobRunner(server)
+	result, err := runner.Run("abc123")
+
+	assert.EqualError(t, err, fmt.Sprintf("job %s failed", result.Name))
+	assert.False(t, result.Succeeded)
+}
+
+func TestJobRunnerHookAbortsDeploy(t *testing.T) {
+	cluster := newMockJobCluster("Failed")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	deployer := &MockDeployer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Hooks:       DeployHooks{BeforePatch: []DeployHook{mockJobRunner(server).BeforePatchHook()}},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.Error(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), "failed\nmigrations\napplied"))
+	assert.Equal(t, 0, len(deployer.deployed))
+}
+
+func TestJobRunnerRetention(t *testing.T) {
+	cluster := newMockJobCluster("Complete")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	runner := mockJobRunner(server)
+	runner.Run("abc123")
+
+	assert.Equal(t, []string{"myapp-migrate-2"}, cluster.deleted)
+}
+
+func TestJobRunnerNamesJobsApart(t *testing.T) {
+	runner := &KubernetesJobRunner{Name: "myapp-migrate", Template: exampleJobTemplate}
+	first, err := runner.render("abc123")
+	assert.Nil(t, err)
+	second, _ := runner.render("abc123")
+
+	name := first["metadata"].(map[string]interface{})["name"].(string)
+	assert.True(t, strings.HasPrefix(name, "myapp-migrate-"))
+	assert.False(t, name == second["metadata"].(map[string]interface{})["name"].(string))
+}
+
+func TestJobRunnerEscapesTag(t *testing.T) {
+	runner := &KubernetesJobRunner{Name: "myapp-migrate", ContainerImage: "myapp-docker-image", Template: exampleJobTemplate}
+	job, err := runner.render(`abc123", "env": [{"name": "X", "value": "1"}], "x": "`)
+	assert.Nil(t, err)
+
+	raw, _ := json.Marshal(job)
+	container := job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []string{"apiVersion", "kind", "metadata", "spec"}, sortedKeys(job))
+	assert.Equal(t, []string{"command", "image", "name"}, sortedKeys(container))
+	assert.Equal(t, `myapp-docker-image:abc123", "env": [{"name": "X", "value": "1"}], "x": "`, container["image"])
+	assert.False(t, strings.Contains(string(raw), `"env":`))
+}
+
+func TestJobRunnerImageDigest(t *testing.T) {
+	runner := &KubernetesJobRunner{Name: "myapp-migrate", ContainerImage: "myapp-docker-image", Template: exampleJobTemplate}
+	job, err := runner.render("sha256:0123abcd")
+	assert.Nil(t, err)
+
+	container := job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "myapp-docker-image@sha256:0123abcd", container["image"])
+}
+
+func TestJobRunnerWaitsWithoutTimeout(t *testing.T) {
+	cluster := newMockJobCluster("Complete")
+	cluster.pending = 2
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	runner := mockJobRunner(server)
+	runner.Timeout = 0
+	result, err := runner.Run("abc123")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Succeeded)
+}
+
+func TestJobRunnerInvalidTemplate(t *testing.T) {
+	runner := &KubernetesJobRunner{Endpoint: "k8s", Namespace: "myapp", Name: "myapp-migrate", Template: "{"}
+	_, err := runner.Run("abc123")
+	assert.EqualError(t, err, "job template is not valid JSON: unexpected end of JSON input")
+}
+
+//
+// MOCK DATA
+//
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type mockJobManifest struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Image   string   `json:"image"`
+					Command []string `json:"command"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// MockJobCluster runs every Job to the given condition, after it is polled pending times.
+// It already holds two older finished Jobs.
+type MockJobCluster struct {
+	mutex     sync.Mutex
+	condition string
+	pending   int
+	created   mockJobManifest
+	deleted   []string
+}
+
+func newMockJobCluster(condition string) *MockJobCluster {
+	return &MockJobCluster{condition: condition}
+}
+
+func (c *MockJobCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/apis/batch/v1/namespaces/myapp-development/jobs":
+		raw, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(raw, &c.created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(raw)
+	case r.Method == http.MethodGet && path == "/apis/batch/v1/namespaces/myapp-development/jobs":
+		if r.URL.Query().Get("labelSelector") != JobLabel+"=myapp-migrate" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"items":[
+			{"metadata":{"name":"myapp-migrate-1","creationTimestamp":"2019-02-01T10:00:00Z"},"status":{"conditions":[{"type":"Complete","status":"True"}]}},
+			{"metadata":{"name":"myapp-migrate-2","creationTimestamp":"2019-01-01T10:00:00Z"},"status":{"conditions":[{"type":"Failed","status":"True"}]}},
+			{"metadata":{"name":%q,"creationTimestamp":%q},"status":{"conditions":[{"type":%q,"status":"True"}]}}
+		]}`, c.created.Metadata.Name, time.Now().UTC().Format(time.RFC3339), c.condition)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/apis/batch/v1/namespaces/myapp-development/jobs/"):
+		if c.pending > 0 {
+			c.pending--
+			fmt.Fprintf(w, `{"metadata":{"name":%q},"status":{}}`, c.created.Metadata.Name)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata":{"name":%q},"status":{"conditions":[{"type":%q,"status":"True"}]}}`, c.created.Metadata.Name, c.condition)
+	case r.Method == http.MethodDelete:
+		parts := strings.Split(path, "/")
+		c.deleted = append(c.deleted, parts[len(parts)-1])
+		w.Write([]byte(`{}`))
+	case path == "/api/v1/namespaces/myapp-development/pods":
+		fmt.Fprintf(w, `{"items":[{"metadata":{"name":"%s-x1"}}]}`, strings.TrimPrefix(r.URL.Query().Get("labelSelector"), "job-name="))
+	case strings.HasSuffix(path, "/log"):
+		w.Write([]byte("migrations\napplied"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func mockJobRunner(server *httptest.Server) *KubernetesJobRunner {
+	return &KubernetesJobRunner{
+		Client:             server.Client(),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		BearerTokenService: &MockBearerToken{},
+		Name:               "myapp-migrate",
+		ContainerImage:     "artifactory.myorg.com:5010/myapp-docker-image",
+		Template:           exampleJobTemplate,
+		Timeout:            5 * time.Millisecond,
+		Interval:           time.Millisecond,
+		Retention:          2,
+	}
+}
+
+const exampleJobTemplate = `
+{
+	"apiVersion": "batch/v1",
+	"kind": "Job",
+	"metadata": {
+		"labels": {"app": "rails"}
+	},
+	"spec": {
+		"backoffLimit": 0,
+		"template": {
+			"spec": {
+				"restartPolicy": "Never",
+				"containers": [
+					{
+						"name": "migrate",
+						"image": "{{.Image}}",
+						"command": ["rake", "db:migrate", "TAG={{.Tag}}"]
+					}
+				]
+			}
+		}
+	}
+}
+`
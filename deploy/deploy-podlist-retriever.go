@@ -1,52 +1,208 @@
 package deploy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
-// KubernetesPodListRetriever retrieves pods via Kubernetes API
+// DefaultPodPageSize is how many pods are retrieved at a time when PageSize is zero
+const DefaultPodPageSize = 500
+
+// KubernetesPodListRetriever retrieves pods via Kubernetes API, PageSize pods at a time
 type KubernetesPodListRetriever struct {
 	Client             *http.Client
 	Endpoint           string
 	Namespace          string
 	BearerTokenService BearerTokenRetriever
+	PageSize           int
+
+	// ctx is the context its API calls are made within, set by WithContext
+	ctx context.Context
+}
+
+// WithContext returns a copy of the retriever making its API calls within ctx,
+// so they are traced as children of the span ctx carries.
+func (p *KubernetesPodListRetriever) WithContext(ctx context.Context) PodListRetriever {
+	bound := *p
+	bound.ctx = ctx
+	return &bound
 }
 
-// PodInformation retrieved from Kubernetes API
+// PodInformation retrieved from Kubernetes API, a page at a time
 func (p *KubernetesPodListRetriever) PodInformation() (*PodList, error) {
 	if p.Endpoint == "" || p.Namespace == "" {
 		return nil, fmt.Errorf("missing Endpoint or Namespace information")
 	}
 
-	url := fmt.Sprintf("https://%s/api/v1/namespaces/%s/pods", p.Endpoint, p.Namespace)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	podList := &PodList{Items: []PodMetadataContainer{}}
+	pods := p.Pods()
+	for pods.Next() {
+		podList.Items = append(podList.Items, pods.Pod())
+	}
+	if pods.Err() != nil {
+		return nil, pods.Err()
+	}
+	return podList, nil
+}
+
+// Pods returns an iterator over the pods in the namespace, which only holds one page of pods at a time
+func (p *KubernetesPodListRetriever) Pods() *PodIterator {
+	return &PodIterator{retriever: p, returned: map[string]bool{}}
+}
+
+// podPage retrieves up to PageSize pods, carrying on from continueToken unless it is empty
+func (p *KubernetesPodListRetriever) podPage(continueToken string) (*PodList, int, error) {
+	pageSize := p.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPodPageSize
+	}
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(pageSize))
+	if continueToken != "" {
+		query.Set("continue", continueToken)
+	}
+
+	podsURL := fmt.Sprintf("https://%s/api/v1/namespaces/%s/pods?%s", p.Endpoint, p.Namespace, query.Encode())
+	req, err := http.NewRequest(http.MethodGet, podsURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", p.BearerTokenService.RetrieveToken()))
-	res, err := p.Client.Do(req)
+	res, err := sendWithToken(boundContext(p.ctx), p.Client, p.BearerTokenService, req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer res.Body.Close()
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("received %v", res.StatusCode)
+		return nil, res.StatusCode, newAPIError(res, p.Namespace)
 	}
 
-	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, res.StatusCode, err
 	}
 
 	podList := &PodList{}
 	err = json.Unmarshal([]byte(body), podList)
 	if err != nil {
-		return nil, err
+		return nil, res.StatusCode, err
 	}
+	return podList, res.StatusCode, nil
+}
 
-	return podList, nil
+// PodIterator steps through pods a page at a time, in the style of bufio.Scanner:
+//
+//	pods := retriever.Pods()
+//	for pods.Next() {
+//		pod := pods.Pod()
+//	}
+//	err := pods.Err()
+//
+// The continue token of a page expires after a few minutes. When it has, the pods are listed again
+// from the start, skipping those already returned, so a pod is never returned twice.
+type PodIterator struct {
+	retriever     *KubernetesPodListRetriever
+	page          []PodMetadataContainer
+	pod           PodMetadataContainer
+	continueToken string
+	started       bool
+	relisted      bool
+	err           error
+	// returned holds the names of the pods returned so far, to skip them after listing again
+	returned map[string]bool
+}
+
+// Next moves on to the next pod, retrieving another page when needed.
+// It returns false at the end of the pods, or when retrieving them failed.
+func (i *PodIterator) Next() bool {
+	for {
+		if i.err != nil {
+			return false
+		}
+		if len(i.page) > 0 {
+			i.pod, i.page = i.page[0], i.page[1:]
+			if i.returned[i.pod.Metadata.Name] {
+				continue
+			}
+			i.returned[i.pod.Metadata.Name] = true
+			return true
+		}
+		if i.started && i.continueToken == "" {
+			return false
+		}
+		i.nextPage()
+	}
+}
+
+// Pod is the current pod
+func (i *PodIterator) Pod() PodMetadataContainer {
+	return i.pod
+}
+
+// Err is the error that ended the iteration, if any
+func (i *PodIterator) Err() error {
+	return i.err
+}
+
+func (i *PodIterator) nextPage() {
+	p := i.retriever
+	if p.Endpoint == "" || p.Namespace == "" {
+		i.err = fmt.Errorf("missing Endpoint or Namespace information")
+		return
+	}
+
+	podList, status, err := p.podPage(i.continueToken)
+	if status == http.StatusGone && i.continueToken != "" && !i.relisted {
+		// the continue token expired, so start again and skip the pods already returned
+		i.relisted = true
+		podList, status, err = p.podPage("")
+	}
+	i.started = true
+	if err != nil {
+		i.err = err
+		return
+	}
+	i.page = podList.Items
+	i.continueToken = podList.Metadata.Continue
+}
+
+// PodLogs retrieves the logs of a container in a pod from Kubernetes API.
+// tailLines limits the logs to the most recent lines, unless it is zero.
+func (p *KubernetesPodListRetriever) PodLogs(podName string, containerName string, tailLines int) (string, error) {
+	if p.Endpoint == "" || p.Namespace == "" {
+		return "", fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	query := url.Values{}
+	if containerName != "" {
+		query.Set("container", containerName)
+	}
+	if tailLines > 0 {
+		query.Set("tailLines", strconv.Itoa(tailLines))
+	}
+	logsURL := fmt.Sprintf("https://%s/api/v1/namespaces/%s/pods/%s/log?%s", p.Endpoint, p.Namespace, podName, query.Encode())
+	req, err := http.NewRequest(http.MethodGet, logsURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := sendWithToken(boundContext(p.ctx), p.Client, p.BearerTokenService, req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", newAPIError(res, p.Namespace)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
 }
@@ -0,0 +1,154 @@
+package deploy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodInformationPages(t *testing.T) {
+	cluster := &MockPagedPods{pods: 5}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	retriever := mockPodListRetriever(server)
+	retriever.PageSize = 2
+	podList, err := retriever.PodInformation()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"myapp-deployment-1-pod0", "myapp-deployment-1-pod1", "myapp-deployment-1-pod2", "myapp-deployment-1-pod3", "myapp-deployment-1-pod4"}, mockPodNames(podList.Items))
+	assert.Equal(t, []string{"limit=2", "continue=2&limit=2", "continue=4&limit=2"}, cluster.queries)
+}
+
+func TestPodInformationDefaultPageSize(t *testing.T) {
+	cluster := &MockPagedPods{pods: 1}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	podList, err := mockPodListRetriever(server).PodInformation()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(podList.Items))
+	assert.Equal(t, []string{"limit=500"}, cluster.queries)
+}
+
+func TestPodInformationWithoutPods(t *testing.T) {
+	server := httptest.NewTLSServer(&MockPagedPods{})
+	defer server.Close()
+
+	podList, err := mockPodListRetriever(server).PodInformation()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(podList.Items))
+}
+
+func TestPodIteratorRelistsWhenContinueExpires(t *testing.T) {
+	cluster := &MockPagedPods{pods: 5, expire: "2"}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	retriever := mockPodListRetriever(server)
+	retriever.PageSize = 2
+	podList, err := retriever.PodInformation()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(podList.Items))
+	assert.Equal(t, []string{"myapp-deployment-1-pod0", "myapp-deployment-1-pod1", "myapp-deployment-1-pod2", "myapp-deployment-1-pod3", "myapp-deployment-1-pod4"}, mockPodNames(podList.Items))
+	assert.Equal(t, []string{"limit=2", "continue=2&limit=2", "limit=2", "continue=2&limit=2", "continue=4&limit=2"}, cluster.queries)
+}
+
+func TestPodIteratorStopsEarly(t *testing.T) {
+	cluster := &MockPagedPods{pods: 5}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	retriever := mockPodListRetriever(server)
+	retriever.PageSize = 2
+	pods := retriever.Pods()
+	for pods.Next() {
+		if pods.Pod().Metadata.Name == "myapp-deployment-1-pod1" {
+			break
+		}
+	}
+
+	assert.Nil(t, pods.Err())
+	assert.Equal(t, []string{"limit=2"}, cluster.queries)
+}
+
+func TestPodIteratorErrors(t *testing.T) {
+	cluster := &MockPagedPods{pods: 5, failAt: "2"}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	retriever := mockPodListRetriever(server)
+	retriever.PageSize = 2
+	pods := retriever.Pods()
+	count := 0
+	for pods.Next() {
+		count++
+	}
+
+	assert.Equal(t, 2, count)
+	assert.Contains(t, pods.Err().Error(), "/pods?continue=2&limit=2 in namespace myapp-development: received 500")
+
+	_, err := retriever.PodInformation()
+	assert.Contains(t, err.Error(), ": received 500")
+	assert.False(t, (&KubernetesPodListRetriever{}).Pods().Next())
+}
+
+//
+// MOCK DATA
+//
+
+// MockPagedPods serves pods myapp-deployment-1-pod0 onwards a page at a time, using the index of the
+// next pod as the continue token. The expire token is only accepted once, and failAt always fails.
+type MockPagedPods struct {
+	mutex   sync.Mutex
+	pods    int
+	expire  string
+	failAt  string
+	queries []string
+}
+
+func (c *MockPagedPods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.queries = append(c.queries, r.URL.RawQuery)
+	token := r.URL.Query().Get("continue")
+	if token != "" && token == c.failAt {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if token != "" && token == c.expire {
+		c.expire = ""
+		w.WriteHeader(http.StatusGone)
+		w.Write([]byte(`{"kind":"Status","code":410,"reason":"Expired","message":"The provided continue parameter is too old"}`))
+		return
+	}
+
+	from, _ := strconv.Atoi(token)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items := []string{}
+	next := from
+	for ; next < c.pods && next < from+limit; next++ {
+		items = append(items, fmt.Sprintf(`{"metadata":{"name":"myapp-deployment-1-pod%d"},"status":{"phase":"Running"}}`, next))
+	}
+	continueToken := ""
+	if next < c.pods {
+		continueToken = strconv.Itoa(next)
+	}
+	fmt.Fprintf(w, `{"metadata":{"resourceVersion":"100","continue":%q},"items":[%s]}`, continueToken, strings.Join(items, ","))
+}
+
+func mockPodNames(pods []PodMetadataContainer) []string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Metadata.Name)
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// KubernetesServiceClient reads and updates Services via Kubernetes API
+type KubernetesServiceClient struct {
+	Client             *http.Client
+	Endpoint           string
+	Namespace          string
+	BearerTokenService BearerTokenRetriever
+
+	// ctx is the context its API calls are made within, set by WithContext
+	ctx context.Context
+}
+
+// WithContext returns a copy of the client making its API calls within ctx,
+// so they are traced as children of the span ctx carries.
+func (s *KubernetesServiceClient) WithContext(ctx context.Context) ServiceSelector {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+// Selector retrieves the pod selector of a Service
+func (s *KubernetesServiceClient) Selector(serviceName string) (map[string]string, error) {
+	service := &serviceSelector{}
+	err := s.do(http.MethodGet, serviceName, nil, service)
+	if err != nil {
+		return nil, err
+	}
+	return service.Spec.Selector, nil
+}
+
+// SetSelector changes the given labels in the pod selector of a Service, leaving other labels as they are
+func (s *KubernetesServiceClient) SetSelector(serviceName string, selector map[string]string) error {
+	patch := &serviceSelector{}
+	patch.Spec.Selector = selector
+	return s.do(http.MethodPatch, serviceName, patch, &serviceSelector{})
+}
+
+// do sends a request for a Service and decodes the Service that comes back
+func (s *KubernetesServiceClient) do(method string, serviceName string, patch *serviceSelector, service *serviceSelector) error {
+	if s.Endpoint == "" || s.Namespace == "" {
+		return fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	var payload io.Reader
+	if patch != nil {
+		raw, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewBuffer(raw)
+	}
+
+	url := fmt.Sprintf("https://%s/api/v1/namespaces/%s/services/%s", s.Endpoint, s.Namespace, serviceName)
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return err
+	}
+	if patch != nil {
+		req.Header.Add("Content-Type", "application/strategic-merge-patch+json")
+	}
+
+	res, err := sendWithToken(boundContext(s.ctx), s.Client, s.BearerTokenService, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return newAPIError(res, s.Namespace)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(body), service)
+}
+
+// serviceSelector is the part of a Service that selects its pods
+type serviceSelector struct {
+	Spec struct {
+		Selector map[string]string `json:"selector"`
+	} `json:"spec"`
+}
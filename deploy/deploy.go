@@ -2,6 +2,7 @@ package deploy
 
 import (
 	"fmt"
+	"time"
 )
 
 // BearerTokenRetriever represents any struct that can return a Bearer token.
@@ -16,30 +17,106 @@ type PodListRetriever interface {
 	PodInformation() (*PodList, error)
 }
 
+// EventListRetriever represents any struct that returns an EventList
+type EventListRetriever interface {
+	EventInformation() (*EventList, error)
+}
+
+// PodLogRetriever represents any struct that returns the logs of a container in a pod
+type PodLogRetriever interface {
+	PodLogs(podName string, containerName string, tailLines int) (string, error)
+}
+
+// ServiceSelector represents any struct that can read and change the pod selector of a Service
+type ServiceSelector interface {
+	Selector(serviceName string) (map[string]string, error)
+	SetSelector(serviceName string, selector map[string]string) error
+}
+
 // Deployer represents any struct that can deploy a container
 type Deployer interface {
 	Deploy(containerTag string) error
 }
 
+// ImageDeployer represents any struct that can deploy a container by tag or digest,
+// recording annotations alongside the deploy
+type ImageDeployer interface {
+	DeployImage(tagOrDigest string, annotations map[string]string) error
+}
+
 // KubernetesClusterNamespace is a struct used to connect to a Kubernetes cluster.
+// DeploymentName is optional, and narrows pod lists to a single deployment
+// when several deployments share the namespace. Policies are checked before every deploy,
+// Hooks run around it, and every attempt is recorded by the Auditor when there is one.
+// Once a Cache has synced, pods, the deployment and its history are read from it instead of the API.
+// With a Tracer, each deploy and rollback records a span, with children for its stages and API calls.
+// With a Logger, how each deploy and rollback ended is logged.
 type KubernetesClusterNamespace struct {
-	Description  string
-	PodRetriever PodListRetriever
-	DeployMaker  Deployer
+	Description    string
+	DeploymentName string
+	PodRetriever   PodListRetriever
+	EventRetriever EventListRetriever
+	ServiceClient  ServiceSelector
+	DeployMaker    Deployer
+	Policies       []DeployPolicy
+	Auditor        DeployAuditor
+	Hooks          DeployHooks
+	Cache          *NamespaceCache
+	Tracer         Tracer
+	Logger         Logger
 }
 
 // GetPodList retrieves all the pods running in a deployment
 func (n *KubernetesClusterNamespace) GetPodList() (*PodList, error) {
+	if n.cached() {
+		if n.DeploymentName == "" {
+			return n.Cache.PodInformation()
+		}
+		return n.Cache.PodsOfDeployment(n.DeploymentName), nil
+	}
 	if n.PodRetriever == nil {
 		return nil, fmt.Errorf("missing PodListRetriever")
 	}
-	return n.PodRetriever.PodInformation()
+	podList, err := n.PodRetriever.PodInformation()
+	if err != nil || n.DeploymentName == "" {
+		return podList, err
+	}
+	return podList.PodsOfDeployment(n.DeploymentName), nil
+}
+
+// GetEventList retrieves the recent events in the namespace
+func (n *KubernetesClusterNamespace) GetEventList() (*EventList, error) {
+	if n.EventRetriever == nil {
+		return nil, fmt.Errorf("missing EventListRetriever")
+	}
+	return n.EventRetriever.EventInformation()
 }
 
 // Deploy changes the image for an existing deployment and Kubernetes rebuilds the pods
 func (n *KubernetesClusterNamespace) Deploy(containerTag string) error {
+	return n.DeployWithRequest(DeployRequest{Tag: containerTag})
+}
+
+// DeployWithRequest deploys like Deploy, giving policies the details of who asked for
+// the deploy and who approved it.
+func (n *KubernetesClusterNamespace) DeployWithRequest(req DeployRequest) error {
 	if n.DeployMaker == nil {
 		return fmt.Errorf("missing DeployMaker")
 	}
-	return n.DeployMaker.Deploy(containerTag)
+
+	req = n.completeRequest(req)
+	return n.runDeploy(req, func(deployer Deployer) error {
+		return deployer.Deploy(req.Tag)
+	})
+}
+
+// completeRequest fills in the deploy time and image name when the caller left them out
+func (n *KubernetesClusterNamespace) completeRequest(req DeployRequest) DeployRequest {
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+	if imageNamer, ok := n.DeployMaker.(ImageNamer); ok && req.Image == "" {
+		req.Image = imageNamer.ImageName(req.Tag)
+	}
+	return req
 }
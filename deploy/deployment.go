@@ -0,0 +1,94 @@
+package deploy
+
+// Deployment holds a Kubernetes Deployment.
+type Deployment struct {
+	Metadata DeploymentMetadata `json:"metadata"`
+	Spec     DeploymentSpec     `json:"spec"`
+	Status   DeploymentStatus   `json:"status"`
+}
+
+// DeploymentMetadata has details about an individual Kubernetes Deployment.
+type DeploymentMetadata struct {
+	Name            string            `json:"name"`
+	Generation      int64             `json:"generation"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// DeploymentSpec is the desired state of a Deployment.
+type DeploymentSpec struct {
+	Replicas *int               `json:"replicas,omitempty"`
+	Template DeploymentTemplate `json:"template"`
+}
+
+// DeploymentTemplate is the pod template of a Deployment.
+type DeploymentTemplate struct {
+	Spec DeploymentTemplateSpec `json:"spec"`
+}
+
+// DeploymentTemplateSpec lists the containers in the pod template.
+type DeploymentTemplateSpec struct {
+	Containers []DeploymentContainer `json:"containers"`
+}
+
+// DeploymentContainer is a container in the pod template.
+type DeploymentContainer struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// DeploymentStatus is the most recently observed state of a Deployment.
+type DeploymentStatus struct {
+	ObservedGeneration  int64                 `json:"observedGeneration"`
+	Replicas            int                   `json:"replicas"`
+	UpdatedReplicas     int                   `json:"updatedReplicas"`
+	ReadyReplicas       int                   `json:"readyReplicas"`
+	AvailableReplicas   int                   `json:"availableReplicas"`
+	UnavailableReplicas int                   `json:"unavailableReplicas"`
+	Conditions          []DeploymentCondition `json:"conditions"`
+}
+
+// DeploymentCondition describes a Deployment's state, e.g. whether it is still progressing.
+type DeploymentCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// DesiredReplicas is how many replicas the Deployment asks for. Kubernetes defaults to one.
+func (d *Deployment) DesiredReplicas() int {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// ContainerImage is the image of the named container in the pod template
+func (d *Deployment) ContainerImage(containerName string) string {
+	for _, container := range d.Spec.Template.Spec.Containers {
+		if container.Name == containerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// RolloutComplete is true once every replica is updated to the latest pod template and available.
+func (d *Deployment) RolloutComplete() bool {
+	desired := d.DesiredReplicas()
+	return d.Status.ObservedGeneration >= d.Metadata.Generation &&
+		d.Status.UpdatedReplicas == desired &&
+		d.Status.Replicas == desired &&
+		d.Status.AvailableReplicas == desired
+}
+
+// RolloutFailed is true when Kubernetes has given up on the rollout making progress.
+func (d *Deployment) RolloutFailed() bool {
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == "Progressing" && condition.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EnvironmentsConfig is the format of an environments file, holding named clusters.
+//
+//	{
+//	  "environments": {
+//	    "staging": {
+//	      "endpoint": "staging.k8s.myorg.com",
+//	      "namespace": "myapp-staging",
+//	      ...
+//	    }
+//	  }
+//	}
+type EnvironmentsConfig struct {
+	Environments map[string]EnvironmentConfig `json:"environments"`
+}
+
+// EnvironmentConfig describes a single named Kubernetes cluster namespace and the deployment within it.
+type EnvironmentConfig struct {
+	Description    string `json:"description"`
+	Endpoint       string `json:"endpoint"`
+	Namespace      string `json:"namespace"`
+	DeploymentName string `json:"deploymentName"`
+	ContainerName  string `json:"containerName"`
+	ImagePrefix    string `json:"imagePrefix"`
+	// TokenVariable names the environment variable holding the bearer token for this cluster.
+	TokenVariable string `json:"tokenVariable"`
+	// VerifyImage checks the tag exists in the registry before deploying.
+	// RegistryTokenVariable optionally names the environment variable holding a registry bearer token.
+	// RegistryUsername and RegistryPasswordVariable are optional credentials for a registry's token service.
+	VerifyImage              bool   `json:"verifyImage"`
+	RegistryTokenVariable    string `json:"registryTokenVariable"`
+	RegistryUsername         string `json:"registryUsername"`
+	RegistryPasswordVariable string `json:"registryPasswordVariable"`
+}
+
+// EnvironmentVariableToken is a BearerTokenRetriever for long-lived tokens kept in an environment variable.
+type EnvironmentVariableToken struct {
+	Variable string
+}
+
+// RetrieveToken reads the token from the environment variable
+func (e *EnvironmentVariableToken) RetrieveToken() string {
+	return os.Getenv(e.Variable)
+}
+
+// EnvironmentRegistry holds named clusters, e.g. dev, staging and each prod region.
+type EnvironmentRegistry struct {
+	Environments map[string]*KubernetesClusterNamespace
+}
+
+// LoadEnvironments reads an environments file and builds a cluster for each entry.
+// All clusters share client.
+func LoadEnvironments(path string, client *http.Client) (*EnvironmentRegistry, error) {
+	config, err := ReadEnvironments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &EnvironmentRegistry{}
+	for name, environment := range config.Environments {
+		registry.Register(name, environment.Cluster(client))
+	}
+	return registry, nil
+}
+
+// ReadEnvironments reads an environments file without building any clusters, e.g. to change an entry first
+func ReadEnvironments(path string) (*EnvironmentsConfig, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &EnvironmentsConfig{}
+	err = json.Unmarshal(raw, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err.Error())
+	}
+	return config, nil
+}
+
+// Cluster builds a KubernetesClusterNamespace for the environment
+func (e EnvironmentConfig) Cluster(client *http.Client) *KubernetesClusterNamespace {
+	tokenService := &EnvironmentVariableToken{Variable: e.TokenVariable}
+
+	var imageVerifier ImageVerifier
+	if e.VerifyImage {
+		verifier := &RegistryImageVerifier{Client: client, Username: e.RegistryUsername}
+		if e.RegistryPasswordVariable != "" {
+			verifier.Password = os.Getenv(e.RegistryPasswordVariable)
+		}
+		if e.RegistryTokenVariable != "" {
+			verifier.BearerTokenService = &EnvironmentVariableToken{Variable: e.RegistryTokenVariable}
+		}
+		imageVerifier = verifier
+	}
+
+	return &KubernetesClusterNamespace{
+		Description:    e.Description,
+		DeploymentName: e.DeploymentName,
+		PodRetriever: &KubernetesPodListRetriever{
+			Client:             client,
+			Endpoint:           e.Endpoint,
+			Namespace:          e.Namespace,
+			BearerTokenService: tokenService,
+		},
+		EventRetriever: &KubernetesEventListRetriever{
+			Client:             client,
+			Endpoint:           e.Endpoint,
+			Namespace:          e.Namespace,
+			BearerTokenService: tokenService,
+		},
+		ServiceClient: &KubernetesServiceClient{
+			Client:             client,
+			Endpoint:           e.Endpoint,
+			Namespace:          e.Namespace,
+			BearerTokenService: tokenService,
+		},
+		DeployMaker: &KubernetesDeployer{
+			Client:             client,
+			Endpoint:           e.Endpoint,
+			Namespace:          e.Namespace,
+			BearerTokenService: tokenService,
+			DeploymentName:     e.DeploymentName,
+			ContainerName:      e.ContainerName,
+			ContainerImage:     e.ImagePrefix,
+			ImageVerifier:      imageVerifier,
+		},
+	}
+}
+
+// Register adds or replaces a named cluster
+func (r *EnvironmentRegistry) Register(name string, cluster *KubernetesClusterNamespace) {
+	if r.Environments == nil {
+		r.Environments = map[string]*KubernetesClusterNamespace{}
+	}
+	r.Environments[name] = cluster
+}
+
+// Get returns the named cluster
+func (r *EnvironmentRegistry) Get(name string) (*KubernetesClusterNamespace, error) {
+	cluster, ok := r.Environments[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown environment %q", name)
+	}
+	return cluster, nil
+}
+
+// Names lists every environment in alphabetical order
+func (r *EnvironmentRegistry) Names() []string {
+	names := []string{}
+	for name := range r.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DeployAllOptions controls how DeployAll runs.
+type DeployAllOptions struct {
+	// Concurrency is how many environments deploy at once. Zero or one deploys in sequence.
+	Concurrency int
+	// StopOnFailure skips environments that have not started yet once any deploy fails.
+	StopOnFailure bool
+}
+
+// EnvironmentDeployResult is the outcome of deploying to a single environment.
+type EnvironmentDeployResult struct {
+	Environment string
+	Skipped     bool
+	Duration    time.Duration
+	Err         error
+}
+
+// DeployAll deploys the container tag to each named environment. Results are in the same order as names.
+func (r *EnvironmentRegistry) DeployAll(containerTag string, names []string, options DeployAllOptions) []EnvironmentDeployResult {
+	results := make([]EnvironmentDeployResult, len(names))
+
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failed := false
+	slots := make(chan struct{}, concurrency)
+
+	for i, name := range names {
+		slots <- struct{}{}
+
+		mutex.Lock()
+		stop := failed && options.StopOnFailure
+		mutex.Unlock()
+		if stop {
+			<-slots
+			results[i] = EnvironmentDeployResult{Environment: name, Skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result := r.deployEnvironment(containerTag, name)
+
+			mutex.Lock()
+			results[i] = result
+			if result.Err != nil {
+				failed = true
+			}
+			mutex.Unlock()
+		}(i, name)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// deployEnvironment deploys to a single environment and times it
+func (r *EnvironmentRegistry) deployEnvironment(containerTag string, name string) EnvironmentDeployResult {
+	started := time.Now()
+
+	cluster, err := r.Get(name)
+	if err == nil {
+		err = cluster.Deploy(containerTag)
+	}
+
+	return EnvironmentDeployResult{
+		Environment: name,
+		Duration:    time.Since(started),
+		Err:         err,
+	}
+}
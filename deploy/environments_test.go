@@ -0,0 +1,207 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEnvironments(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "environments")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "environments.json")
+	ioutil.WriteFile(path, []byte(exampleEnvironments), 0600)
+	os.Setenv("TEST_REGISTRY_PASSWORD", "hunter2")
+	defer os.Unsetenv("TEST_REGISTRY_PASSWORD")
+
+	registry, err := LoadEnvironments(path, &http.Client{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"production-eu", "staging"}, registry.Names())
+
+	cluster, err := registry.Get("staging")
+	assert.Nil(t, err)
+	assert.Equal(t, "Staging", cluster.Description)
+
+	deployer := cluster.DeployMaker.(*KubernetesDeployer)
+	assert.Equal(t, "staging.k8s.myorg.com", deployer.Endpoint)
+	assert.Equal(t, "myapp-staging", deployer.Namespace)
+	assert.Equal(t, "myapp-deployment", deployer.DeploymentName)
+	assert.Equal(t, "myapp-container", deployer.ContainerName)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image", deployer.ContainerImage)
+
+	os.Setenv("TEST_STAGING_TOKEN", "secret")
+	defer os.Unsetenv("TEST_STAGING_TOKEN")
+	assert.Equal(t, "secret", deployer.BearerTokenService.RetrieveToken())
+	assert.Nil(t, deployer.ImageVerifier)
+
+	production, _ := registry.Get("production-eu")
+	verifier := production.DeployMaker.(*KubernetesDeployer).ImageVerifier.(*RegistryImageVerifier)
+	assert.Equal(t, &EnvironmentVariableToken{Variable: "TEST_REGISTRY_TOKEN"}, verifier.BearerTokenService)
+	assert.Equal(t, "bot", verifier.Username)
+	assert.Equal(t, "hunter2", verifier.Password)
+}
+
+func TestLoadEnvironments_InvalidFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "environments")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "environments.json")
+	ioutil.WriteFile(path, []byte("{"), 0600)
+
+	registry, err := LoadEnvironments(path, &http.Client{})
+	assert.Nil(t, registry)
+	assert.Error(t, err)
+}
+
+func TestEnvironmentRegistryGetUnknown(t *testing.T) {
+	registry := &EnvironmentRegistry{}
+	cluster, err := registry.Get("nowhere")
+	assert.Nil(t, cluster)
+	assert.EqualError(t, err, `unknown environment "nowhere"`)
+}
+
+func TestDeployAllInSequence(t *testing.T) {
+	registry, deployers := mockEnvironments("dev", "staging", "prod")
+
+	results := registry.DeployAll("abc123", []string{"dev", "staging", "prod"}, DeployAllOptions{})
+
+	assert.Equal(t, 3, len(results))
+	for i, name := range []string{"dev", "staging", "prod"} {
+		assert.Equal(t, name, results[i].Environment)
+		assert.Nil(t, results[i].Err)
+		assert.False(t, results[i].Skipped)
+		assert.Equal(t, []string{"abc123"}, deployers[name].deployed)
+	}
+}
+
+func TestDeployAllStopOnFailure(t *testing.T) {
+	registry, deployers := mockEnvironments("dev", "staging", "prod")
+	deployers["staging"].err = fmt.Errorf("received 500")
+
+	results := registry.DeployAll("abc123", []string{"dev", "staging", "prod"}, DeployAllOptions{StopOnFailure: true})
+
+	assert.Nil(t, results[0].Err)
+	assert.EqualError(t, results[1].Err, "received 500")
+	assert.True(t, results[2].Skipped)
+	assert.Equal(t, 0, len(deployers["prod"].deployed))
+}
+
+func TestDeployAllContinuesWithoutStopOnFailure(t *testing.T) {
+	registry, deployers := mockEnvironments("dev", "staging", "prod")
+	deployers["dev"].err = fmt.Errorf("received 500")
+
+	results := registry.DeployAll("abc123", []string{"dev", "staging", "prod"}, DeployAllOptions{})
+
+	assert.Error(t, results[0].Err)
+	assert.Nil(t, results[2].Err)
+	assert.Equal(t, []string{"abc123"}, deployers["prod"].deployed)
+}
+
+func TestDeployAllConcurrencyLimit(t *testing.T) {
+	names := []string{"us-east", "us-west", "eu-west", "eu-central", "ap-south"}
+	registry, deployers := mockEnvironments(names...)
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	for _, deployer := range deployers {
+		deployer.during = func() {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+		}
+	}
+
+	results := registry.DeployAll("abc123", names, DeployAllOptions{Concurrency: 2})
+
+	assert.Equal(t, 5, len(results))
+	assert.Equal(t, 2, maxRunning)
+	for i, name := range names {
+		assert.Equal(t, name, results[i].Environment)
+		assert.Nil(t, results[i].Err)
+	}
+}
+
+func TestDeployAllUnknownEnvironment(t *testing.T) {
+	registry, _ := mockEnvironments("dev")
+
+	results := registry.DeployAll("abc123", []string{"nowhere"}, DeployAllOptions{})
+	assert.EqualError(t, results[0].Err, `unknown environment "nowhere"`)
+}
+
+//
+// MOCK DATA
+//
+
+type MockDeployer struct {
+	deployed []string
+	err      error
+	during   func()
+}
+
+func (d *MockDeployer) Deploy(containerTag string) error {
+	if d.during != nil {
+		d.during()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	d.deployed = append(d.deployed, containerTag)
+	return nil
+}
+
+func mockEnvironments(names ...string) (*EnvironmentRegistry, map[string]*MockDeployer) {
+	registry := &EnvironmentRegistry{}
+	deployers := map[string]*MockDeployer{}
+	for _, name := range names {
+		deployers[name] = &MockDeployer{}
+		registry.Register(name, &KubernetesClusterNamespace{
+			Description: name,
+			DeployMaker: deployers[name],
+		})
+	}
+	return registry, deployers
+}
+
+const exampleEnvironments = `
+{
+	"environments": {
+		"staging": {
+			"description": "Staging",
+			"endpoint": "staging.k8s.myorg.com",
+			"namespace": "myapp-staging",
+			"deploymentName": "myapp-deployment",
+			"containerName": "myapp-container",
+			"imagePrefix": "artifactory.myorg.com:5010/myapp-docker-image",
+			"tokenVariable": "TEST_STAGING_TOKEN"
+		},
+		"production-eu": {
+			"description": "Production EU",
+			"endpoint": "eu.k8s.myorg.com",
+			"namespace": "myapp-production",
+			"deploymentName": "myapp-deployment",
+			"containerName": "myapp-container",
+			"imagePrefix": "artifactory.myorg.com:5010/myapp-docker-image",
+			"tokenVariable": "TEST_PRODUCTION_EU_TOKEN",
+			"verifyImage": true,
+			"registryTokenVariable": "TEST_REGISTRY_TOKEN",
+			"registryUsername": "bot",
+			"registryPasswordVariable": "TEST_REGISTRY_PASSWORD"
+		}
+	}
+}
+`
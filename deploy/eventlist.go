@@ -0,0 +1,107 @@
+package deploy
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventList holds a Kubernetes EventList.
+type EventList struct {
+	Items []Event `json:"items"`
+}
+
+// Event is a single Kubernetes Event, such as a failed image pull or a scheduling failure.
+type Event struct {
+	Metadata       EventMetadataDetail `json:"metadata"`
+	InvolvedObject EventInvolvedObject `json:"involvedObject"`
+	Reason         string              `json:"reason"`
+	Message        string              `json:"message"`
+	Type           string              `json:"type"`
+	Count          int                 `json:"count"`
+	FirstTimestamp time.Time           `json:"firstTimestamp"`
+	LastTimestamp  time.Time           `json:"lastTimestamp"`
+}
+
+// EventMetadataDetail has details about an individual Kubernetes Event.
+type EventMetadataDetail struct {
+	Name              string    `json:"name"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+}
+
+// EventInvolvedObject is the object an Event is about.
+type EventInvolvedObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Timestamp is the last time the event was seen. Older API servers leave
+// lastTimestamp empty for some events, so fall back to when it was created.
+func (e *Event) Timestamp() time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp
+	}
+	return e.Metadata.CreationTimestamp
+}
+
+// FilterByDeployment returns a new EventList with only events about the deployment,
+// its ReplicaSets and its pods. ReplicaSets and pods are matched by the names Kubernetes
+// gives them, e.g. `myapp-deployment-1376141578-9q2hx`, so a `myapp-deployment-canary`
+// deployment's events are left out.
+func (e *EventList) FilterByDeployment(deploymentName string) *EventList {
+	events := []Event{}
+
+	for _, item := range e.Items {
+		object := item.InvolvedObject
+		switch object.Kind {
+		case "Deployment":
+			if object.Name == deploymentName {
+				events = append(events, item)
+			}
+		case "ReplicaSet":
+			if isReplicaSetOf(object.Name, deploymentName) {
+				events = append(events, item)
+			}
+		case "Pod":
+			i := strings.LastIndex(object.Name, "-")
+			if i > 0 && isReplicaSetOf(object.Name[:i], deploymentName) {
+				events = append(events, item)
+			}
+		}
+	}
+	return &EventList{
+		Items: events,
+	}
+}
+
+// Since returns a new EventList with only events seen at or after start, oldest first.
+// Handy for only showing what happened after calling Deploy.
+func (e *EventList) Since(start time.Time) *EventList {
+	events := []Event{}
+
+	for _, item := range e.Items {
+		if !item.Timestamp().Before(start) {
+			events = append(events, item)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp().Before(events[j].Timestamp())
+	})
+	return &EventList{
+		Items: events,
+	}
+}
+
+// Warnings returns a new EventList with only `Warning` events, such as failed image pulls.
+func (e *EventList) Warnings() *EventList {
+	events := []Event{}
+
+	for _, item := range e.Items {
+		if item.Type == "Warning" {
+			events = append(events, item)
+		}
+	}
+	return &EventList{
+		Items: events,
+	}
+}
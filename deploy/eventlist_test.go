@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEventListWhenMissingParameters(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{}
+	eventList, err := clusterNamespace.GetEventList()
+	assert.Nil(t, eventList)
+	assert.Error(t, err)
+}
+
+func TestEventListFilterByDeployment(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		EventRetriever: &MockEventList{},
+	}
+
+	eventList, _ := clusterNamespace.GetEventList()
+	filtered := eventList.FilterByDeployment("myapp-deployment")
+
+	assert.Equal(t, 4, len(filtered.Items))
+	assert.Equal(t, "Deployment", filtered.Items[0].InvolvedObject.Kind)
+	assert.Equal(t, "ReplicaSet", filtered.Items[1].InvolvedObject.Kind)
+	assert.Equal(t, "Pod", filtered.Items[2].InvolvedObject.Kind)
+	assert.Equal(t, "Pod", filtered.Items[3].InvolvedObject.Kind)
+}
+
+func TestEventListFilterByDeployment_NoMatch(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		EventRetriever: &MockEventList{},
+	}
+
+	eventList, _ := clusterNamespace.GetEventList()
+	filtered := eventList.FilterByDeployment("unknown-deployment")
+	assert.Equal(t, 0, len(filtered.Items))
+}
+
+func TestEventListFilterByDeploymentLeavesOutCanary(t *testing.T) {
+	eventList := &EventList{Items: []Event{
+		{InvolvedObject: EventInvolvedObject{Kind: "Pod", Name: "myapp-5d8f9c-a1"}},
+		{InvolvedObject: EventInvolvedObject{Kind: "ReplicaSet", Name: "myapp-5d8f9c"}},
+		{InvolvedObject: EventInvolvedObject{Kind: "Pod", Name: "myapp-canary-7f1b2e-b2"}},
+		{InvolvedObject: EventInvolvedObject{Kind: "ReplicaSet", Name: "myapp-canary-7f1b2e"}},
+		{InvolvedObject: EventInvolvedObject{Kind: "Deployment", Name: "myapp-canary"}},
+	}}
+
+	assert.Equal(t, 2, len(eventList.FilterByDeployment("myapp").Items))
+	assert.Equal(t, 3, len(eventList.FilterByDeployment("myapp-canary").Items))
+}
+
+func TestEventListSince(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		EventRetriever: &MockEventList{},
+	}
+
+	eventList, _ := clusterNamespace.GetEventList()
+	started, _ := time.Parse(time.RFC3339, "2017-03-30T16:39:00Z")
+	filtered := eventList.FilterByDeployment("myapp-deployment").Since(started)
+
+	assert.Equal(t, 2, len(filtered.Items))
+	assert.Equal(t, "Scheduled", filtered.Items[0].Reason)
+	assert.Equal(t, "Failed", filtered.Items[1].Reason)
+}
+
+func TestEventListWarnings(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		EventRetriever: &MockEventList{},
+	}
+
+	eventList, _ := clusterNamespace.GetEventList()
+	warnings := eventList.FilterByDeployment("myapp-deployment").Warnings()
+
+	assert.Equal(t, 1, len(warnings.Items))
+	event := warnings.Items[0]
+	assert.Equal(t, "myapp-deployment-1376141578-c2sw6", event.InvolvedObject.Name)
+	assert.Equal(t, "Failed to pull image \"artifactory.myorg.com:5010/myapp-docker-image:3362ff29\": not found", event.Message)
+}
+
+func TestEventTimestampFallsBackToCreation(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		EventRetriever: &MockEventList{},
+	}
+
+	eventList, _ := clusterNamespace.GetEventList()
+	event := eventList.Items[2]
+
+	timestamp, _ := time.Parse(time.RFC3339, "2017-03-30T16:39:21Z")
+	assert.True(t, event.LastTimestamp.IsZero())
+	assert.Equal(t, timestamp, event.Timestamp())
+}
+
+//
+// MOCK DATA
+//
+
+type MockEventList struct{}
+
+func (e *MockEventList) EventInformation() (*EventList, error) {
+	eventList := &EventList{}
+	err := json.Unmarshal([]byte(exampleEventList), eventList)
+	return eventList, err
+}
+
+const exampleEventList = `
+{
+	"kind": "EventList",
+	"apiVersion": "v1",
+	"items": [
+	{
+		"metadata": {
+		"name": "myapp-deployment.14b0d3c1a2b3c4d5",
+		"namespace": "myapp-development",
+		"creationTimestamp": "2017-03-30T16:36:44Z"
+		},
+		"involvedObject": {
+		"kind": "Deployment",
+		"namespace": "myapp-development",
+		"name": "myapp-deployment"
+		},
+		"reason": "ScalingReplicaSet",
+		"message": "Scaled up replica set myapp-deployment-1376141578 to 4",
+		"source": {
+		"component": "deployment-controller"
+		},
+		"firstTimestamp": "2017-03-30T16:36:44Z",
+		"lastTimestamp": "2017-03-30T16:36:44Z",
+		"count": 1,
+		"type": "Normal"
+	},
+	{
+		"metadata": {
+		"name": "myapp-deployment-1376141578.14b0d3c1a2b3c4d6",
+		"namespace": "myapp-development",
+		"creationTimestamp": "2017-03-30T16:36:44Z"
+		},
+		"involvedObject": {
+		"kind": "ReplicaSet",
+		"namespace": "myapp-development",
+		"name": "myapp-deployment-1376141578"
+		},
+		"reason": "SuccessfulCreate",
+		"message": "Created pod: myapp-deployment-1376141578-c2sw6",
+		"source": {
+		"component": "replicaset-controller"
+		},
+		"firstTimestamp": "2017-03-30T16:36:44Z",
+		"lastTimestamp": "2017-03-30T16:36:44Z",
+		"count": 1,
+		"type": "Normal"
+	},
+	{
+		"metadata": {
+		"name": "myapp-deployment-1376141578-9q2hx.14b0d3c1a2b3c4d7",
+		"namespace": "myapp-development",
+		"creationTimestamp": "2017-03-30T16:39:21Z"
+		},
+		"involvedObject": {
+		"kind": "Pod",
+		"namespace": "myapp-development",
+		"name": "myapp-deployment-1376141578-9q2hx"
+		},
+		"reason": "Scheduled",
+		"message": "Successfully assigned myapp-deployment-1376141578-9q2hx to ip-1-2-3-4.internal",
+		"source": {
+		"component": "default-scheduler"
+		},
+		"firstTimestamp": null,
+		"lastTimestamp": null,
+		"count": 1,
+		"type": "Normal"
+	},
+	{
+		"metadata": {
+		"name": "myapp-deployment-1376141578-c2sw6.14b0d3c1a2b3c4d8",
+		"namespace": "myapp-development",
+		"creationTimestamp": "2017-03-30T16:39:30Z"
+		},
+		"involvedObject": {
+		"kind": "Pod",
+		"namespace": "myapp-development",
+		"name": "myapp-deployment-1376141578-c2sw6",
+		"fieldPath": "spec.containers{myapp-container}"
+		},
+		"reason": "Failed",
+		"message": "Failed to pull image \"artifactory.myorg.com:5010/myapp-docker-image:3362ff29\": not found",
+		"source": {
+		"component": "kubelet",
+		"host": "ip-1-2-3-4.internal"
+		},
+		"firstTimestamp": "2017-03-30T16:39:30Z",
+		"lastTimestamp": "2017-03-30T16:39:30Z",
+		"count": 3,
+		"type": "Warning"
+	},
+	{
+		"metadata": {
+		"name": "otherapp-deployment.14b0d3c1a2b3c4d9",
+		"namespace": "myapp-development",
+		"creationTimestamp": "2017-03-30T16:40:00Z"
+		},
+		"involvedObject": {
+		"kind": "Deployment",
+		"namespace": "myapp-development",
+		"name": "otherapp-deployment"
+		},
+		"reason": "ScalingReplicaSet",
+		"message": "Scaled up replica set otherapp-deployment-2841141579 to 1",
+		"source": {
+		"component": "deployment-controller"
+		},
+		"firstTimestamp": "2017-03-30T16:40:00Z",
+		"lastTimestamp": "2017-03-30T16:40:00Z",
+		"count": 1,
+		"type": "Normal"
+	}
+	]
+}
+`
@@ -0,0 +1,175 @@
+package deploy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreezeWindow is a single calendar period with no deploys, e.g. over the holidays.
+type FreezeWindow struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// RecurringFreezeWindow is a freeze that starts on a cron schedule and lasts for Duration,
+// e.g. `0 15 * * 5` for 66 hours freezes from Friday 3pm until Monday 9am.
+// Schedules use the standard five fields: minute, hour, day of month, month and day of week.
+type RecurringFreezeWindow struct {
+	Name     string
+	Schedule string
+	Duration time.Duration
+	// Location the schedule is in. Defaults to UTC.
+	Location *time.Location
+}
+
+// FreezePolicy denies deploys during any of its freeze windows.
+type FreezePolicy struct {
+	Windows          []FreezeWindow
+	RecurringWindows []RecurringFreezeWindow
+}
+
+// Evaluate checks the deploy time is outside every freeze window
+func (p *FreezePolicy) Evaluate(req DeployRequest) *PolicyViolation {
+	for _, window := range p.Windows {
+		if !req.Time.Before(window.Start) && req.Time.Before(window.End) {
+			return &PolicyViolation{
+				Rule:   "freeze",
+				Reason: fmt.Sprintf("deploys are frozen for %s until %s", window.Name, window.End.Format(time.RFC3339)),
+			}
+		}
+	}
+
+	for _, window := range p.RecurringWindows {
+		active, err := window.activeAt(req.Time)
+		if err != nil {
+			return &PolicyViolation{Rule: "freeze", Reason: err.Error()}
+		}
+		if active {
+			return &PolicyViolation{
+				Rule:   "freeze",
+				Reason: fmt.Sprintf("deploys are frozen for %s", window.Name),
+			}
+		}
+	}
+	return nil
+}
+
+// activeAt looks back over Duration for a minute the schedule started a freeze
+func (w *RecurringFreezeWindow) activeAt(now time.Time) (bool, error) {
+	schedule, err := parseCronSchedule(w.Schedule)
+	if err != nil {
+		return false, err
+	}
+
+	location := w.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	now = now.In(location)
+	minute := now.Truncate(time.Minute)
+	for start := minute; now.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if schedule.matches(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cronSchedule holds the allowed values of each cron field
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	anyDay, anyWeekday                     bool
+}
+
+// parseCronSchedule parses `minute hour day-of-month month day-of-week`, where each field
+// is `*`, a number, a range `a-b`, a step `*/n` or `a-b/n`, or a comma separated list of those.
+func parseCronSchedule(raw string) (*cronSchedule, error) {
+	fields := strings.Fields(raw)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron schedule %q needs 5 fields", raw)
+	}
+
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	values := make([]map[int]bool, 5)
+	for i, field := range fields {
+		v, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron schedule %q: %s", raw, err.Error())
+		}
+		values[i] = v
+	}
+
+	return &cronSchedule{
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   values[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if s := strings.SplitN(part, "/", 2); len(s) == 2 {
+			n, err := strconv.Atoi(s[1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part, step = s[0], n
+		}
+
+		low, high := min, max
+		if part != "*" {
+			r := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(r[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = n, n
+			if len(r) == 2 {
+				high, err = strconv.Atoi(r[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches follows cron in allowing either day field to match when both are restricted
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+
+	day := s.days[t.Day()]
+	weekday := s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
@@ -0,0 +1,226 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RevisionAnnotation is set by Kubernetes on each ReplicaSet of a Deployment, numbering its revisions
+const RevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Revision is one version of a deployment's pod template, kept by Kubernetes as a ReplicaSet.
+type Revision struct {
+	Number   int64     `json:"revision"`
+	Name     string    `json:"name"`
+	Image    string    `json:"image"`
+	Created  time.Time `json:"created"`
+	Replicas int       `json:"replicas"`
+}
+
+// RevisionHistory represents any Deployer that can list the earlier versions of its deployment
+type RevisionHistory interface {
+	History() ([]Revision, error)
+}
+
+// DeploymentGetter represents any Deployer that can retrieve its deployment, e.g. to check on a rollout
+type DeploymentGetter interface {
+	Get() (*Deployment, error)
+}
+
+// History lists the revisions of the deployment, newest first.
+// Kubernetes only keeps as many as the deployment's revisionHistoryLimit.
+func (d *KubernetesDeployer) History() ([]Revision, error) {
+	if d.Endpoint == "" || d.Namespace == "" {
+		return nil, fmt.Errorf("missing Endpoint or Namespace information")
+	}
+
+	url := fmt.Sprintf("https://%s/apis/extensions/v1beta1/namespaces/%s/replicasets", d.Endpoint, d.Namespace)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.send(d.context(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, newAPIError(res, d.Namespace)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSetList := &replicaSetList{}
+	err = json.Unmarshal(body, replicaSetList)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisionsOf(replicaSetList.Items, d.DeploymentName, d.ContainerName), nil
+}
+
+// revisionsOf lists the revisions of the named deployment among replicaSets, newest first
+func revisionsOf(replicaSets []replicaSet, deploymentName string, containerName string) []Revision {
+	revisions := []Revision{}
+	for _, replicaSet := range replicaSets {
+		if !replicaSet.ownedBy(deploymentName) {
+			continue
+		}
+		number, err := strconv.ParseInt(replicaSet.Metadata.Annotations[RevisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, Revision{
+			Number:   number,
+			Name:     replicaSet.Metadata.Name,
+			Image:    replicaSet.containerImage(containerName),
+			Created:  replicaSet.Metadata.CreationTimestamp,
+			Replicas: replicaSet.Status.Replicas,
+		})
+	}
+
+	sort.Slice(revisions, func(a, b int) bool {
+		return revisions[a].Number > revisions[b].Number
+	})
+	return revisions
+}
+
+// GetDeployment retrieves the deployment, e.g. to check on its rollout
+func (n *KubernetesClusterNamespace) GetDeployment() (*Deployment, error) {
+	if n.cached() {
+		deployment, ok := n.Cache.Deployment(n.deploymentName())
+		if !ok {
+			return nil, fmt.Errorf("deployment %s not found", n.deploymentName())
+		}
+		return deployment, nil
+	}
+	getter, ok := n.DeployMaker.(DeploymentGetter)
+	if !ok {
+		return nil, fmt.Errorf("deployer cannot retrieve its deployment")
+	}
+	return getter.Get()
+}
+
+// History lists the revisions of the deployment, newest first
+func (n *KubernetesClusterNamespace) History() ([]Revision, error) {
+	if n.cached() {
+		return n.Cache.Revisions(n.deploymentName(), n.containerName()), nil
+	}
+	history, ok := n.DeployMaker.(RevisionHistory)
+	if !ok {
+		return nil, fmt.Errorf("deployer has no revision history")
+	}
+	return history.History()
+}
+
+// Rollback deploys the image of an earlier revision again. Revision zero means the one before the current revision.
+// Rollbacks run hooks and are audited, but skip policies: the image has already been live.
+func (n *KubernetesClusterNamespace) Rollback(req DeployRequest, revision int64) error {
+	if n.DeployMaker == nil {
+		return fmt.Errorf("missing DeployMaker")
+	}
+
+	revisions, err := n.History()
+	if err != nil {
+		return err
+	}
+
+	target, err := findRevision(revisions, revision)
+	if err != nil {
+		return err
+	}
+
+	req.Tag = imageReference(target.Image)
+	req.Image = target.Image
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+
+	ctx, span, deployer := n.startDeploySpan("rollback", req, n.DeployMaker)
+	span.SetAttribute("deploy.revision", target.Number)
+	record := n.newAuditRecord(AuditActionRollback, req, deployer)
+	err = n.audit(record, func() error {
+		return n.runHooks(ctx, req, deployer, func(deployer Deployer) error {
+			return deployer.Deploy(req.Tag)
+		})
+	})
+	endSpan(span, err)
+	return err
+}
+
+// findRevision picks the numbered revision, or the one before the newest for zero
+func findRevision(revisions []Revision, revision int64) (*Revision, error) {
+	if revision == 0 {
+		if len(revisions) < 2 {
+			return nil, fmt.Errorf("no previous revision to roll back to")
+		}
+		return &revisions[1], nil
+	}
+
+	for i := range revisions {
+		if revisions[i].Number == revision {
+			return &revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d not found", revision)
+}
+
+// imageReference is the tag or digest of a full image name, e.g. `abc123` or `sha256:056d...`
+func imageReference(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// replicaSetList holds a Kubernetes ReplicaSetList.
+type replicaSetList struct {
+	Items []replicaSet `json:"items"`
+}
+
+// replicaSet is the part of a Kubernetes ReplicaSet needed to describe a revision.
+type replicaSet struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		CreationTimestamp time.Time         `json:"creationTimestamp"`
+		Annotations       map[string]string `json:"annotations"`
+		OwnerReferences   []OwnerReference  `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec   DeploymentSpec `json:"spec"`
+	Status struct {
+		Replicas int `json:"replicas"`
+	} `json:"status"`
+}
+
+// ownedBy is true when the ReplicaSet belongs to the named Deployment
+func (r *replicaSet) ownedBy(deploymentName string) bool {
+	for _, owner := range r.Metadata.OwnerReferences {
+		if owner.Kind == "Deployment" && owner.Name == deploymentName {
+			return true
+		}
+	}
+	return false
+}
+
+// containerImage is the image of the named container in the ReplicaSet's pod template
+func (r *replicaSet) containerImage(containerName string) string {
+	for _, container := range r.Spec.Template.Spec.Containers {
+		if container.Name == containerName {
+			return container.Image
+		}
+	}
+	return ""
+}
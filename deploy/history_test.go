@@ -0,0 +1,112 @@
+package deploy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	cluster := &MockHistoryCluster{}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	revisions, err := mockKubernetesDeployer(server).History()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(revisions))
+	assert.Equal(t, int64(3), revisions[0].Number)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ccc333", revisions[0].Image)
+	assert.Equal(t, 2, revisions[0].Replicas)
+	assert.Equal(t, "myapp-deployment-1", revisions[2].Name)
+}
+
+func TestRollbackToPreviousRevision(t *testing.T) {
+	cluster := &MockHistoryCluster{}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	auditor := &MockAuditor{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockKubernetesDeployer(server),
+		Auditor:     auditor,
+		Policies:    []DeployPolicy{&TagPatternPolicy{Pattern: regexp.MustCompile("^v")}},
+	}
+
+	err := clusterNamespace.Rollback(DeployRequest{User: "alice"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image@sha256:bbb222", cluster.patched)
+	assert.Equal(t, AuditActionRollback, auditor.records[0].Action)
+	assert.Equal(t, "alice", auditor.records[0].User)
+	assert.Equal(t, AuditResultSuccess, auditor.records[0].Result)
+}
+
+func TestRollbackToRevision(t *testing.T) {
+	cluster := &MockHistoryCluster{}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: mockKubernetesDeployer(server)}
+
+	assert.Nil(t, clusterNamespace.Rollback(DeployRequest{}, 1))
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:aaa111", cluster.patched)
+
+	assert.EqualError(t, clusterNamespace.Rollback(DeployRequest{}, 7), "revision 7 not found")
+}
+
+func TestRollbackWithoutHistory(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: &MockDeployer{}}
+	assert.EqualError(t, clusterNamespace.Rollback(DeployRequest{}, 0), "deployer has no revision history")
+}
+
+func TestImageReference(t *testing.T) {
+	assert.Equal(t, "abc123", imageReference("artifactory.myorg.com:5010/myapp:abc123"))
+	assert.Equal(t, "sha256:056d", imageReference("artifactory.myorg.com:5010/myapp@sha256:056d"))
+	assert.Equal(t, "latest", imageReference("artifactory.myorg.com:5010/myapp"))
+}
+
+//
+// MOCK DATA
+//
+
+// MockHistoryCluster serves three revisions of myapp-deployment, plus a ReplicaSet of another deployment
+type MockHistoryCluster struct {
+	mutex   sync.Mutex
+	patched string
+}
+
+func (c *MockHistoryCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/replicasets") {
+		w.Write([]byte(mockReplicaSets))
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		raw, _ := ioutil.ReadAll(r.Body)
+		patch := &deploymentPatch{}
+		json.Unmarshal(raw, patch)
+		c.patched = patch.Spec.Template.Spec.Containers[0].Image
+	}
+	w.Write([]byte(`{"metadata":{"name":"myapp-deployment"},"spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}}}`))
+}
+
+const mockReplicaSets = `{"items":[
+	{"metadata":{"name":"myapp-deployment-1","annotations":{"deployment.kubernetes.io/revision":"1"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+	 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:aaa111"}]}}},"status":{"replicas":0}},
+	{"metadata":{"name":"myapp-deployment-3","annotations":{"deployment.kubernetes.io/revision":"3"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+	 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}},"status":{"replicas":2}},
+	{"metadata":{"name":"myapp-deployment-2","annotations":{"deployment.kubernetes.io/revision":"2"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+	 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image@sha256:bbb222"}]}}},"status":{"replicas":0}},
+	{"metadata":{"name":"other-deployment-1","annotations":{"deployment.kubernetes.io/revision":"9"},"ownerReferences":[{"kind":"Deployment","name":"other-deployment"}]},
+	 "spec":{"template":{"spec":{"containers":[{"name":"other-container","image":"other:1"}]}}},"status":{"replicas":1}}
+]}`
@@ -0,0 +1,206 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeployContext is given to each hook, describing the deploy so far.
+type DeployContext struct {
+	Cluster *KubernetesClusterNamespace
+	Request DeployRequest
+	Started time.Time
+	// Context carries the deploy's span, so hooks can start their own with StartSpan.
+	Context context.Context
+	// Deployer is what the deploy patches, e.g. the DeployMaker, bound to the deploy's span when it is a ContextBinder.
+	Deployer Deployer
+	// Patched is when the patch was applied, and zero when it failed.
+	Patched time.Time
+	// Deployment is the deployment once its rollout has finished, when rollout hooks are registered.
+	Deployment *Deployment
+	// Err is why the deploy or its rollout failed, for AfterRolloutFailure hooks.
+	Err error
+}
+
+// DeployHook is a step run around a deploy, e.g. running a migration or warming caches.
+type DeployHook func(ctx *DeployContext) error
+
+// DeployHooks are run in the order they were added. An error from a BeforePatch hook aborts the deploy.
+// Errors from later hooks are returned once every hook has run, but cannot undo the deploy.
+//
+// Rollout hooks only run when the DeployMaker is a RolloutWaiter, such as KubernetesDeployer.
+// The deploy then waits up to RolloutTimeout (default 10 minutes) for the rollout to finish.
+// AfterRollout hooks run once that wait is over, whatever its outcome, but do not make the deploy wait themselves.
+type DeployHooks struct {
+	BeforePatch         []DeployHook
+	AfterPatch          []DeployHook
+	AfterRolloutSuccess []DeployHook
+	AfterRolloutFailure []DeployHook
+	AfterRollout        []DeployHook
+	RolloutTimeout      time.Duration
+	RolloutInterval     time.Duration
+}
+
+// RolloutWaiter represents any Deployer that can wait for its rollout to finish
+type RolloutWaiter interface {
+	WaitForRollout(timeout time.Duration, interval time.Duration) (*Deployment, error)
+}
+
+// DeployAbortedError is returned when a BeforePatch hook stops the deploy.
+type DeployAbortedError struct {
+	Err error
+}
+
+func (e *DeployAbortedError) Error() string {
+	return fmt.Sprintf("deploy aborted by hook: %s", e.Err.Error())
+}
+
+// Unwrap is the error the hook returned
+func (e *DeployAbortedError) Unwrap() error {
+	return e.Err
+}
+
+// runDeploy checks policies and runs hooks around patch, recording the attempt.
+// patch is given the DeployMaker, bound to the deploy's span when it is a ContextBinder.
+func (n *KubernetesClusterNamespace) runDeploy(req DeployRequest, patch func(deployer Deployer) error) error {
+	return n.runDeployTo(n.DeployMaker, req, patch)
+}
+
+// runDeployTo runs a deploy like runDeploy, giving patch target in place of the DeployMaker
+func (n *KubernetesClusterNamespace) runDeployTo(target Deployer, req DeployRequest, patch func(deployer Deployer) error) error {
+	ctx, span, deployer := n.startDeploySpan("deploy", req, target)
+	record := n.newAuditRecord(AuditActionDeploy, req, deployer)
+	err := n.audit(record, func() error {
+		_, policySpan := StartSpan(ctx, "policies")
+		err := n.checkPolicies(req)
+		endSpan(policySpan, err)
+		if err != nil {
+			return err
+		}
+		return n.runHooks(ctx, req, deployer, patch)
+	})
+	endSpan(span, err)
+	return err
+}
+
+// runHooks runs patch between the hooks of each stage, each stage in its own span
+func (n *KubernetesClusterNamespace) runHooks(spanCtx context.Context, req DeployRequest, deployer Deployer, patch func(deployer Deployer) error) error {
+	ctx := &DeployContext{
+		Cluster:  n,
+		Request:  req,
+		Started:  time.Now(),
+		Context:  spanCtx,
+		Deployer: deployer,
+	}
+
+	err := n.runStage(ctx, "hooks.before_patch", func() error {
+		for _, hook := range n.Hooks.BeforePatch {
+			err := hook(ctx)
+			if err != nil {
+				return &DeployAbortedError{Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.Err = n.runStage(ctx, "patch", func() error {
+		return patch(withContext(deployer, ctx.Context))
+	})
+	if ctx.Err != nil {
+		n.runStage(ctx, "hooks.after_rollout_failure", func() error {
+			return runAllHooks(n.Hooks.AfterRolloutFailure, ctx)
+		})
+		return ctx.Err
+	}
+	ctx.Patched = time.Now()
+	hookErr := n.runStage(ctx, "hooks.after_patch", func() error {
+		return runAllHooks(n.Hooks.AfterPatch, ctx)
+	})
+
+	_, ok := deployer.(RolloutWaiter)
+	if !ok || len(n.Hooks.AfterRolloutSuccess)+len(n.Hooks.AfterRolloutFailure) == 0 {
+		return hookErr
+	}
+
+	timeout, interval := n.Hooks.RolloutTimeout, n.Hooks.RolloutInterval
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+
+	ctx.Err = n.runStage(ctx, "rollout.wait", func() error {
+		var err error
+		ctx.Deployment, err = withContext(deployer, ctx.Context).(RolloutWaiter).WaitForRollout(timeout, interval)
+		return err
+	})
+	n.runStage(ctx, "hooks.after_rollout", func() error {
+		return runAllHooks(n.Hooks.AfterRollout, ctx)
+	})
+	if ctx.Err != nil {
+		n.runStage(ctx, "hooks.after_rollout_failure", func() error {
+			return runAllHooks(n.Hooks.AfterRolloutFailure, ctx)
+		})
+		return ctx.Err
+	}
+
+	err = n.runStage(ctx, "hooks.after_rollout_success", func() error {
+		return runAllHooks(n.Hooks.AfterRolloutSuccess, ctx)
+	})
+	if hookErr == nil {
+		hookErr = err
+	}
+	return hookErr
+}
+
+// runStage runs one stage of a deploy in a child span of the deploy's. Hooks run in the stage see its span.
+func (n *KubernetesClusterNamespace) runStage(ctx *DeployContext, name string, stage func() error) error {
+	parent := ctx.Context
+	spanCtx, span := StartSpan(parent, name)
+	ctx.Context = spanCtx
+	err := stage()
+	ctx.Context = parent
+	endSpan(span, err)
+	return err
+}
+
+// withContext binds deployer to ctx, when it is a ContextBinder
+func withContext(deployer Deployer, ctx context.Context) Deployer {
+	if binder, ok := deployer.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return deployer
+}
+
+// podListWithContext binds retriever to ctx, when it is a PodListContextBinder
+func podListWithContext(retriever PodListRetriever, ctx context.Context) PodListRetriever {
+	if binder, ok := retriever.(PodListContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return retriever
+}
+
+// serviceWithContext binds service to ctx, when it is a ServiceContextBinder
+func serviceWithContext(service ServiceSelector, ctx context.Context) ServiceSelector {
+	if binder, ok := service.(ServiceContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return service
+}
+
+// runAllHooks runs every hook even when one fails, returning the first error
+func runAllHooks(hooks []DeployHook, ctx *DeployContext) error {
+	var result error
+	for _, hook := range hooks {
+		err := hook(ctx)
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package deploy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooksRunInOrder(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	calls := []string{}
+	record := func(name string) DeployHook {
+		return func(ctx *DeployContext) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockClusterDeployer(server, cluster),
+		Hooks: DeployHooks{
+			BeforePatch:         []DeployHook{record("migrate"), record("announce")},
+			AfterPatch:          []DeployHook{record("patched")},
+			AfterRolloutSuccess: []DeployHook{record("warm caches")},
+			AfterRolloutFailure: []DeployHook{record("page")},
+			AfterRollout:        []DeployHook{record("rolled out")},
+			RolloutTimeout:      5 * time.Millisecond,
+			RolloutInterval:     time.Millisecond,
+		},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"migrate", "announce", "patched", "rolled out", "warm caches"}, calls)
+}
+
+func TestBeforePatchHookAborts(t *testing.T) {
+	deployer := &MockDeployer{}
+	auditor := &MockAuditor{}
+	after := false
+
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Auditor:     auditor,
+		Hooks: DeployHooks{
+			BeforePatch: []DeployHook{func(ctx *DeployContext) error {
+				return fmt.Errorf("migration %s failed", ctx.Request.Tag)
+			}},
+			AfterPatch: []DeployHook{func(ctx *DeployContext) error {
+				after = true
+				return nil
+			}},
+		},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "deploy aborted by hook: migration abc123 failed")
+	assert.Equal(t, 0, len(deployer.deployed))
+	assert.False(t, after)
+	assert.Equal(t, AuditResultAborted, auditor.records[0].Result)
+}
+
+func TestRolloutFailureHooks(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	cluster.unavailable = "myapp-deployment"
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	var failure, over *DeployContext
+	success := false
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockClusterDeployer(server, cluster),
+		Hooks: DeployHooks{
+			AfterRollout: []DeployHook{func(ctx *DeployContext) error {
+				over = ctx
+				return nil
+			}},
+			AfterRolloutSuccess: []DeployHook{func(ctx *DeployContext) error {
+				success = true
+				return nil
+			}},
+			AfterRolloutFailure: []DeployHook{func(ctx *DeployContext) error {
+				failure = ctx
+				return nil
+			}},
+			RolloutTimeout:  5 * time.Millisecond,
+			RolloutInterval: time.Millisecond,
+		},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "timed out waiting for rollout of myapp-deployment")
+	assert.False(t, success)
+	assert.Equal(t, err, failure.Err)
+	assert.Equal(t, "myapp-deployment", failure.Deployment.Metadata.Name)
+	assert.Equal(t, err, over.Err)
+	assert.False(t, over.Patched.IsZero())
+}
+
+func TestAfterRolloutHooksDoNotWait(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	cluster.unavailable = "myapp-deployment"
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	ran := false
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockClusterDeployer(server, cluster),
+		Hooks: DeployHooks{
+			AfterRollout: []DeployHook{func(ctx *DeployContext) error {
+				ran = true
+				return nil
+			}},
+		},
+	}
+
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.False(t, ran)
+}
+
+func TestPatchFailureRunsFailureHooks(t *testing.T) {
+	failed := false
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{err: fmt.Errorf("received 500")},
+		Hooks: DeployHooks{
+			AfterPatch: []DeployHook{func(ctx *DeployContext) error {
+				t.Error("after patch hook should not run")
+				return nil
+			}},
+			AfterRolloutFailure: []DeployHook{func(ctx *DeployContext) error {
+				failed = true
+				return nil
+			}},
+		},
+	}
+
+	assert.EqualError(t, clusterNamespace.Deploy("abc123"), "received 500")
+	assert.True(t, failed)
+}
+
+func TestAfterPatchHookErrorsAreReturned(t *testing.T) {
+	deployer := &MockDeployer{}
+	second := false
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Hooks: DeployHooks{
+			AfterPatch: []DeployHook{
+				func(ctx *DeployContext) error { return fmt.Errorf("cache warm failed") },
+				func(ctx *DeployContext) error {
+					second = true
+					return nil
+				},
+			},
+		},
+	}
+
+	assert.EqualError(t, clusterNamespace.Deploy("abc123"), "cache warm failed")
+	assert.Equal(t, []string{"abc123"}, deployer.deployed)
+	assert.True(t, second)
+}
+
+func TestRolloutHooksSkippedWithoutRolloutWaiter(t *testing.T) {
+	ran := false
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{},
+		Hooks: DeployHooks{
+			AfterRolloutSuccess: []DeployHook{func(ctx *DeployContext) error {
+				ran = true
+				return nil
+			}},
+		},
+	}
+
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.False(t, ran)
+}
+
+//
+// MOCK DATA
+//
+
+// mockClusterDeployer deploys myapp-deployment, served by the mock cluster with two replicas
+func mockClusterDeployer(server *httptest.Server, cluster *MockBlueGreenCluster) *KubernetesDeployer {
+	cluster.replicas["myapp-deployment"] = 2
+	return mockKubernetesDeployer(server)
+}
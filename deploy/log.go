@@ -0,0 +1,259 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogLevel is how important a log record is. The levels have the values of slog's, so adapters can convert them directly.
+type LogLevel int
+
+// Levels of log records
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// ParseLogLevel reads `debug`, `info`, `warn` or `error`
+func ParseLogLevel(level string) (LogLevel, error) {
+	for _, l := range []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(level, l.String()) {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %s", level)
+}
+
+// Logger writes structured log records, with args as alternating keys and values like slog's.
+// A slog.Logger can be adapted to it:
+//
+//	type slogLogger struct{ *slog.Logger }
+//
+//	func (l slogLogger) Log(level deploy.LogLevel, msg string, args ...interface{}) {
+//		l.Logger.Log(context.Background(), slog.Level(level), msg, args...)
+//	}
+type Logger interface {
+	Log(level LogLevel, msg string, args ...interface{})
+}
+
+// LevelEnabler is a Logger that tells whether it writes records at a level, so records that are costly
+// to build can be skipped. A slog adapter can implement it with slog.Logger's Enabled.
+type LevelEnabler interface {
+	Enabled(level LogLevel) bool
+}
+
+// logEnabled is true when logger writes records at level, which is assumed unless it is a LevelEnabler
+func logEnabled(logger Logger, level LogLevel) bool {
+	enabler, ok := logger.(LevelEnabler)
+	return !ok || enabler.Enabled(level)
+}
+
+// TextLogger writes each record at Level or above as a line of `level=INFO msg="deploy finished" key=value` to Output
+type TextLogger struct {
+	Output *log.Logger
+	Level  LogLevel
+}
+
+// Enabled is true for Level and above
+func (l *TextLogger) Enabled(level LogLevel) bool {
+	return level >= l.Level
+}
+
+// Log writes the record, unless it is below Level
+func (l *TextLogger) Log(level LogLevel, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := []string{"level=" + level.String(), "msg=" + logValue(msg)}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fields = append(fields, "!BADKEY="+logValue(args[i]))
+			break
+		}
+		fields = append(fields, fmt.Sprintf("%v=%s", args[i], logValue(args[i+1])))
+	}
+	l.Output.Println(strings.Join(fields, " "))
+}
+
+// logValue quotes values with spaces, quotes or equals signs, so the line can be parsed again
+func logValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// maxLoggedBody is how much of a body is kept in logs and an APIError
+const maxLoggedBody = 1024
+
+// APIError is a Kubernetes API call answered with an unexpected status code. The call and the start
+// of the response body are kept to log.
+type APIError struct {
+	Method     string
+	URL        string
+	Namespace  string
+	StatusCode int
+	Body       string
+}
+
+// Error names the call and its namespace, e.g. `GET https://.../deployments/myapp in namespace myapp: received 404`
+func (e *APIError) Error() string {
+	call := strings.TrimSpace(e.Method + " " + e.URL)
+	if e.Namespace != "" {
+		call = strings.TrimSpace(call + " in namespace " + e.Namespace)
+	}
+	if call == "" {
+		return fmt.Sprintf("received %v", e.StatusCode)
+	}
+	return fmt.Sprintf("%s: received %v", call, e.StatusCode)
+}
+
+// newAPIError describes the call res answered, reading the start of its body. Callers still close res.Body.
+func newAPIError(res *http.Response, namespace string) *APIError {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxLoggedBody))
+	err := &APIError{Namespace: namespace, StatusCode: res.StatusCode, Body: string(body)}
+	if res.Request != nil {
+		err.Method, err.URL = res.Request.Method, res.Request.URL.String()
+	}
+	return err
+}
+
+// LoggingTransport is an http.RoundTripper logging each call at debug level, with its headers and the
+// start of its bodies. The Authorization header is redacted. Calls that fail or receive an error status are logged as warnings.
+type LoggingTransport struct {
+	// Transport sends each call, defaulting to http.DefaultTransport
+	Transport http.RoundTripper
+	Logger    Logger
+}
+
+// RoundTrip sends the request, logging it and its response
+func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if logEnabled(t.Logger, LevelDebug) {
+		t.Logger.Log(LevelDebug, "kubernetes api request", "method", req.Method, "url", req.URL.String(),
+			"headers", redactedHeaders(req.Header), "body", requestBody(req))
+	}
+	started := time.Now()
+	res, err := transport.RoundTrip(req)
+	duration := time.Since(started)
+	if err != nil {
+		t.Logger.Log(LevelWarn, "kubernetes api call failed", "method", req.Method, "url", req.URL.String(),
+			"duration", duration, "error", err.Error())
+		return res, err
+	}
+
+	level := LevelDebug
+	if res.StatusCode >= 400 {
+		level = LevelWarn
+	}
+	if !logEnabled(t.Logger, level) {
+		return res, nil
+	}
+	t.Logger.Log(level, "kubernetes api response", "method", req.Method, "url", req.URL.String(),
+		"status", res.StatusCode, "duration", duration, "body", responseBody(req, res))
+	return res, nil
+}
+
+// redactedHeaders writes the headers as `Name: value` pairs, sorted, with the token left out
+func redactedHeaders(header http.Header) string {
+	pairs := []string{}
+	for name, values := range header {
+		value := strings.Join(values, ",")
+		if name == "Authorization" {
+			value = "REDACTED"
+		}
+		pairs = append(pairs, name+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "; ")
+}
+
+// requestBody is the start of the request body, read from a copy so the request can still send it
+func requestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	raw, _ := ioutil.ReadAll(io.LimitReader(body, maxLoggedBody))
+	return string(raw)
+}
+
+// responseBody is the start of the response body, which is put back for the caller to read.
+// Watch streams are left alone, as they do not end.
+func responseBody(req *http.Request, res *http.Response) string {
+	if req.URL.Query().Get("watch") == "true" {
+		return ""
+	}
+	raw, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+	if len(raw) > maxLoggedBody {
+		raw = raw[:maxLoggedBody]
+	}
+	return string(raw)
+}
+
+// log writes a record with the Logger of the cluster namespace, when it has one
+func (n *KubernetesClusterNamespace) log(level LogLevel, msg string, args ...interface{}) {
+	if n.Logger != nil {
+		n.Logger.Log(level, msg, args...)
+	}
+}
+
+// logDeploy logs how a deploy or rollback attempt ended, with the details of any API call that failed it
+func (n *KubernetesClusterNamespace) logDeploy(record DeployAuditRecord, duration time.Duration, err error) {
+	result := AuditResult(err)
+	args := []interface{}{"action", record.Action, "environment", n.Description, "namespace", record.Namespace,
+		"deployment", record.Deployment, "user", record.User, "image", record.NewImage, "result", result,
+		"duration", duration}
+
+	switch {
+	case err == nil:
+		n.log(LevelInfo, record.Action+" finished", args...)
+	case result == AuditResultFailure:
+		args = append(args, "error", err.Error())
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			args = append(args, "method", apiErr.Method, "url", apiErr.URL, "status", apiErr.StatusCode, "body", apiErr.Body)
+		}
+		n.log(LevelError, record.Action+" finished", args...)
+	default:
+		n.log(LevelWarn, record.Action+" finished", append(args, "error", err.Error())...)
+	}
+}
@@ -0,0 +1,224 @@
+package deploy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingTransportRedactsToken(t *testing.T) {
+	server := httptest.NewTLSServer(&MockHistoryCluster{})
+	defer server.Close()
+
+	logger := &MockLogger{}
+	deployer := mockKubernetesDeployer(server)
+	deployer.Client = &http.Client{Transport: &LoggingTransport{Transport: server.Client().Transport, Logger: logger}}
+
+	deployment, err := deployer.Get()
+	assert.Nil(t, err)
+	// the body was logged and still read by the deployer
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ccc333", deployment.ContainerImage("myapp-container"))
+
+	assert.Equal(t, 2, len(logger.records))
+	request, response := logger.records[0], logger.records[1]
+	assert.Equal(t, LevelDebug, request.level)
+	assert.Equal(t, "kubernetes api request", request.msg)
+	assert.Equal(t, "GET", request.args["method"])
+	assert.Equal(t, "Authorization: REDACTED", request.args["headers"])
+	assert.Equal(t, LevelDebug, response.level)
+	assert.Equal(t, 200, response.args["status"])
+	assert.Contains(t, response.args["body"], `"name":"myapp-deployment"`)
+	for _, record := range logger.records {
+		assert.False(t, bytes.Contains([]byte(fmt.Sprint(record.args)), []byte("token")))
+	}
+}
+
+func TestLoggingTransportLogsPatchBody(t *testing.T) {
+	server := httptest.NewTLSServer(&MockHistoryCluster{})
+	defer server.Close()
+
+	logger := &MockLogger{}
+	deployer := mockKubernetesDeployer(server)
+	deployer.Client = &http.Client{Transport: &LoggingTransport{Transport: server.Client().Transport, Logger: logger}}
+
+	err := deployer.Deploy("abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, "PATCH", logger.records[0].args["method"])
+	assert.Contains(t, logger.records[0].args["body"], `"image":"artifactory.myorg.com:5010/myapp-docker-image:abc123"`)
+}
+
+func TestLoggingTransportWarnsOnErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	logger := &MockLogger{}
+	client := &http.Client{Transport: &LoggingTransport{Transport: server.Client().Transport, Logger: logger}}
+
+	res, err := client.Get(server.URL + "/api/v1/namespaces/myapp-development/pods")
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, LevelWarn, logger.records[1].level)
+	assert.Equal(t, 403, logger.records[1].args["status"])
+
+	server.Close()
+	_, err = client.Get(server.URL + "/api/v1/namespaces/myapp-development/pods")
+	assert.NotNil(t, err)
+	assert.Equal(t, LevelWarn, logger.records[3].level)
+	assert.Equal(t, "kubernetes api call failed", logger.records[3].msg)
+}
+
+func TestLoggingTransportSkipsBodiesAboveDebug(t *testing.T) {
+	body := &mockReadCounter{Reader: bytes.NewReader([]byte(`{"items":[]}`))}
+	transport := mockRoundTripper(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: body, Request: req}, nil
+	})
+	out := &bytes.Buffer{}
+	client := &http.Client{Transport: &LoggingTransport{Transport: transport, Logger: &TextLogger{Output: log.New(out, "", 0), Level: LevelInfo}}}
+
+	res, err := client.Get("https://kubernetes/api/v1/namespaces/myapp-development/pods")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, body.reads)
+	raw, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, `{"items":[]}`, string(raw))
+	assert.Equal(t, 0, out.Len())
+}
+
+func TestAPIErrorCarriesRequest(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"kind":"Status","message":"deployments.extensions \"myapp-deployment\" is forbidden"}`))
+	}))
+	defer server.Close()
+
+	_, err := mockKubernetesDeployer(server).Get()
+	assert.Contains(t, err.Error(), "GET https://")
+	assert.Contains(t, err.Error(), "/deployments/myapp-deployment in namespace myapp-development: received 403")
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, "GET", apiErr.Method)
+	assert.Equal(t, server.URL+"/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-deployment", apiErr.URL)
+	assert.Equal(t, "myapp-development", apiErr.Namespace)
+	assert.Contains(t, apiErr.Body, "is forbidden")
+
+	_, err = mockPodListRetriever(server).PodInformation()
+	apiErr, ok = err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+}
+
+func TestDeployIsLogged(t *testing.T) {
+	logger := &MockLogger{}
+	deployer := &MockDeployer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		Description:    "staging",
+		DeploymentName: "myapp-deployment",
+		DeployMaker:    deployer,
+		Logger:         logger,
+	}
+
+	err := clusterNamespace.DeployWithRequest(DeployRequest{Tag: "abc123", User: "alice"})
+	assert.Nil(t, err)
+	record := logger.records[0]
+	assert.Equal(t, LevelInfo, record.level)
+	assert.Equal(t, "deploy finished", record.msg)
+	assert.Equal(t, "staging", record.args["environment"])
+	assert.Equal(t, "alice", record.args["user"])
+	assert.Equal(t, AuditResultSuccess, record.args["result"])
+
+	deployer.err = &APIError{Method: "PATCH", URL: "https://kubernetes/apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment", StatusCode: 422, Body: "invalid"}
+	err = clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "PATCH https://kubernetes/apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment: received 422")
+	record = logger.records[1]
+	assert.Equal(t, LevelError, record.level)
+	assert.Equal(t, AuditResultFailure, record.args["result"])
+	assert.Equal(t, "PATCH", record.args["method"])
+	assert.Equal(t, "invalid", record.args["body"])
+
+	deployer.err = fmt.Errorf("rollout: %w", &APIError{Method: "GET", StatusCode: 500, Body: "unavailable"})
+	clusterNamespace.Deploy("abc123")
+	record = logger.records[2]
+	assert.Equal(t, AuditResultFailure, record.args["result"])
+	assert.Equal(t, 500, record.args["status"])
+	assert.Equal(t, "unavailable", record.args["body"])
+}
+
+func TestTextLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := &TextLogger{Output: log.New(out, "", 0), Level: LevelInfo}
+
+	logger.Log(LevelDebug, "kubernetes api request", "method", "GET")
+	logger.Log(LevelInfo, "deploy finished", "environment", "staging", "error", `hook said "no"`, "image", "")
+	logger.Log(LevelError, "odd", "key")
+
+	lines, _ := ioutil.ReadAll(out)
+	assert.Equal(t, `level=INFO msg="deploy finished" environment=staging error="hook said \"no\"" image=""
+level=ERROR msg=odd !BADKEY=key
+`, string(lines))
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("debug")
+	assert.Nil(t, err)
+	assert.Equal(t, LevelDebug, level)
+	level, err = ParseLogLevel("WARN")
+	assert.Nil(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLogLevel("loud")
+	assert.EqualError(t, err, "unknown log level loud")
+}
+
+//
+// MOCK DATA
+//
+
+// MockLogger keeps every record, with its args as a map
+type MockLogger struct {
+	mutex   sync.Mutex
+	records []mockLogRecord
+}
+
+// mockReadCounter counts the reads of a body
+type mockReadCounter struct {
+	io.Reader
+	reads int
+}
+
+func (r *mockReadCounter) Read(p []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(p)
+}
+
+func (r *mockReadCounter) Close() error {
+	return nil
+}
+
+type mockRoundTripper func(req *http.Request) (*http.Response, error)
+
+func (f mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type mockLogRecord struct {
+	level LogLevel
+	msg   string
+	args  map[string]interface{}
+}
+
+func (l *MockLogger) Log(level LogLevel, msg string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	record := mockLogRecord{level: level, msg: msg, args: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		record.args[fmt.Sprint(args[i])] = args[i+1]
+	}
+	l.records = append(l.records, record)
+}
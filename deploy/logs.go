@@ -0,0 +1,33 @@
+package deploy
+
+import "fmt"
+
+// PodLogs holds the logs of one pod.
+type PodLogs struct {
+	Pod  string `json:"pod"`
+	Logs string `json:"logs"`
+}
+
+// GetPodLogs retrieves the logs of a container in each pod of the deployment.
+// tailLines limits each pod to its most recent lines, unless it is zero.
+func (n *KubernetesClusterNamespace) GetPodLogs(containerName string, tailLines int) ([]PodLogs, error) {
+	logRetriever, ok := n.PodRetriever.(PodLogRetriever)
+	if !ok {
+		return nil, fmt.Errorf("pod retriever cannot retrieve logs")
+	}
+
+	podList, err := n.GetPodList()
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []PodLogs{}
+	for _, pod := range podList.Items {
+		raw, err := logRetriever.PodLogs(pod.Metadata.Name, containerName, tailLines)
+		if err != nil {
+			return logs, fmt.Errorf("unable to retrieve logs of %s: %s", pod.Metadata.Name, err.Error())
+		}
+		logs = append(logs, PodLogs{Pod: pod.Metadata.Name, Logs: raw})
+	}
+	return logs, nil
+}
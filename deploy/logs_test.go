@@ -0,0 +1,69 @@
+package deploy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPodLogs(t *testing.T) {
+	queries := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/pods") {
+			w.Write([]byte(`{"items":[{"metadata":{"name":"myapp-deployment-1-aaaaa"}},{"metadata":{"name":"other-deployment-1-bbbbb"}}]}`))
+			return
+		}
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		w.Write([]byte("started\nlistening on :8080\n"))
+	}))
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeploymentName: "myapp-deployment",
+		PodRetriever:   mockPodListRetriever(server),
+	}
+	logs, err := clusterNamespace.GetPodLogs("myapp-container", 50)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []PodLogs{{Pod: "myapp-deployment-1-aaaaa", Logs: "started\nlistening on :8080\n"}}, logs)
+	assert.Equal(t, []string{"/api/v1/namespaces/myapp-development/pods/myapp-deployment-1-aaaaa/log?container=myapp-container&tailLines=50"}, queries)
+}
+
+func TestGetPodLogsWhenRetrievalFails(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/pods") {
+			w.Write([]byte(`{"items":[{"metadata":{"name":"myapp-deployment-1-aaaaa"}}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{PodRetriever: mockPodListRetriever(server)}
+	_, err := clusterNamespace.GetPodLogs("", 0)
+
+	assert.Contains(t, err.Error(), "unable to retrieve logs of myapp-deployment-1-aaaaa: GET https://")
+	assert.Contains(t, err.Error(), "/pods/myapp-deployment-1-aaaaa/log? in namespace myapp-development: received 400")
+}
+
+func TestGetPodLogsUnsupported(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{PodRetriever: &MockPodList{}}
+	_, err := clusterNamespace.GetPodLogs("", 0)
+	assert.EqualError(t, err, "pod retriever cannot retrieve logs")
+}
+
+//
+// MOCK DATA
+//
+
+func mockPodListRetriever(server *httptest.Server) *KubernetesPodListRetriever {
+	return &KubernetesPodListRetriever{
+		Client:             server.Client(),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		BearerTokenService: &MockBearerToken{},
+	}
+}
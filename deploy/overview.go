@@ -0,0 +1,150 @@
+package deploy
+
+import "sort"
+
+// OverviewAPIVersion is the apiVersion of every DeploymentOverview. Fields may be added within
+// a version, but renaming or removing one, or changing its meaning, needs a new version.
+// The JSON Schema for this version is schema/deployment-overview.v1.json.
+const OverviewAPIVersion = "kubernetes-deploy/v1"
+
+// OverviewKind is the kind of every DeploymentOverview
+const OverviewKind = "DeploymentOverview"
+
+// DeploymentOverview is the machine readable status of a deployment and its pods, for CI scripts and other tools.
+type DeploymentOverview struct {
+	APIVersion  string         `json:"apiVersion"`
+	Kind        string         `json:"kind"`
+	Description string         `json:"description,omitempty"`
+	Deployment  string         `json:"deployment,omitempty"`
+	Rollout     *RolloutStatus `json:"rollout,omitempty"`
+	Summary     PodSummary     `json:"summary"`
+	Pods        []PodItem      `json:"pods"`
+}
+
+// RolloutStatus is how far a deployment's rollout has got.
+type RolloutStatus struct {
+	Deployment        string `json:"deployment"`
+	Image             string `json:"image,omitempty"`
+	DesiredReplicas   int    `json:"desiredReplicas"`
+	UpdatedReplicas   int    `json:"updatedReplicas"`
+	ReadyReplicas     int    `json:"readyReplicas"`
+	AvailableReplicas int    `json:"availableReplicas"`
+	Complete          bool   `json:"complete"`
+	Failed            bool   `json:"failed"`
+}
+
+// PodSummary adds up a group of pods.
+type PodSummary struct {
+	Total    int `json:"total"`
+	Ready    int `json:"ready"`
+	Restarts int `json:"restarts"`
+	// Tags counts the pods running each tag, e.g. two tags part way through a rollout.
+	Tags []TagCount `json:"tags"`
+	// Waiting counts the pods waiting for each reason, e.g. ImagePullBackOff.
+	Waiting []ReasonCount `json:"waiting"`
+}
+
+// TagCount is how many pods run a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// ReasonCount is how many pods are waiting for the same reason.
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// NewDeploymentOverview summarises the pods of a deployment
+func NewDeploymentOverview(deploymentName string, pods []PodItem) *DeploymentOverview {
+	if pods == nil {
+		pods = []PodItem{}
+	}
+	return &DeploymentOverview{
+		APIVersion: OverviewAPIVersion,
+		Kind:       OverviewKind,
+		Deployment: deploymentName,
+		Summary:    SummarisePods(pods),
+		Pods:       pods,
+	}
+}
+
+// NewRolloutStatus summarises the rollout of a deployment, including the image of the named container
+func NewRolloutStatus(deployment *Deployment, containerName string) *RolloutStatus {
+	return &RolloutStatus{
+		Deployment:        deployment.Metadata.Name,
+		Image:             deployment.ContainerImage(containerName),
+		DesiredReplicas:   deployment.DesiredReplicas(),
+		UpdatedReplicas:   deployment.Status.UpdatedReplicas,
+		ReadyReplicas:     deployment.Status.ReadyReplicas,
+		AvailableReplicas: deployment.Status.AvailableReplicas,
+		Complete:          deployment.RolloutComplete(),
+		Failed:            deployment.RolloutFailed(),
+	}
+}
+
+// SummarisePods counts ready pods and restarts, and groups pods by tag and waiting reason.
+// Tags and reasons are listed most common first.
+func SummarisePods(pods []PodItem) PodSummary {
+	summary := PodSummary{Tags: []TagCount{}, Waiting: []ReasonCount{}}
+	tags, reasons := map[string]int{}, map[string]int{}
+
+	for _, pod := range pods {
+		summary.Total++
+		summary.Restarts += pod.Restarts
+		if pod.Ready {
+			summary.Ready++
+		}
+		tags[pod.Tag]++
+		if pod.Reason != "" {
+			reasons[pod.Reason]++
+		}
+	}
+
+	for tag, count := range tags {
+		summary.Tags = append(summary.Tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(summary.Tags, func(a, b int) bool {
+		if summary.Tags[a].Count != summary.Tags[b].Count {
+			return summary.Tags[a].Count > summary.Tags[b].Count
+		}
+		return summary.Tags[a].Tag < summary.Tags[b].Tag
+	})
+
+	for reason, count := range reasons {
+		summary.Waiting = append(summary.Waiting, ReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(summary.Waiting, func(a, b int) bool {
+		if summary.Waiting[a].Count != summary.Waiting[b].Count {
+			return summary.Waiting[a].Count > summary.Waiting[b].Count
+		}
+		return summary.Waiting[a].Reason < summary.Waiting[b].Reason
+	})
+	return summary
+}
+
+// GetOverview describes the pods of the deployment and, when the deployer can retrieve it, its rollout
+func (n *KubernetesClusterNamespace) GetOverview() (*DeploymentOverview, error) {
+	podList, err := n.GetPodList()
+	if err != nil {
+		return nil, err
+	}
+
+	overview := NewDeploymentOverview(n.DeploymentName, podList.Overview())
+	overview.Description = n.Description
+
+	if _, ok := n.DeployMaker.(DeploymentGetter); !ok && !n.cached() {
+		return overview, nil
+	}
+	deployment, err := n.GetDeployment()
+	if err != nil {
+		return nil, err
+	}
+
+	overview.Rollout = NewRolloutStatus(deployment, n.containerName())
+	if overview.Deployment == "" {
+		overview.Deployment = deployment.Metadata.Name
+	}
+	return overview, nil
+}
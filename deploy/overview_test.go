@@ -0,0 +1,154 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarisePods(t *testing.T) {
+	summary := SummarisePods([]PodItem{
+		{Tag: "bbb222", Ready: true},
+		{Tag: "aaa111", Ready: true, Restarts: 2},
+		{Tag: "bbb222", Reason: "ImagePullBackOff", Restarts: 1},
+		{Tag: "ccc333", Reason: "CrashLoopBackOff"},
+	})
+
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, 2, summary.Ready)
+	assert.Equal(t, 3, summary.Restarts)
+	assert.Equal(t, []TagCount{{"bbb222", 2}, {"aaa111", 1}, {"ccc333", 1}}, summary.Tags)
+	assert.Equal(t, []ReasonCount{{"CrashLoopBackOff", 1}, {"ImagePullBackOff", 1}}, summary.Waiting)
+}
+
+func TestGetOverview(t *testing.T) {
+	cluster := &MockHistoryCluster{}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{
+		Description:  "My Development Cluster",
+		PodRetriever: &MockPodList{},
+		DeployMaker:  mockKubernetesDeployer(server),
+	}
+	overview, err := clusterNamespace.GetOverview()
+
+	assert.Nil(t, err)
+	assert.Equal(t, OverviewAPIVersion, overview.APIVersion)
+	assert.Equal(t, OverviewKind, overview.Kind)
+	assert.Equal(t, "My Development Cluster", overview.Description)
+	assert.Equal(t, "myapp-deployment", overview.Deployment)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ccc333", overview.Rollout.Image)
+	assert.Equal(t, 4, overview.Summary.Total)
+	assert.Equal(t, []ReasonCount{{"ImagePullBackOff", 1}}, overview.Summary.Waiting)
+	assert.Equal(t, 4, len(overview.Pods))
+}
+
+func TestGetOverviewWithoutDeployment(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{DeploymentName: "nothing", PodRetriever: &MockPodList{}, DeployMaker: &MockDeployer{}}
+	overview, err := clusterNamespace.GetOverview()
+
+	assert.Nil(t, err)
+	assert.Nil(t, overview.Rollout)
+	raw, _ := json.Marshal(overview)
+	assert.JSONEq(t, `{"apiVersion":"kubernetes-deploy/v1","kind":"DeploymentOverview","deployment":"nothing",
+		"summary":{"total":0,"ready":0,"restarts":0,"tags":[],"waiting":[]},"pods":[]}`, string(raw))
+}
+
+func TestGetOverviewWhenDeploymentFails(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{PodRetriever: &MockPodList{}, DeployMaker: mockKubernetesDeployer(server)}
+	_, err := clusterNamespace.GetOverview()
+	assert.Contains(t, err.Error(), ": received 403")
+}
+
+func TestOverviewMatchesSchema(t *testing.T) {
+	raw, err := ioutil.ReadFile("../schema/deployment-overview.v1.json")
+	assert.Nil(t, err)
+	schema := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(raw, &schema))
+
+	podList, _ := (&MockPodList{}).PodInformation()
+	overview := NewDeploymentOverview("myapp-deployment", podList.Overview())
+	overview.Description = "My Development Cluster"
+	deployment := &Deployment{Metadata: DeploymentMetadata{Name: "myapp-deployment"}}
+	overview.Rollout = NewRolloutStatus(deployment, "myapp-container")
+
+	for _, value := range []*DeploymentOverview{overview, NewDeploymentOverview("", nil)} {
+		encoded, _ := json.Marshal(value)
+		var document interface{}
+		json.Unmarshal(encoded, &document)
+		assert.Nil(t, checkSchema(schema, schema, document, "$"))
+	}
+}
+
+// checkSchema checks the parts of JSON Schema used by schema/*.json: $ref, const, type, required
+// and properties. Unlike JSON Schema, every field must be documented in properties.
+func checkSchema(root map[string]interface{}, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		definition := root["definitions"].(map[string]interface{})[strings.TrimPrefix(ref, "#/definitions/")]
+		return checkSchema(root, definition.(map[string]interface{}), value, path)
+	}
+	if expected, ok := schema["const"]; ok && expected != value {
+		return fmt.Errorf("%s is %v, not %v", path, value, expected)
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", path)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, field := range object {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s is not in the schema", path, name)
+			}
+			err := checkSchema(root, property, field, path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an array", path)
+		}
+		for i, item := range items {
+			err := checkSchema(root, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s is not a string", path)
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s is not an integer", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", path)
+		}
+	}
+	return nil
+}
@@ -7,15 +7,27 @@ import (
 
 // PodList holds a Kubernetes PodList.
 type PodList struct {
-	Items []PodMetadataContainer `json:"items"`
+	Metadata ListMetadata           `json:"metadata"`
+	Items    []PodMetadataContainer `json:"items"`
 }
 
-// PodItem is an app specific summary status coming back from pods
+// ListMetadata is part of every Kubernetes list. Continue is set when there are more items to retrieve.
+type ListMetadata struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Continue        string `json:"continue,omitempty"`
+}
+
+// PodItem is an app specific summary status coming back from pods.
+// Its JSON field names are part of OverviewAPIVersion.
 type PodItem struct {
-	Name    string
-	Status  string
-	Created time.Time
-	Tag     string
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Reason   string    `json:"reason,omitempty"`
+	Tag      string    `json:"tag"`
+	Digest   string    `json:"digest,omitempty"`
+	Ready    bool      `json:"ready"`
+	Restarts int       `json:"restarts"`
+	Created  time.Time `json:"created"`
 }
 
 // Overview for a group of pods in a deployment
@@ -23,24 +35,31 @@ func (p *PodList) Overview() []PodItem {
 	var metadata []PodItem
 
 	for _, item := range p.Items {
-		tag := ""
+		pod := PodItem{
+			Name:    item.Metadata.Name,
+			Status:  item.Status.Phase,
+			Created: item.Metadata.CreationTimestamp,
+		}
 		// an Evicted pod for example, will not have any ContainerStatuses
 		if item.Status.ContainerStatuses != nil {
-			tag = formatPodImage(item.Status.ContainerStatuses[0].Image)
+			container := item.Status.ContainerStatuses[0]
+			pod.Tag = formatPodImage(container.Image)
+			pod.Digest = formatPodDigest(container.ImageID)
+			pod.Ready = container.Ready
+			pod.Restarts = container.RestartCount
+			if container.State.Waiting != nil {
+				pod.Reason = container.State.Waiting.Reason
+			}
 		}
 
-		metadata = append(metadata, PodItem{
-			Name:    item.Metadata.Name,
-			Status:  item.Status.Phase,
-			Created: item.Metadata.CreationTimestamp,
-			Tag:     tag,
-		})
+		metadata = append(metadata, pod)
 	}
 	return metadata
 }
 
 // FilterByDeployment returns a new PodList with only deployment names that match prefix.
 // Handy for only retrieving specific deployment when running multiple deployments in same namespace.
+// A prefix of `myapp-` matches the pods of a `myapp-canary` deployment too, which PodsOfDeployment does not.
 func (p *PodList) FilterByDeployment(namePrefix string) *PodList {
 	pods := []PodMetadataContainer{}
 
@@ -54,6 +73,28 @@ func (p *PodList) FilterByDeployment(namePrefix string) *PodList {
 	}
 }
 
+// PodsOfDeployment returns a new PodList with only the pods of the deployment's ReplicaSets,
+// matching what NamespaceCache.PodsOfDeployment finds by owner references.
+func (p *PodList) PodsOfDeployment(deploymentName string) *PodList {
+	pods := []PodMetadataContainer{}
+
+	for _, item := range p.Items {
+		if isReplicaSetOf(podReplicaSet(item), deploymentName) {
+			pods = append(pods, item)
+		}
+	}
+	return &PodList{
+		Items: pods,
+	}
+}
+
+// isReplicaSetOf is true when the ReplicaSet is named `<deployment>-<pod-template-hash>`, as Kubernetes
+// names those it creates for a deployment. The hash never has a dash, so `myapp-canary-5d8f` is not one of myapp's.
+func isReplicaSetOf(replicaSetName string, deploymentName string) bool {
+	hash := strings.TrimPrefix(replicaSetName, deploymentName+"-")
+	return hash != replicaSetName && hash != "" && !strings.Contains(hash, "-")
+}
+
 // formatPodImage converts a full pod image name into only the docker image and commit hash
 func formatPodImage(raw string) (result string) {
 	s := strings.Split(raw, ":")
@@ -63,6 +104,15 @@ func formatPodImage(raw string) (result string) {
 	return
 }
 
+// formatPodDigest converts a pod imageID into only the image digest, e.g. `sha256:056d...`
+func formatPodDigest(imageID string) string {
+	s := strings.SplitN(imageID, "@", 2)
+	if len(s) == 2 {
+		return s[1]
+	}
+	return ""
+}
+
 // PodMetadataContainer houses PodMetadataDetail values.
 type PodMetadataContainer struct {
 	Metadata PodMetadataDetail `json:"metadata"`
@@ -71,8 +121,15 @@ type PodMetadataContainer struct {
 
 // PodMetadataDetail has details about an individual Kubernetes Pod.
 type PodMetadataDetail struct {
-	Name              string    `json:"name"`
-	CreationTimestamp time.Time `json:"creationTimestamp"`
+	Name              string           `json:"name"`
+	CreationTimestamp time.Time        `json:"creationTimestamp"`
+	OwnerReferences   []OwnerReference `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference names the object that created another, e.g. the ReplicaSet of a Pod.
+type OwnerReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
 }
 
 // PodContainerStatusesStateRunning is part of PodList response coming back from Kubernetes
@@ -93,8 +150,11 @@ type PodContainerStatusesState struct {
 
 //PodContainerStatuses used for determining what state the container is in.
 type PodContainerStatuses struct {
-	State PodContainerStatusesState `json:"state"`
-	Image string                    `json:"image,omitempty"`
+	State        PodContainerStatusesState `json:"state"`
+	Ready        bool                      `json:"ready"`
+	RestartCount int                       `json:"restartCount"`
+	Image        string                    `json:"image,omitempty"`
+	ImageID      string                    `json:"imageID,omitempty"`
 }
 
 // PodStatus has details about what state the Pod is in.
@@ -27,12 +27,16 @@ func TestPodListOverview(t *testing.T) {
 	assert.Equal(t, "myapp-deployment-1376141578-9q2hx", pod.Name)
 	assert.Equal(t, "Running", pod.Status)
 	assert.Equal(t, "40716241027b9639db1f1067d5ea3b25087dd12e", pod.Tag)
+	assert.Equal(t, "sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683", pod.Digest)
+	assert.True(t, pod.Ready)
+	assert.Equal(t, 0, pod.Restarts)
 	timestamp, _ = time.Parse(time.RFC3339, "2017-03-30T16:39:21Z")
 	assert.Equal(t, timestamp, pod.Created)
 
 	pod = overview[1]
 	assert.Equal(t, "myapp-deployment-1376141578-c2sw6", pod.Name)
 	assert.Equal(t, "Running", pod.Status)
+	assert.Equal(t, "ImagePullBackOff", pod.Reason)
 	assert.Equal(t, "40716241027b9639db1f1067d5ea3b25087dd12e", pod.Tag)
 	timestamp, _ = time.Parse(time.RFC3339, "2017-03-30T16:36:44Z")
 	assert.Equal(t, timestamp, pod.Created)
@@ -65,10 +69,26 @@ func TestPodListNoContainerStatus(t *testing.T) {
 	assert.Equal(t, "myapp-deployment-1376141578-9q2hx", pod.Name)
 	assert.Equal(t, "Failed", pod.Status)
 	assert.Equal(t, "", pod.Tag)
+	assert.Equal(t, "", pod.Digest)
+	assert.False(t, pod.Ready)
 	timestamp, _ = time.Parse(time.RFC3339, "2017-03-30T16:39:21Z")
 	assert.Equal(t, timestamp, pod.Created)
 }
 
+func TestGetPodListFiltersByDeploymentName(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeploymentName: "otherapp-deployment",
+		PodRetriever:   &MockPodList{},
+	}
+
+	podList, _ := clusterNamespace.GetPodList()
+	assert.Equal(t, 0, len(podList.Items))
+
+	clusterNamespace.DeploymentName = "myapp-deployment"
+	podList, _ = clusterNamespace.GetPodList()
+	assert.Equal(t, 4, len(podList.Items))
+}
+
 func TestPodListFilterByDeployment_WithMatch(t *testing.T) {
 	clusterNamespace := &KubernetesClusterNamespace{
 		PodRetriever: &MockPodListWithoutContainerStatuses{},
@@ -92,6 +112,26 @@ func TestPodListFilterByDeployment_NoMatch(t *testing.T) {
 	assert.Equal(t, 0, len(filteredPodList.Items))
 }
 
+func TestPodListPodsOfDeploymentLeavesOutCanary(t *testing.T) {
+	owned := mockRunningPod("myapp-5d8f9c-x1", "artifactory.myorg.com:5010/myapp:abc123")
+	owned.Metadata.OwnerReferences = []OwnerReference{{Kind: KindReplicaSet, Name: "myapp-6e9a0d"}}
+	podList := &PodList{Items: []PodMetadataContainer{
+		mockRunningPod("myapp-5d8f9c-a1", "artifactory.myorg.com:5010/myapp:abc123"),
+		mockRunningPod("myapp-canary-7f1b2e-b2", "artifactory.myorg.com:5010/myapp:def456"),
+		mockRunningPod("myapp-worker-8a2c3f-c3", "artifactory.myorg.com:5010/myapp:abc123"),
+		owned,
+	}}
+
+	pods := podList.PodsOfDeployment("myapp")
+	assert.Equal(t, 2, len(pods.Items))
+	assert.Equal(t, "myapp-5d8f9c-a1", pods.Items[0].Metadata.Name)
+	assert.Equal(t, "myapp-5d8f9c-x1", pods.Items[1].Metadata.Name)
+
+	canary := podList.PodsOfDeployment("myapp-canary")
+	assert.Equal(t, 1, len(canary.Items))
+	assert.Equal(t, "myapp-canary-7f1b2e-b2", canary.Items[0].Metadata.Name)
+}
+
 //
 // MOCK DATA
 //
@@ -0,0 +1,158 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DeployRequest describes a single deploy, so policies can decide whether it may go ahead.
+type DeployRequest struct {
+	Tag string
+	// Image is the full image name, filled in from the DeployMaker when it implements ImageNamer.
+	Image string
+	// User is who asked for the deploy, and Approvals are who approved it.
+	User      string
+	Approvals []string
+	// Time of the deploy. Defaults to now.
+	Time time.Time
+	// Context carries any trace of the request that asked for the deploy, so its span is the parent of the deploy's.
+	// Only its values are used: the deploy carries on when it is cancelled.
+	Context context.Context
+}
+
+// ImageNamer represents any struct that knows the full image name it will deploy for a tag
+type ImageNamer interface {
+	ImageName(tagOrDigest string) string
+}
+
+// DeployPolicy represents any rule that is checked before deploying. Evaluate returns nil when the deploy is allowed.
+type DeployPolicy interface {
+	Evaluate(req DeployRequest) *PolicyViolation
+}
+
+// PolicyViolation is a single rule a deploy broke.
+type PolicyViolation struct {
+	Rule   string
+	Reason string
+}
+
+// PolicyDeniedError is returned instead of deploying when any policy is violated.
+type PolicyDeniedError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyDeniedError) Error() string {
+	reasons := []string{}
+	for _, violation := range e.Violations {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", violation.Rule, violation.Reason))
+	}
+	return fmt.Sprintf("deploy denied by policy (%s)", strings.Join(reasons, "; "))
+}
+
+// TagPatternPolicy only allows tags matching Pattern, e.g. full 40 character commit hashes.
+type TagPatternPolicy struct {
+	Pattern *regexp.Regexp
+}
+
+// Evaluate checks the tag matches the pattern
+func (p *TagPatternPolicy) Evaluate(req DeployRequest) *PolicyViolation {
+	if p.Pattern.MatchString(req.Tag) {
+		return nil
+	}
+	return &PolicyViolation{
+		Rule:   "tag-pattern",
+		Reason: fmt.Sprintf("tag %q does not match %s", req.Tag, p.Pattern.String()),
+	}
+}
+
+// SemanticVersionPolicy only allows tags that are semantic versions within Range,
+// e.g. `>=1.2.0 <2.0.0`, `^1.2.0`, `~1.2.0` or alternatives joined by `||`.
+type SemanticVersionPolicy struct {
+	Range string
+}
+
+// Evaluate checks the tag is a version within the range
+func (p *SemanticVersionPolicy) Evaluate(req DeployRequest) *PolicyViolation {
+	versionRange, err := parseSemanticVersionRange(p.Range)
+	if err != nil {
+		return &PolicyViolation{Rule: "semver", Reason: err.Error()}
+	}
+
+	version, err := parseSemanticVersion(req.Tag)
+	if err != nil {
+		return &PolicyViolation{Rule: "semver", Reason: err.Error()}
+	}
+	if !versionRange.contains(version) {
+		return &PolicyViolation{
+			Rule:   "semver",
+			Reason: fmt.Sprintf("version %s is outside %s", req.Tag, p.Range),
+		}
+	}
+	return nil
+}
+
+// ApprovalPolicy requires a number of approvals from people other than whoever asked for the deploy.
+// It trusts the User and Approvals of the request, so the caller must have authenticated each of them,
+// as the server package does. Never fill Approvals from names the user asking for the deploy typed in.
+type ApprovalPolicy struct {
+	Required int
+}
+
+// Evaluate counts distinct approvals, ignoring self-approval
+func (p *ApprovalPolicy) Evaluate(req DeployRequest) *PolicyViolation {
+	approvers := map[string]bool{}
+	for _, approver := range req.Approvals {
+		if approver != "" && approver != req.User {
+			approvers[approver] = true
+		}
+	}
+
+	if len(approvers) < p.Required {
+		return &PolicyViolation{
+			Rule:   "approvals",
+			Reason: fmt.Sprintf("%d of %d required approvals", len(approvers), p.Required),
+		}
+	}
+	return nil
+}
+
+// RegistryPolicy only allows images from the listed registries, e.g. `artifactory.myorg.com:5010`.
+type RegistryPolicy struct {
+	Registries []string
+}
+
+// Evaluate checks the image comes from an allowed registry
+func (p *RegistryPolicy) Evaluate(req DeployRequest) *PolicyViolation {
+	if req.Image == "" {
+		return &PolicyViolation{Rule: "registry", Reason: "image name is unknown"}
+	}
+
+	registry, _ := splitImage(req.Image)
+	for _, allowed := range p.Registries {
+		if registry == allowed {
+			return nil
+		}
+	}
+	return &PolicyViolation{
+		Rule:   "registry",
+		Reason: fmt.Sprintf("registry %s is not allowed", registry),
+	}
+}
+
+// checkPolicies evaluates every policy of the cluster namespace against the request
+func (n *KubernetesClusterNamespace) checkPolicies(req DeployRequest) error {
+	violations := []PolicyViolation{}
+	for _, policy := range n.Policies {
+		if violation := policy.Evaluate(req); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyDeniedError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package deploy
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployDeniedByPolicies(t *testing.T) {
+	deployer := &MockDeployer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Policies: []DeployPolicy{
+			&TagPatternPolicy{Pattern: regexp.MustCompile(`^[0-9a-f]{40}$`)},
+			&ApprovalPolicy{Required: 2},
+		},
+	}
+
+	err := clusterNamespace.DeployWithRequest(DeployRequest{Tag: "latest", User: "alice", Approvals: []string{"alice", "bob"}})
+
+	assert.EqualError(t, err, `deploy denied by policy (tag-pattern: tag "latest" does not match ^[0-9a-f]{40}$; approvals: 1 of 2 required approvals)`)
+	denied := err.(*PolicyDeniedError)
+	assert.Equal(t, 2, len(denied.Violations))
+	assert.Equal(t, "tag-pattern", denied.Violations[0].Rule)
+	assert.Equal(t, "approvals", denied.Violations[1].Rule)
+	assert.Equal(t, 0, len(deployer.deployed))
+}
+
+func TestDeployAllowedByPolicies(t *testing.T) {
+	deployer := &MockDeployer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: deployer,
+		Policies: []DeployPolicy{
+			&TagPatternPolicy{Pattern: regexp.MustCompile(`^[0-9a-f]{40}$`)},
+			&ApprovalPolicy{Required: 1},
+		},
+	}
+
+	err := clusterNamespace.DeployWithRequest(DeployRequest{
+		Tag:       "40716241027b9639db1f1067d5ea3b25087dd12e",
+		User:      "alice",
+		Approvals: []string{"bob"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"40716241027b9639db1f1067d5ea3b25087dd12e"}, deployer.deployed)
+}
+
+func TestRegistryPolicyUsesDeployerImage(t *testing.T) {
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockKubernetesDeployer(server),
+		Policies:    []DeployPolicy{&RegistryPolicy{Registries: []string{"docker.myorg.com"}}},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "deploy denied by policy (registry: registry artifactory.myorg.com:5010 is not allowed)")
+	assert.Equal(t, 0, len(*patches))
+
+	clusterNamespace.Policies = []DeployPolicy{&RegistryPolicy{Registries: []string{"artifactory.myorg.com:5010"}}}
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.Equal(t, 1, len(*patches))
+}
+
+func TestSemanticVersionPolicy(t *testing.T) {
+	policy := &SemanticVersionPolicy{Range: ">=1.2.0 <2.0.0 || ^3.1.0"}
+
+	for _, tag := range []string{"1.2.0", "v1.9.9", "3.1.0", "3.5.2"} {
+		assert.Nil(t, policy.Evaluate(DeployRequest{Tag: tag}), tag)
+	}
+	for _, tag := range []string{"1.1.9", "2.0.0", "1.2.0-rc.1", "4.0.0"} {
+		violation := policy.Evaluate(DeployRequest{Tag: tag})
+		assert.Equal(t, &PolicyViolation{Rule: "semver", Reason: "version " + tag + " is outside >=1.2.0 <2.0.0 || ^3.1.0"}, violation)
+	}
+
+	violation := policy.Evaluate(DeployRequest{Tag: "40716241"})
+	assert.Equal(t, &PolicyViolation{Rule: "semver", Reason: `"40716241" is not a semantic version`}, violation)
+}
+
+func TestSemanticVersionTildeRange(t *testing.T) {
+	policy := &SemanticVersionPolicy{Range: "~1.4.2"}
+	assert.Nil(t, policy.Evaluate(DeployRequest{Tag: "1.4.9"}))
+	assert.NotNil(t, policy.Evaluate(DeployRequest{Tag: "1.5.0"}))
+	assert.NotNil(t, policy.Evaluate(DeployRequest{Tag: "1.4.1"}))
+}
+
+func TestFreezePolicyCalendarWindow(t *testing.T) {
+	start := time.Date(2018, 12, 21, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	policy := &FreezePolicy{Windows: []FreezeWindow{{Name: "holidays", Start: start, End: end}}}
+
+	violation := policy.Evaluate(DeployRequest{Time: time.Date(2018, 12, 24, 10, 0, 0, 0, time.UTC)})
+	assert.Equal(t, &PolicyViolation{Rule: "freeze", Reason: "deploys are frozen for holidays until 2019-01-02T00:00:00Z"}, violation)
+	assert.Nil(t, policy.Evaluate(DeployRequest{Time: end}))
+}
+
+func TestFreezePolicyRecurringWindow(t *testing.T) {
+	// Friday 3pm until Monday 9am
+	policy := &FreezePolicy{RecurringWindows: []RecurringFreezeWindow{
+		{Name: "weekend", Schedule: "0 15 * * 5", Duration: 66 * time.Hour},
+	}}
+
+	frozen := []time.Time{
+		time.Date(2019, 2, 22, 15, 0, 0, 0, time.UTC),
+		time.Date(2019, 2, 23, 12, 0, 0, 0, time.UTC),
+		time.Date(2019, 2, 25, 8, 59, 0, 0, time.UTC),
+	}
+	for _, at := range frozen {
+		assert.Equal(t, &PolicyViolation{Rule: "freeze", Reason: "deploys are frozen for weekend"}, policy.Evaluate(DeployRequest{Time: at}), at.String())
+	}
+
+	open := []time.Time{
+		time.Date(2019, 2, 22, 14, 59, 0, 0, time.UTC),
+		time.Date(2019, 2, 25, 9, 0, 0, 0, time.UTC),
+	}
+	for _, at := range open {
+		assert.Nil(t, policy.Evaluate(DeployRequest{Time: at}), at.String())
+	}
+}
+
+func TestFreezePolicyInvalidSchedule(t *testing.T) {
+	policy := &FreezePolicy{RecurringWindows: []RecurringFreezeWindow{{Name: "broken", Schedule: "0 25 * * *", Duration: time.Hour}}}
+
+	violation := policy.Evaluate(DeployRequest{Time: time.Now()})
+	assert.Equal(t, &PolicyViolation{Rule: "freeze", Reason: `cron schedule "0 25 * * *": "25" is outside 0-23`}, violation)
+}
+
+func TestCronSchedule(t *testing.T) {
+	schedule, err := parseCronSchedule("*/15 9-17 * 1,6-8 1-5")
+	assert.Nil(t, err)
+
+	assert.True(t, schedule.matches(time.Date(2019, 1, 7, 9, 45, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2019, 1, 7, 9, 40, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2019, 1, 6, 9, 45, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2019, 3, 7, 9, 45, 0, 0, time.UTC)))
+}
+
+func TestPromoteCheckedByTargetPolicies(t *testing.T) {
+	target := &MockImageDeployer{}
+	from := &KubernetesClusterNamespace{Description: "staging", PodRetriever: &MockPodList{}}
+	to := &KubernetesClusterNamespace{
+		Description: "production",
+		DeployMaker: target,
+		Policies:    []DeployPolicy{&ApprovalPolicy{Required: 1}},
+	}
+
+	_, err := Promote(from, to)
+	assert.EqualError(t, err, "deploy denied by policy (approvals: 0 of 1 required approvals)")
+	assert.Equal(t, "", target.deployed)
+}
@@ -0,0 +1,90 @@
+package deploy
+
+import (
+	"fmt"
+)
+
+// Annotations recorded on the target deployment by Promote
+const (
+	PromotedFromAnnotation   = "kubernetes-deploy/promoted-from"
+	PromotedToAnnotation     = "kubernetes-deploy/promoted-to"
+	PromotedTagAnnotation    = "kubernetes-deploy/promoted-tag"
+	PromotedDigestAnnotation = "kubernetes-deploy/promoted-digest"
+)
+
+// Promotion describes the image that Promote moved from one environment to the next.
+type Promotion struct {
+	From   string
+	To     string
+	Tag    string
+	Digest string
+}
+
+// Promote deploys the image running in one environment to another, e.g. staging to production.
+// Every pod in from must be running and ready with the same image, otherwise nothing is deployed.
+// The image is deployed by digest when the pods report one and to supports ImageDeployer.
+// The policies and hooks of to apply just as they would to Deploy.
+func Promote(from, to *KubernetesClusterNamespace) (*Promotion, error) {
+	podList, err := from.GetPodList()
+	if err != nil {
+		return nil, err
+	}
+
+	promotion, err := runningImage(podList)
+	if err != nil {
+		return nil, fmt.Errorf("unable to promote from %s: %s", from.Description, err.Error())
+	}
+	promotion.From = from.Description
+	promotion.To = to.Description
+
+	if to.DeployMaker == nil {
+		return nil, fmt.Errorf("missing DeployMaker")
+	}
+	req := to.completeRequest(DeployRequest{Tag: promotion.Tag})
+	err = to.runDeploy(req, func(deployer Deployer) error {
+		imageDeployer, ok := deployer.(ImageDeployer)
+		if !ok {
+			return deployer.Deploy(promotion.Tag)
+		}
+
+		tagOrDigest := promotion.Tag
+		if promotion.Digest != "" {
+			tagOrDigest = promotion.Digest
+		}
+		return imageDeployer.DeployImage(tagOrDigest, map[string]string{
+			PromotedFromAnnotation:   promotion.From,
+			PromotedToAnnotation:     promotion.To,
+			PromotedTagAnnotation:    promotion.Tag,
+			PromotedDigestAnnotation: promotion.Digest,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// runningImage finds the single image every pod is healthy on
+func runningImage(podList *PodList) (*Promotion, error) {
+	overview := podList.Overview()
+	if len(overview) == 0 {
+		return nil, fmt.Errorf("no pods found")
+	}
+
+	promotion := &Promotion{
+		Tag:    overview[0].Tag,
+		Digest: overview[0].Digest,
+	}
+	for _, pod := range overview {
+		if pod.Status != "Running" || !pod.Ready {
+			return nil, fmt.Errorf("pod %s is %s and not ready", pod.Name, pod.Status)
+		}
+		if pod.Tag == "" || pod.Tag != promotion.Tag {
+			return nil, fmt.Errorf("pods are running mixed tags %q and %q", promotion.Tag, pod.Tag)
+		}
+		if pod.Digest != promotion.Digest {
+			return nil, fmt.Errorf("pods are running mixed digests %q and %q", promotion.Digest, pod.Digest)
+		}
+	}
+	return promotion, nil
+}
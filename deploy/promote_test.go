@@ -0,0 +1,94 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromoteByDigest(t *testing.T) {
+	target := &MockImageDeployer{}
+	from := &KubernetesClusterNamespace{Description: "staging", PodRetriever: &MockPodList{}}
+	to := &KubernetesClusterNamespace{Description: "production", DeployMaker: target}
+
+	promotion, err := Promote(from, to)
+	assert.Nil(t, err)
+
+	digest := "sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683"
+	assert.Equal(t, "40716241027b9639db1f1067d5ea3b25087dd12e", promotion.Tag)
+	assert.Equal(t, digest, promotion.Digest)
+	assert.Equal(t, digest, target.deployed)
+	assert.Equal(t, map[string]string{
+		PromotedFromAnnotation:   "staging",
+		PromotedToAnnotation:     "production",
+		PromotedTagAnnotation:    "40716241027b9639db1f1067d5ea3b25087dd12e",
+		PromotedDigestAnnotation: digest,
+	}, target.annotations)
+}
+
+func TestPromoteFallsBackToTag(t *testing.T) {
+	target := &MockDeployer{}
+	from := &KubernetesClusterNamespace{Description: "staging", PodRetriever: &MockPodList{}}
+	to := &KubernetesClusterNamespace{Description: "production", DeployMaker: target}
+
+	_, err := Promote(from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"40716241027b9639db1f1067d5ea3b25087dd12e"}, target.deployed)
+}
+
+func TestPromoteRefusesUnhealthyPods(t *testing.T) {
+	target := &MockImageDeployer{}
+	from := &KubernetesClusterNamespace{Description: "staging", PodRetriever: &MockPodListWithoutContainerStatuses{}}
+	to := &KubernetesClusterNamespace{Description: "production", DeployMaker: target}
+
+	promotion, err := Promote(from, to)
+	assert.Nil(t, promotion)
+	assert.EqualError(t, err, "unable to promote from staging: pod myapp-deployment-1376141578-9q2hx is Failed and not ready")
+	assert.Equal(t, "", target.deployed)
+}
+
+func TestPromoteRefusesMixedTags(t *testing.T) {
+	podList := &PodList{Items: []PodMetadataContainer{
+		mockRunningPod("myapp-deployment-1-a", "artifactory.myorg.com:5010/myapp-docker-image:aaa"),
+		mockRunningPod("myapp-deployment-2-b", "artifactory.myorg.com:5010/myapp-docker-image:bbb"),
+	}}
+
+	_, err := runningImage(podList)
+	assert.EqualError(t, err, `pods are running mixed tags "aaa" and "bbb"`)
+}
+
+func TestPromoteRefusesEmptyDeployment(t *testing.T) {
+	_, err := runningImage(&PodList{})
+	assert.EqualError(t, err, "no pods found")
+}
+
+//
+// MOCK DATA
+//
+
+type MockImageDeployer struct {
+	deployed    string
+	annotations map[string]string
+}
+
+func (d *MockImageDeployer) Deploy(containerTag string) error {
+	return d.DeployImage(containerTag, nil)
+}
+
+func (d *MockImageDeployer) DeployImage(tagOrDigest string, annotations map[string]string) error {
+	d.deployed = tagOrDigest
+	d.annotations = annotations
+	return nil
+}
+
+func mockRunningPod(name string, image string) PodMetadataContainer {
+	return PodMetadataContainer{
+		Metadata: PodMetadataDetail{Name: name},
+		Status: PodStatus{
+			Phase: "Running",
+			ContainerStatuses: []PodContainerStatuses{
+				{Ready: true, Image: image},
+			},
+		},
+	}
+}
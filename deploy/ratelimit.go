@@ -0,0 +1,140 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Headers the API server sets to say which API Priority and Fairness flow schema and priority level served a request
+const (
+	FlowSchemaHeader    = "X-Kubernetes-PF-FlowSchema-UID"
+	PriorityLevelHeader = "X-Kubernetes-PF-PriorityLevel-UID"
+)
+
+// Rate limit defaults, matching those of kubectl
+const (
+	DefaultQPS   = 5
+	DefaultBurst = 10
+)
+
+// RateLimiter is a token bucket, allowing QPS calls a second on average and bursts of up to Burst calls.
+// Share one between every client talking to the same API server. A QPS of zero or less does not limit.
+type RateLimiter struct {
+	QPS   float64
+	Burst int
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Wait blocks until the next call may be made, or ctx is done, returning how long it waited
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	delay := l.reserve(time.Now())
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		l.cancel()
+		return 0, ctx.Err()
+	}
+}
+
+// reserve takes a token, returning how long until it is available
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	if l.QPS <= 0 {
+		return 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.QPS
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.QPS * float64(time.Second))
+}
+
+// cancel gives back a token that was reserved but not used
+func (l *RateLimiter) cancel() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tokens++
+}
+
+// APICall describes a call made through a RateLimitTransport: how long it waited for the
+// rate limit, and the flow schema and priority level the API server put it in
+type APICall struct {
+	Method           string
+	Path             string
+	Wait             time.Duration
+	StatusCode       int
+	FlowSchemaUID    string
+	PriorityLevelUID string
+}
+
+// RateLimitTransport is an http.RoundTripper that waits for Limiter before every call.
+// Report, when set, is called after each call, e.g. to log slow waits or count calls per flow schema.
+// Put it inside a RetryTransport so every attempt is limited:
+//
+//	limiter := &deploy.RateLimiter{QPS: 5, Burst: 10}
+//	transport := &deploy.RetryTransport{Transport: &deploy.RateLimitTransport{Limiter: limiter}}
+type RateLimitTransport struct {
+	// Transport sends each call, defaulting to http.DefaultTransport
+	Transport http.RoundTripper
+	Limiter   *RateLimiter
+	Report    func(call APICall)
+}
+
+// RoundTrip waits for the rate limit then sends the request
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var wait time.Duration
+	if t.Limiter != nil {
+		var err error
+		wait, err = t.Limiter.Wait(req.Context())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+
+	if t.Report != nil {
+		call := APICall{Method: req.Method, Path: req.URL.Path, Wait: wait}
+		if res != nil {
+			call.StatusCode = res.StatusCode
+			call.FlowSchemaUID = res.Header.Get(FlowSchemaHeader)
+			call.PriorityLevelUID = res.Header.Get(PriorityLevelHeader)
+		}
+		t.Report(call)
+	}
+	return res, err
+}
@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := &RateLimiter{QPS: 10, Burst: 2}
+	now := time.Date(2017, 3, 30, 16, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), limiter.reserve(now))
+	assert.Equal(t, time.Duration(0), limiter.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, limiter.reserve(now))
+
+	// a second later the bucket is full again, but holds no more than Burst
+	later := now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve(later))
+	assert.Equal(t, time.Duration(0), limiter.reserve(later))
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(later))
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := &RateLimiter{}
+	for i := 0; i < 100; i++ {
+		wait, err := limiter.Wait(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	limiter := &RateLimiter{QPS: 0.001, Burst: 1}
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := limiter.Wait(ctx)
+	assert.Equal(t, context.Canceled, err)
+	// the token is given back
+	assert.True(t, limiter.tokens > -0.5)
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(FlowSchemaHeader, "7f0c1a8e-flowschema")
+		w.Header().Set(PriorityLevelHeader, "3d2b9c4f-prioritylevel")
+		w.Write([]byte(`{"metadata":{"name":"myapp-deployment"}}`))
+	}))
+	defer server.Close()
+
+	calls := []APICall{}
+	mutex := sync.Mutex{}
+	deployer := mockKubernetesDeployer(server)
+	deployer.Client = &http.Client{Transport: &RateLimitTransport{
+		Transport: server.Client().Transport,
+		Limiter:   &RateLimiter{QPS: 100, Burst: 1},
+		Report: func(call APICall) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			calls = append(calls, call)
+		},
+	}}
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := deployer.Get()
+		assert.Nil(t, err)
+	}
+
+	// with one token at a time, the third call cannot start until 20ms after the first
+	assert.True(t, time.Since(started) >= 20*time.Millisecond)
+	assert.Equal(t, 3, len(calls))
+	assert.Equal(t, APICall{
+		Method:           http.MethodGet,
+		Path:             "/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-deployment",
+		StatusCode:       200,
+		FlowSchemaUID:    "7f0c1a8e-flowschema",
+		PriorityLevelUID: "3d2b9c4f-prioritylevel",
+	}, calls[0])
+}
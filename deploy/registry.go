@@ -0,0 +1,192 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ImageDigestAnnotation records the digest a tag resolved to when it was verified before deploying
+const ImageDigestAnnotation = "kubernetes-deploy/image-digest"
+
+// Manifest media types accepted from the registry, newest first
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ImageVerifier represents any struct that can check an image exists before it is deployed,
+// returning the digest the tag currently points at
+type ImageVerifier interface {
+	VerifyImage(image string, tagOrDigest string) (string, error)
+}
+
+// RegistryImageVerifier checks images exist via the Docker Registry HTTP API v2.
+// BearerTokenService is optional, for registries that take a long-lived token to pull, e.g. Artifactory.
+// Registries using token auth, such as Docker Hub, answer with a `WWW-Authenticate: Bearer realm=...` challenge
+// instead. A token is then requested from the realm, with Username and Password when set, and the lookup retried.
+type RegistryImageVerifier struct {
+	Client             *http.Client
+	BearerTokenService BearerTokenRetriever
+	Username           string
+	Password           string
+}
+
+// VerifyImage looks up the manifest for the image tag, e.g. `artifactory.myorg.com:5010/myapp-docker-image` and `40716241`
+func (v *RegistryImageVerifier) VerifyImage(image string, tagOrDigest string) (string, error) {
+	registry, repository := splitImage(image)
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tagOrDigest)
+
+	token := ""
+	if v.BearerTokenService != nil {
+		token = v.BearerTokenService.RetrieveToken()
+	}
+	res, err := v.headManifest(manifestURL, token)
+	if err != nil {
+		return "", err
+	}
+
+	if challenge := parseBearerChallenge(res.Header.Get("WWW-Authenticate")); res.StatusCode == http.StatusUnauthorized && challenge != nil {
+		res.Body.Close()
+		token, err = v.requestToken(challenge, repository)
+		if err != nil {
+			return "", fmt.Errorf("not authorized to read image %s from registry: %s", image, err.Error())
+		}
+		res, err = v.headManifest(manifestURL, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Header.Get("Docker-Content-Digest"), nil
+	case http.StatusNotFound:
+		return "", fmt.Errorf("image %s:%s not found in registry", image, tagOrDigest)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", fmt.Errorf("not authorized to read image %s from registry, received %v", image, res.StatusCode)
+	}
+	return "", fmt.Errorf("registry received %v", res.StatusCode)
+}
+
+// headManifest asks for the manifest, with token when there is one
+func (v *RegistryImageVerifier) headManifest(manifestURL string, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	return v.Client.Do(req)
+}
+
+// registryToken is the token service's answer. Older services send `token`, newer ones `access_token` too.
+type registryToken struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// requestToken asks the realm of a challenge for a token to pull the repository
+func (v *RegistryImageVerifier) requestToken(challenge map[string]string, repository string) (string, error) {
+	realm, err := url.Parse(challenge["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("challenged with invalid realm %q", challenge["realm"])
+	}
+	if v.Username != "" && realm.Scheme != "https" {
+		return "", fmt.Errorf("refusing to send credentials to %s", realm.String())
+	}
+
+	scope := challenge["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+	query := realm.Query()
+	if challenge["service"] != "" {
+		query.Set("service", challenge["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if v.Username != "" {
+		req.SetBasicAuth(v.Username, v.Password)
+	}
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service received %v", res.StatusCode)
+	}
+
+	token := &registryToken{}
+	err = json.NewDecoder(res.Body).Decode(token)
+	if err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("token service returned no token")
+	}
+	return token.Token, nil
+}
+
+// parseBearerChallenge reads the parameters of a `Bearer realm="...",service="...",scope="..."` challenge,
+// returning nil for any other scheme
+func parseBearerChallenge(header string) map[string]string {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil
+	}
+
+	params := map[string]string{}
+	rest := strings.TrimSpace(header[7:])
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = strings.TrimSpace(value)
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return params
+}
+
+// splitImage separates the registry host from the repository. Images without a registry host come from Docker Hub.
+func splitImage(image string) (registry string, repository string) {
+	s := strings.SplitN(image, "/", 2)
+	if len(s) == 2 && (strings.ContainsAny(s[0], ".:") || s[0] == "localhost") {
+		return s[0], s[1]
+	}
+	if len(s) == 1 {
+		return "registry-1.docker.io", "library/" + image
+	}
+	return "registry-1.docker.io", image
+}
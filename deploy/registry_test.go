@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyImage(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+
+	verifier := &RegistryImageVerifier{Client: registry.Client(), BearerTokenService: &MockBearerToken{}}
+	digest, err := verifier.VerifyImage(mockRegistryImage(registry), "40716241027b9639db1f1067d5ea3b25087dd12e")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683", digest)
+}
+
+func TestVerifyImageUnknownTag(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+
+	verifier := &RegistryImageVerifier{Client: registry.Client(), BearerTokenService: &MockBearerToken{}}
+	image := mockRegistryImage(registry)
+	_, err := verifier.VerifyImage(image, "4071624l")
+
+	assert.EqualError(t, err, "image "+image+":4071624l not found in registry")
+}
+
+func TestVerifyImageUnauthorized(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+
+	verifier := &RegistryImageVerifier{Client: registry.Client()}
+	image := mockRegistryImage(registry)
+	_, err := verifier.VerifyImage(image, "40716241027b9639db1f1067d5ea3b25087dd12e")
+
+	assert.EqualError(t, err, "not authorized to read image "+image+" from registry: token service received 401")
+}
+
+func TestVerifyImageAnswersTokenChallenge(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+
+	verifier := &RegistryImageVerifier{Client: registry.Client(), Username: "bot", Password: "secret"}
+	digest, err := verifier.VerifyImage(mockRegistryImage(registry), "40716241027b9639db1f1067d5ea3b25087dd12e")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683", digest)
+
+	_, err = verifier.VerifyImage(mockRegistryImage(registry), "4071624l")
+	assert.EqualError(t, err, "image "+mockRegistryImage(registry)+":4071624l not found in registry")
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+	challenge := parseBearerChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull,push",
+	}, challenge)
+
+	assert.Equal(t, map[string]string{"realm": "https://registry/token", "service": "registry"},
+		parseBearerChallenge(`bearer realm=https://registry/token, service=registry`))
+	assert.Nil(t, parseBearerChallenge(`Basic realm="Registry"`))
+	assert.Nil(t, parseBearerChallenge(""))
+}
+
+func TestDeployerRejectsUnknownTag(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	deployer := mockKubernetesDeployer(server)
+	deployer.ContainerImage = mockRegistryImage(registry)
+	deployer.ImageVerifier = &RegistryImageVerifier{Client: registry.Client(), BearerTokenService: &MockBearerToken{}}
+
+	err := deployer.Deploy("4071624l")
+	assert.EqualError(t, err, "image "+deployer.ContainerImage+":4071624l not found in registry")
+	assert.Equal(t, 0, len(*patches))
+}
+
+func TestDeployerRecordsVerifiedDigest(t *testing.T) {
+	registry := newMockRegistry()
+	defer registry.Close()
+	server, patches := mockPatchServer()
+	defer server.Close()
+
+	deployer := mockKubernetesDeployer(server)
+	deployer.ContainerImage = mockRegistryImage(registry)
+	deployer.ImageVerifier = &RegistryImageVerifier{Client: registry.Client(), BearerTokenService: &MockBearerToken{}}
+
+	err := deployer.Deploy("40716241027b9639db1f1067d5ea3b25087dd12e")
+	assert.Nil(t, err)
+	assert.Contains(t, (*patches)[0], `"kubernetes-deploy/image-digest":"sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683"`)
+	assert.Contains(t, (*patches)[0], deployer.ContainerImage+":40716241027b9639db1f1067d5ea3b25087dd12e")
+}
+
+func TestSplitImage(t *testing.T) {
+	registry, repository := splitImage("artifactory.myorg.com:5010/myapp-docker-image")
+	assert.Equal(t, "artifactory.myorg.com:5010", registry)
+	assert.Equal(t, "myapp-docker-image", repository)
+
+	registry, repository = splitImage("localhost/team/myapp")
+	assert.Equal(t, "localhost", registry)
+	assert.Equal(t, "team/myapp", repository)
+
+	registry, repository = splitImage("team/myapp")
+	assert.Equal(t, "registry-1.docker.io", registry)
+	assert.Equal(t, "team/myapp", repository)
+
+	registry, repository = splitImage("nginx")
+	assert.Equal(t, "registry-1.docker.io", registry)
+	assert.Equal(t, "library/nginx", repository)
+}
+
+//
+// MOCK DATA
+//
+
+// newMockRegistry stands in for a Docker registry holding a single tag of myapp-docker-image.
+// It takes the long-lived token "token", or challenges for one from its token service, which wants bot's password.
+func newMockRegistry() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			query := r.URL.Query()
+			if username != "bot" || password != "secret" || query.Get("service") != "mock-registry" || query.Get("scope") != "repository:myapp-docker-image:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"registry-token","expires_in":300}`))
+			return
+		}
+
+		authorization := r.Header.Get("Authorization")
+		if authorization != "Bearer token" && authorization != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="mock-registry"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodHead || !strings.Contains(r.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.v2+json") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/v2/myapp-docker-image/manifests/40716241027b9639db1f1067d5ea3b25087dd12e" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:056daaa91dbe40676b2a65095ba603d2f1789774b0963546aaa244a79c397683")
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func mockRegistryImage(registry *httptest.Server) string {
+	return strings.TrimPrefix(registry.URL, "https://") + "/myapp-docker-image"
+}
@@ -0,0 +1,49 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartedAtAnnotation is set on the pod template by Restart, the same as `kubectl rollout restart`
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Restarter represents any Deployer that can replace every pod of its deployment without changing the image
+type Restarter interface {
+	Restart() error
+}
+
+// Scaler represents any Deployer that can change the number of replicas of its deployment
+type Scaler interface {
+	Scale(replicas int) error
+}
+
+// Restart replaces every pod in the deployment with a rolling update, keeping the current image
+func (d *KubernetesDeployer) Restart() error {
+	patch := deploymentPatch{}
+	patch.Spec.Template.Metadata = &templateMetadataPatch{
+		Annotations: map[string]string{RestartedAtAnnotation: time.Now().UTC().Format(time.RFC3339)},
+	}
+	return d.patch(patch)
+}
+
+// Restart replaces every pod in the deployment, e.g. to pick up a changed ConfigMap
+func (n *KubernetesClusterNamespace) Restart() error {
+	restarter, ok := n.DeployMaker.(Restarter)
+	if !ok {
+		return fmt.Errorf("deployer cannot restart its deployment")
+	}
+	return restarter.Restart()
+}
+
+// Scale changes the number of replicas in the deployment
+func (n *KubernetesClusterNamespace) Scale(replicas int) error {
+	if replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+	scaler, ok := n.DeployMaker.(Scaler)
+	if !ok {
+		return fmt.Errorf("deployer cannot scale its deployment")
+	}
+	return scaler.Scale(replicas)
+}
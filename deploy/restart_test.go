@@ -0,0 +1,56 @@
+package deploy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestart(t *testing.T) {
+	var method string
+	patch := &deploymentPatch{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		raw, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(raw, patch)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: mockKubernetesDeployer(server)}
+	err := clusterNamespace.Restart()
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, 0, len(patch.Spec.Template.Spec.Containers))
+	restartedAt, err := time.Parse(time.RFC3339, patch.Spec.Template.Metadata.Annotations[RestartedAtAnnotation])
+	assert.Nil(t, err)
+	assert.True(t, time.Since(restartedAt) < time.Minute)
+}
+
+func TestScale(t *testing.T) {
+	var body string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: mockKubernetesDeployer(server)}
+
+	assert.Nil(t, clusterNamespace.Scale(3))
+	assert.JSONEq(t, `{"metadata":{},"spec":{"replicas":3,"template":{"spec":{}}}}`, body)
+	assert.EqualError(t, clusterNamespace.Scale(-1), "replicas must not be negative")
+}
+
+func TestRestartAndScaleUnsupported(t *testing.T) {
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: &MockDeployer{}}
+	assert.EqualError(t, clusterNamespace.Restart(), "deployer cannot restart its deployment")
+	assert.EqualError(t, clusterNamespace.Scale(1), "deployer cannot scale its deployment")
+}
@@ -0,0 +1,138 @@
+package deploy
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry defaults, used when the RetryTransport fields are left at zero
+const (
+	DefaultRetryAttempts  = 4
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+	DefaultRetryMaxDelay  = 10 * time.Second
+)
+
+// RetryTransport is an http.RoundTripper that retries GETs and PATCHes failing with a network error,
+// 429 Too Many Requests or a 5xx status. It waits an exponentially growing, jittered delay between
+// attempts, or as long as the Retry-After header asks, up to MaxDelay. Other requests, such as
+// the POST creating a Job, are only sent once. The http.Client Timeout covers every attempt.
+//
+//	client := &http.Client{Timeout: time.Second * 30, Transport: &deploy.RetryTransport{MaxAttempts: 5}}
+type RetryTransport struct {
+	// Transport sends each attempt, defaulting to http.DefaultTransport
+	Transport   http.RoundTripper
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RoundTrip sends the request, retrying it while it fails transiently and attempts remain
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := t.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	if !retryable(req) {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		// a RoundTripper must not modify the caller's request, so each retry sends a copy with a fresh body
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		res, err := t.transport().RoundTrip(attemptReq)
+		if attempt >= attempts || !transientFailure(res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		delay := t.retryDelay(attempt, res)
+		if res != nil {
+			// the response is dropped, so its connection can be reused for the next attempt
+			res.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryDelay is how long to wait after the given attempt failed, honouring Retry-After
+func (t *RetryTransport) retryDelay(attempt int, res *http.Response) time.Duration {
+	base, max := t.BaseDelay, t.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	if res != nil {
+		if after, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			if after > max {
+				return max
+			}
+			return after
+		}
+	}
+
+	delay := base << uint(attempt-1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	// jitter spreads the retries of many clients, keeping at least half the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (t *RetryTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// retryable is true for requests that can safely be sent again, provided their body can be too.
+// Deploys are PATCHes setting the image, so sending one twice has the same effect as once.
+func retryable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodPatch {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// transientFailure is true for a network error, 429 or 5xx
+func transientFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// retryAfter reads a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
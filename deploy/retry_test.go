@@ -0,0 +1,167 @@
+package deploy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryTransportRetriesTransientFailures(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusBadGateway} {
+		cluster := &MockFlakyCluster{failures: []int{status, status}}
+		server := httptest.NewTLSServer(cluster)
+
+		deployer := mockRetryingDeployer(server, 0)
+		deployment, err := deployer.Get()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "myapp-deployment", deployment.Metadata.Name)
+		assert.Equal(t, 3, len(cluster.requests))
+		server.Close()
+	}
+}
+
+func TestRetryTransportRetriesPatchWithBody(t *testing.T) {
+	cluster := &MockFlakyCluster{failures: []int{http.StatusInternalServerError}}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	err := mockRetryingDeployer(server, 0).Deploy("ddd444")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(cluster.requests))
+	assert.Equal(t, cluster.requests[0], cluster.requests[1])
+	assert.Contains(t, cluster.requests[1], "myapp-docker-image:ddd444")
+}
+
+func TestRetryTransportLeavesRequestAlone(t *testing.T) {
+	cluster := &MockFlakyCluster{failures: []int{http.StatusInternalServerError}}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	transport := &RetryTransport{Transport: server.Client().Transport, BaseDelay: time.Millisecond}
+	req, _ := http.NewRequest(http.MethodPatch, server.URL, strings.NewReader(`{"spec":{}}`))
+	body := req.Body
+	res, err := transport.RoundTrip(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{`{"spec":{}}`, `{"spec":{}}`}, cluster.requests)
+	assert.True(t, req.Body == body)
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	cluster := &MockFlakyCluster{failures: []int{503, 503, 503, 503, 503}}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	_, err := mockRetryingDeployer(server, 2).Get()
+
+	assert.Contains(t, err.Error(), ": received 503")
+	assert.Equal(t, 2, len(cluster.requests))
+}
+
+func TestRetryTransportDoesNotRetry(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		status int
+	}{
+		{http.MethodPost, http.StatusServiceUnavailable},
+		{http.MethodDelete, http.StatusServiceUnavailable},
+		{http.MethodGet, http.StatusNotFound},
+		{http.MethodGet, http.StatusConflict},
+	} {
+		cluster := &MockFlakyCluster{failures: []int{tt.status}}
+		server := httptest.NewTLSServer(cluster)
+
+		client := &http.Client{Transport: &RetryTransport{Transport: server.Client().Transport, BaseDelay: time.Millisecond}}
+		req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader("{}"))
+		res, err := client.Do(req)
+
+		assert.Nil(t, err)
+		assert.Equal(t, tt.status, res.StatusCode)
+		assert.Equal(t, 1, len(cluster.requests))
+		server.Close()
+	}
+}
+
+func TestRetryTransportRetriesNetworkErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// drop the connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"metadata":{"name":"myapp-deployment"}}`))
+	}))
+	defer server.Close()
+
+	_, err := mockRetryingDeployer(server, 0).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRetryDelay(t *testing.T) {
+	transport := &RetryTransport{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: 2 * time.Second} {
+		delay := transport.retryDelay(attempt, nil)
+		assert.True(t, delay >= expected/2 && delay <= expected, "attempt %d waited %s", attempt, delay)
+	}
+
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("Retry-After", "1")
+	assert.Equal(t, time.Second, transport.retryDelay(1, res))
+	res.Header.Set("Retry-After", "120")
+	assert.Equal(t, 2*time.Second, transport.retryDelay(1, res))
+	res.Header.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), transport.retryDelay(1, res))
+	res.Header.Set("Retry-After", "soon")
+	assert.True(t, transport.retryDelay(1, res) <= 100*time.Millisecond)
+}
+
+//
+// MOCK DATA
+//
+
+// MockFlakyCluster answers with each status in failures in turn, then serves myapp-deployment.
+// The body of every request is recorded.
+type MockFlakyCluster struct {
+	mutex    sync.Mutex
+	failures []int
+	requests []string
+}
+
+func (c *MockFlakyCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	raw, _ := ioutil.ReadAll(r.Body)
+	c.requests = append(c.requests, string(raw))
+	if len(c.failures) > 0 {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(c.failures[0])
+		c.failures = c.failures[1:]
+		return
+	}
+	w.Write([]byte(`{"metadata":{"name":"myapp-deployment"}}`))
+}
+
+func mockRetryingDeployer(server *httptest.Server, maxAttempts int) *KubernetesDeployer {
+	deployer := mockKubernetesDeployer(server)
+	deployer.Client = &http.Client{Transport: &RetryTransport{
+		Transport:   server.Client().Transport,
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+	}}
+	return deployer
+}
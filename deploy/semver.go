@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semanticVersion is a parsed `MAJOR.MINOR.PATCH[-prerelease]` version, with an optional leading `v`
+type semanticVersion struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseSemanticVersion parses a tag such as `v1.4.2` or `1.4.2-rc.1`. Build metadata after `+` is ignored.
+func parseSemanticVersion(raw string) (*semanticVersion, error) {
+	s := strings.TrimPrefix(raw, "v")
+	s = strings.SplitN(s, "+", 2)[0]
+
+	version := &semanticVersion{}
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) == 2 {
+		version.prerelease = parts[1]
+	}
+
+	numbers := strings.Split(parts[0], ".")
+	if len(numbers) != 3 {
+		return nil, fmt.Errorf("%q is not a semantic version", raw)
+	}
+	fields := []*int{&version.major, &version.minor, &version.patch}
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a semantic version", raw)
+		}
+		*fields[i] = n
+	}
+	return version, nil
+}
+
+// compare returns -1, 0 or 1. A prerelease sorts before its release.
+func (v *semanticVersion) compare(other *semanticVersion) int {
+	pairs := [][2]int{{v.major, other.major}, {v.minor, other.minor}, {v.patch, other.patch}}
+	for _, pair := range pairs {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	case v.prerelease < other.prerelease:
+		return -1
+	}
+	return 1
+}
+
+// semanticVersionRange matches versions against a range such as `>=1.2.0 <2.0.0`, `^1.2.0`, `~1.2.0`
+// or several of those joined by `||`. Comparators separated by spaces must all match.
+type semanticVersionRange [][]versionComparator
+
+type versionComparator struct {
+	operator string
+	version  *semanticVersion
+}
+
+// parseSemanticVersionRange parses a range, expanding `^` and `~` into a pair of comparators
+func parseSemanticVersionRange(raw string) (semanticVersionRange, error) {
+	versionRange := semanticVersionRange{}
+
+	for _, alternative := range strings.Split(raw, "||") {
+		comparators := []versionComparator{}
+		for _, field := range strings.Fields(alternative) {
+			operator := strings.TrimRight(field, "v0123456789.-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+			version, err := parseSemanticVersion(field[len(operator):])
+			if err != nil {
+				return nil, err
+			}
+
+			switch operator {
+			case "^":
+				upper := &semanticVersion{major: version.major + 1}
+				if version.major == 0 {
+					upper = &semanticVersion{minor: version.minor + 1}
+				}
+				comparators = append(comparators, versionComparator{">=", version}, versionComparator{"<", upper})
+			case "~":
+				upper := &semanticVersion{major: version.major, minor: version.minor + 1}
+				comparators = append(comparators, versionComparator{">=", version}, versionComparator{"<", upper})
+			case "", "=", ">", ">=", "<", "<=":
+				comparators = append(comparators, versionComparator{operator, version})
+			default:
+				return nil, fmt.Errorf("unknown operator %q in version range %q", operator, raw)
+			}
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("empty version range %q", raw)
+		}
+		versionRange = append(versionRange, comparators)
+	}
+	return versionRange, nil
+}
+
+// contains is true when the version matches every comparator of any alternative
+func (r semanticVersionRange) contains(version *semanticVersion) bool {
+	for _, comparators := range r {
+		matched := true
+		for _, comparator := range comparators {
+			if !comparator.matches(version) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c versionComparator) matches(version *semanticVersion) bool {
+	result := version.compare(c.version)
+	switch c.operator {
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return result == 0
+}
@@ -0,0 +1,124 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Tracer starts spans. The tracing package adapts an OpenTelemetry tracer to it.
+//
+// The span of a deploy is a child of any span in the Context of its DeployRequest,
+// such as the span of the bot request that asked for it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one timed step of a trace
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// ContextBinder represents any Deployer whose API calls can be made within a context, e.g. to trace them
+type ContextBinder interface {
+	WithContext(ctx context.Context) Deployer
+}
+
+// PodListContextBinder represents any PodListRetriever whose API calls can be made within a context
+type PodListContextBinder interface {
+	WithContext(ctx context.Context) PodListRetriever
+}
+
+// ServiceContextBinder represents any ServiceSelector whose API calls can be made within a context
+type ServiceContextBinder interface {
+	WithContext(ctx context.Context) ServiceSelector
+}
+
+type tracerKey struct{}
+
+// ContextWithTracer returns a copy of ctx carrying tracer, so that StartSpan records spans with it
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// StartSpan starts a span with the tracer ctx carries. Without one, the span records nothing.
+// Hooks can use it with the Context of their DeployContext.
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracer, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok || tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name)
+}
+
+// endSpan records err, if any, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
+
+// TracingTransport is an http.RoundTripper recording a span for each call made within a traced context,
+// with its method, path and status code. Calls outside a trace are sent as they are.
+type TracingTransport struct {
+	// Transport sends each call, defaulting to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// RoundTrip sends the request within a span
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	ctx, span := StartSpan(req.Context(), "HTTP "+req.Method)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.path", req.URL.Path)
+	span.SetAttribute("server.address", req.URL.Host)
+	res, err := transport.RoundTrip(req.WithContext(ctx))
+	if res != nil {
+		span.SetAttribute("http.response.status_code", res.StatusCode)
+	}
+	endSpan(span, err)
+	return res, err
+}
+
+// startDeploySpan starts the span of a deploy or rollback, binding target to it.
+// The tracer of the cluster namespace is used, when it has one.
+func (n *KubernetesClusterNamespace) startDeploySpan(name string, req DeployRequest, target Deployer) (context.Context, Span, Deployer) {
+	ctx := context.Background()
+	if req.Context != nil {
+		ctx = valuesOnly{req.Context}
+	}
+	if n.Tracer != nil {
+		ctx = ContextWithTracer(ctx, n.Tracer)
+	}
+
+	ctx, span := StartSpan(ctx, name)
+	span.SetAttribute("deploy.environment", n.Description)
+	span.SetAttribute("deploy.deployment", n.DeploymentName)
+	span.SetAttribute("deploy.tag", req.Tag)
+	span.SetAttribute("deploy.user", req.User)
+
+	return ctx, span, withContext(target, ctx)
+}
+
+// valuesOnly keeps the values of a context, such as its span, but not its deadline or cancellation,
+// so a deploy is not abandoned halfway when the request that asked for it ends.
+type valuesOnly struct {
+	context.Context
+}
+
+func (valuesOnly) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesOnly) Done() <-chan struct{}       { return nil }
+func (valuesOnly) Err() error                  { return nil }
@@ -0,0 +1,259 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployIsTraced(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	clusterNamespace := mockTracedClusterNamespace(server, cluster, tracer)
+	clusterNamespace.Hooks.AfterRolloutSuccess = []DeployHook{func(ctx *DeployContext) error {
+		_, span := StartSpan(ctx.Context, "warm caches")
+		span.End()
+		return nil
+	}}
+
+	// the deploy is part of the trace of the request that asked for it
+	ctx, request := tracer.Start(context.Background(), "POST /environments/staging/deploy")
+	err := clusterNamespace.DeployWithRequest(DeployRequest{Tag: "abc123", User: "alice", Context: ctx})
+	request.End()
+	assert.Nil(t, err)
+
+	deploy := tracer.span("deploy")
+	assert.Equal(t, "POST /environments/staging/deploy", deploy.parent)
+	assert.Equal(t, "abc123", deploy.attributes["deploy.tag"])
+	assert.Equal(t, "alice", deploy.attributes["deploy.user"])
+	assert.Equal(t, "myapp-deployment", deploy.attributes["deploy.deployment"])
+	assert.True(t, deploy.ended)
+
+	for _, name := range []string{"policies", "hooks.before_patch", "patch", "hooks.after_patch", "rollout.wait", "hooks.after_rollout_success"} {
+		assert.Equal(t, "deploy", tracer.span(name).parent, name)
+	}
+	assert.Equal(t, "hooks.after_rollout_success", tracer.span("warm caches").parent)
+
+	patch := tracer.span("HTTP PATCH")
+	assert.Equal(t, "patch", patch.parent)
+	assert.Equal(t, "/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-deployment", patch.attributes["url.path"])
+	assert.Equal(t, 200, patch.attributes["http.response.status_code"])
+	assert.Equal(t, "patch", tracer.span("token.retrieve").parent)
+	assert.Equal(t, "rollout.wait", tracer.span("HTTP GET").parent)
+}
+
+func TestFailedDeployRecordsError(t *testing.T) {
+	tracer := &MockTracer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{},
+		Tracer:      tracer,
+		Hooks: DeployHooks{
+			BeforePatch: []DeployHook{func(ctx *DeployContext) error {
+				return fmt.Errorf("migration failed")
+			}},
+		},
+	}
+
+	err := clusterNamespace.Deploy("abc123")
+	assert.EqualError(t, err, "deploy aborted by hook: migration failed")
+	assert.EqualError(t, tracer.span("deploy").err, "deploy aborted by hook: migration failed")
+	assert.EqualError(t, tracer.span("hooks.before_patch").err, "deploy aborted by hook: migration failed")
+	assert.Nil(t, tracer.span("patch"))
+}
+
+func TestDeployOutlivesRequestContext(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	clusterNamespace := mockTracedClusterNamespace(server, cluster, tracer)
+
+	// the bot has already answered its request when the deploy runs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := clusterNamespace.DeployWithRequest(DeployRequest{Tag: "abc123", Context: ctx})
+	assert.Nil(t, err)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:abc123", cluster.images["myapp-deployment"])
+}
+
+func TestRollbackIsTraced(t *testing.T) {
+	server := httptest.NewTLSServer(&MockHistoryCluster{})
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: mockKubernetesDeployer(server),
+		Tracer:      tracer,
+	}
+	clusterNamespace.DeployMaker.(*KubernetesDeployer).Client = mockTracedClient(server)
+
+	err := clusterNamespace.Rollback(DeployRequest{User: "alice"}, 0)
+	assert.Nil(t, err)
+	rollback := tracer.span("rollback")
+	assert.Equal(t, "", rollback.parent)
+	assert.Equal(t, int64(2), rollback.attributes["deploy.revision"])
+	assert.Equal(t, "patch", tracer.span("HTTP PATCH").parent)
+}
+
+func TestBlueGreenDeployIsTraced(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	namespace, bg := mockBlueGreen(server)
+	namespace.Tracer = tracer
+	namespace.ServiceClient.(*KubernetesServiceClient).Client = mockTracedClient(server)
+	bg.Blue.Client = mockTracedClient(server)
+	bg.Green.Client = mockTracedClient(server)
+
+	assert.Nil(t, namespace.DeployBlueGreen(bg, "abc123"))
+	assert.Equal(t, "patch", tracer.spanAt("HTTP PATCH", "/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-green").parent)
+	assert.Equal(t, "patch", tracer.spanAt("HTTP PATCH", "/api/v1/namespaces/myapp-development/services/myapp").parent)
+}
+
+func TestCanaryDeployIsTraced(t *testing.T) {
+	server, _ := mockPatchServer()
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	pods := &KubernetesPodListRetriever{
+		Client:             mockTracedClient(server),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		BearerTokenService: &MockBearerToken{},
+	}
+	canary, _ := mockCanary(server, pods)
+	canary.Canary.Client = mockTracedClient(server)
+	clusterNamespace := &KubernetesClusterNamespace{DeployMaker: canary, Tracer: tracer}
+
+	// no canary pods ever become ready
+	assert.Error(t, clusterNamespace.Deploy("abc123"))
+	assert.Equal(t, "patch", tracer.spanAt("HTTP PATCH", "/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-canary").parent)
+	assert.Equal(t, "patch", tracer.spanAt("HTTP GET", "/api/v1/namespaces/myapp-development/pods").parent)
+}
+
+func TestJobRunnerHookIsTraced(t *testing.T) {
+	server := httptest.NewTLSServer(newMockJobCluster("Complete"))
+	defer server.Close()
+
+	tracer := &MockTracer{}
+	runner := mockJobRunner(server)
+	runner.Client = mockTracedClient(server)
+	clusterNamespace := &KubernetesClusterNamespace{
+		DeployMaker: &MockDeployer{},
+		Tracer:      tracer,
+		Hooks:       DeployHooks{BeforePatch: []DeployHook{runner.BeforePatchHook()}},
+	}
+
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.Equal(t, "hooks.before_patch", tracer.spanAt("HTTP POST", "/apis/batch/v1/namespaces/myapp-development/jobs").parent)
+}
+
+func TestNoSpansWithoutTracer(t *testing.T) {
+	cluster := newMockBlueGreenCluster("blue")
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	clusterNamespace := mockTracedClusterNamespace(server, cluster, nil)
+	err := clusterNamespace.Deploy("abc123")
+	assert.Nil(t, err)
+
+	ctx, span := StartSpan(context.Background(), "deploy")
+	assert.Equal(t, context.Background(), ctx)
+	assert.Equal(t, noopSpan{}, span)
+}
+
+//
+// MOCK DATA
+//
+
+// MockTracer records every span it starts, with the name of its parent
+type MockTracer struct {
+	mutex sync.Mutex
+	spans []*MockSpan
+}
+
+type MockSpan struct {
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+type mockSpanKey struct{}
+
+func (t *MockTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	span := &MockSpan{name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(mockSpanKey{}).(*MockSpan); ok {
+		span.parent = parent.name
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, mockSpanKey{}, span), span
+}
+
+// span is the first span with the name, or nil
+func (t *MockTracer) span(name string) *MockSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, span := range t.spans {
+		if span.name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// spanAt is the first span with the name calling the path, or an empty span
+func (t *MockTracer) spanAt(name string, path string) *MockSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, span := range t.spans {
+		if span.name == name && span.attributes["url.path"] == path {
+			return span
+		}
+	}
+	return &MockSpan{}
+}
+
+func (s *MockSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *MockSpan) RecordError(err error)                      { s.err = err }
+func (s *MockSpan) End()                                       { s.ended = true }
+
+// mockTracedClusterNamespace deploys to the mock cluster, waiting for the rollout, with API calls traced
+func mockTracedClusterNamespace(server *httptest.Server, cluster *MockBlueGreenCluster, tracer Tracer) *KubernetesClusterNamespace {
+	deployer := mockClusterDeployer(server, cluster)
+	deployer.Client = mockTracedClient(server)
+	return &KubernetesClusterNamespace{
+		DeploymentName: "myapp-deployment",
+		DeployMaker:    deployer,
+		Tracer:         tracer,
+		Hooks: DeployHooks{
+			AfterRolloutFailure: []DeployHook{func(ctx *DeployContext) error { return nil }},
+			RolloutTimeout:      5 * time.Millisecond,
+			RolloutInterval:     time.Millisecond,
+		},
+	}
+}
+
+// mockTracedClient calls the server through a TracingTransport
+func mockTracedClient(server *httptest.Server) *http.Client {
+	return &http.Client{Transport: &TracingTransport{Transport: server.Client().Transport}}
+}
@@ -0,0 +1,196 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DeploymentWatcher represents any Deployer that can stream changes to its deployment
+type DeploymentWatcher interface {
+	Watch(stop <-chan struct{}, changes chan<- *Deployment) error
+}
+
+// watchEvent is one change streamed by the Kubernetes watch API
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchStatus is the object of an ERROR watch event
+type watchStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Watch reconnect delays. A watch that ends or fails without reporting a change is reopened straight away
+// the first time, then after a delay doubling from watchRetryBaseDelay up to watchRetryMaxDelay.
+var (
+	watchRetryBaseDelay = 500 * time.Millisecond
+	watchRetryMaxDelay  = 30 * time.Second
+)
+
+// Watch sends the deployment to changes straight away, then each time the Kubernetes watch API reports a change,
+// until stop is closed. The deployment is retrieved again and the watch reopened whenever the API server or the
+// client's timeout ends it, or it has expired with 410 Gone. Network errors, 429 and 5xx responses are retried
+// the same way; other errors are returned. Reopening backs off while the watch keeps reporting no changes.
+func (d *KubernetesDeployer) Watch(stop <-chan struct{}, changes chan<- *Deployment) error {
+	backoff := &watchBackoff{}
+	for {
+		deployment, err := d.Get()
+		if err == nil {
+			if !sendDeployment(deployment, stop, changes) {
+				return nil
+			}
+
+			var changed bool
+			changed, err = d.watchFrom(deployment.Metadata.ResourceVersion, stop, changes)
+			if changed {
+				backoff.reset()
+			}
+		}
+		if stopped(stop) {
+			return nil
+		}
+		if err != nil && (d.context().Err() != nil || !transientWatchFailure(err)) {
+			return err
+		}
+		if !backoff.wait(stop) {
+			return nil
+		}
+	}
+}
+
+// watchFrom streams changes made after resourceVersion, returning nil when the stream ends
+// or has expired and the deployment needs to be retrieved again. changed is true once a change was sent.
+func (d *KubernetesDeployer) watchFrom(resourceVersion string, stop <-chan struct{}, changes chan<- *Deployment) (changed bool, err error) {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("fieldSelector", "metadata.name="+d.DeploymentName)
+	query.Set("resourceVersion", resourceVersion)
+	watchURL := fmt.Sprintf("https://%s/apis/extensions/v1beta1/namespaces/%s/deployments?%s", d.Endpoint, d.Namespace, query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, watchURL, nil)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(d.context())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := d.send(ctx, req)
+	if err != nil {
+		select {
+		case <-stop:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusGone {
+		return false, nil
+	}
+	if res.StatusCode != 200 {
+		return false, newAPIError(res, d.Namespace)
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		event := &watchEvent{}
+		if decoder.Decode(event) != nil {
+			// the stream ended, timed out or was cancelled
+			return changed, nil
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			deployment := &Deployment{}
+			err := json.Unmarshal(event.Object, deployment)
+			if err != nil {
+				return changed, err
+			}
+			if !sendDeployment(deployment, stop, changes) {
+				return changed, nil
+			}
+			changed = true
+		case "DELETED":
+			return changed, fmt.Errorf("deployment %s was deleted", d.DeploymentName)
+		case "ERROR":
+			status := &watchStatus{}
+			json.Unmarshal(event.Object, status)
+			if status.Code == http.StatusGone {
+				return changed, nil
+			}
+			return changed, fmt.Errorf("watch failed: %s", status.Message)
+		}
+	}
+}
+
+// sendDeployment hands the deployment over, unless stop is closed first
+func sendDeployment(deployment *Deployment, stop <-chan struct{}, changes chan<- *Deployment) bool {
+	select {
+	case changes <- deployment:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// watchBackoff is the delay before reopening a watch, growing while reopened watches report no changes
+type watchBackoff struct {
+	attempts int
+}
+
+// wait sleeps for the next delay, returning false if stop is closed first
+func (b *watchBackoff) wait(stop <-chan struct{}) bool {
+	delay := b.next()
+	b.attempts++
+	if delay == 0 {
+		return !stopped(stop)
+	}
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// next is the delay before the next attempt: none for the first, then doubling up to watchRetryMaxDelay
+func (b *watchBackoff) next() time.Duration {
+	if b.attempts == 0 {
+		return 0
+	}
+	delay := watchRetryBaseDelay << uint(b.attempts-1)
+	if delay > watchRetryMaxDelay || delay <= 0 {
+		delay = watchRetryMaxDelay
+	}
+	return delay
+}
+
+// reset starts the delays over, once a watch has reported a change
+func (b *watchBackoff) reset() {
+	b.attempts = 0
+}
+
+// transientWatchFailure is true for a network error, 429 or 5xx, after which the watch is worth reopening
+func transientWatchFailure(err error) bool {
+	switch err := err.(type) {
+	case *url.Error:
+		return true
+	case *APIError:
+		return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= 500
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package deploy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	cluster := &MockWatchCluster{events: []string{
+		mockWatchEvent("MODIFIED", 2, 1),
+		mockWatchEvent("MODIFIED", 3, 2),
+	}}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	stop := make(chan struct{})
+	changes := make(chan *Deployment)
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- mockKubernetesDeployer(server).Watch(stop, changes) }()
+
+	ready := []int{}
+	for len(ready) < 3 {
+		ready = append(ready, (<-changes).Status.ReadyReplicas)
+	}
+	close(stop)
+
+	assert.Nil(t, <-watchErr)
+	assert.Equal(t, []int{0, 1, 2}, ready)
+	assert.Equal(t, "fieldSelector=metadata.name%3Dmyapp-deployment&resourceVersion=1&watch=true", cluster.watchQueries[0])
+}
+
+func TestWatchReopensExpiredWatch(t *testing.T) {
+	cluster := &MockWatchCluster{events: []string{`{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}`}}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	stop := make(chan struct{})
+	changes := make(chan *Deployment)
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- mockKubernetesDeployer(server).Watch(stop, changes) }()
+
+	<-changes
+	<-changes
+	close(stop)
+
+	assert.Nil(t, <-watchErr)
+	assert.True(t, len(cluster.watchQueries) >= 1)
+}
+
+func TestWatchRetriesTransientFailures(t *testing.T) {
+	gets := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/deployments") {
+			// the watch has expired
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		gets++
+		if gets == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata":{"name":"myapp-deployment","resourceVersion":"%d"}}`, gets)
+	}))
+	defer server.Close()
+
+	stop := make(chan struct{})
+	changes := make(chan *Deployment)
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- mockKubernetesDeployer(server).Watch(stop, changes) }()
+
+	assert.Equal(t, "2", (<-changes).Metadata.ResourceVersion)
+	assert.Equal(t, "3", (<-changes).Metadata.ResourceVersion)
+	close(stop)
+	assert.Nil(t, <-watchErr)
+}
+
+func TestWatchBackoff(t *testing.T) {
+	backoff := &watchBackoff{}
+	delays := []time.Duration{}
+	for i := 0; i < 9; i++ {
+		delays = append(delays, backoff.next())
+		backoff.attempts++
+	}
+	assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second,
+		8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}, delays)
+
+	backoff.reset()
+	assert.Equal(t, time.Duration(0), backoff.next())
+}
+
+func TestWatchErrors(t *testing.T) {
+	for _, tt := range []struct {
+		event    string
+		expected string
+	}{
+		{`{"type":"DELETED","object":{}}`, "deployment myapp-deployment was deleted"},
+		{`{"type":"ERROR","object":{"kind":"Status","code":500,"message":"etcd unavailable"}}`, "watch failed: etcd unavailable"},
+	} {
+		cluster := &MockWatchCluster{events: []string{tt.event}}
+		server := httptest.NewTLSServer(cluster)
+
+		changes := make(chan *Deployment, 1)
+		err := mockKubernetesDeployer(server).Watch(make(chan struct{}), changes)
+		assert.EqualError(t, err, tt.expected)
+		server.Close()
+	}
+}
+
+func TestWatchWhenDeploymentMissing(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := mockKubernetesDeployer(server).Watch(make(chan struct{}), make(chan *Deployment, 1))
+	assert.Contains(t, err.Error(), ": received 404")
+}
+
+//
+// MOCK DATA
+//
+
+// MockWatchCluster serves myapp-deployment at resourceVersion 1, and streams events to each watch
+type MockWatchCluster struct {
+	mutex        sync.Mutex
+	events       []string
+	watchQueries []string
+}
+
+func (c *MockWatchCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/deployments") {
+		c.watchQueries = append(c.watchQueries, r.URL.RawQuery)
+		for _, event := range c.events {
+			fmt.Fprintln(w, event)
+		}
+		return
+	}
+	w.Write([]byte(`{"metadata":{"name":"myapp-deployment","resourceVersion":"1"},"status":{"readyReplicas":0}}`))
+}
+
+func mockWatchEvent(eventType string, resourceVersion int, ready int) string {
+	return fmt.Sprintf(`{"type":%q,"object":{"metadata":{"name":"myapp-deployment","resourceVersion":"%d"},"status":{"readyReplicas":%d}}}`,
+		eventType, resourceVersion, ready)
+}
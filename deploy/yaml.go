@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// yamlMapping is a JSON object with its keys kept in order
+type yamlMapping struct {
+	keys   []string
+	values []interface{}
+}
+
+// plainYAMLString matches strings that YAML reads back as the same string without quotes
+var plainYAMLString = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./@:+-]*$`)
+
+// MarshalYAML encodes value as YAML with the same field names as its JSON, keeping the order of fields
+func MarshalYAML(value interface{}) ([]byte, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(raw)
+}
+
+// jsonToYAML converts JSON into the same document in YAML, keeping the order of object keys
+func jsonToYAML(raw []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	value, err := readJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	switch v := value.(type) {
+	case *yamlMapping:
+		if len(v.keys) == 0 {
+			out.WriteString("{}\n")
+			break
+		}
+		writeYAMLBlock(out, v, "")
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString("[]\n")
+			break
+		}
+		writeYAMLBlock(out, v, "")
+	default:
+		out.WriteString(yamlScalar(v) + "\n")
+	}
+	return out.Bytes(), nil
+}
+
+// readJSONValue reads the next value, building a yamlMapping for each object
+func readJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		mapping := &yamlMapping{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			mapping.keys = append(mapping.keys, key.(string))
+			mapping.values = append(mapping.values, value)
+		}
+		_, err = decoder.Token()
+		return mapping, err
+	case json.Delim('['):
+		sequence := []interface{}{}
+		for decoder.More() {
+			value, err := readJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		_, err = decoder.Token()
+		return sequence, err
+	}
+	return token, nil
+}
+
+// writeYAMLBlock writes a non-empty mapping or sequence, one entry per line
+func writeYAMLBlock(out *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case *yamlMapping:
+		for i, key := range v.keys {
+			out.WriteString(indent + yamlScalar(key) + ":")
+			writeYAMLValue(out, v.values[i], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			// mappings start on the same line as their dash
+			if mapping, ok := item.(*yamlMapping); ok && len(mapping.keys) > 0 {
+				entry := &bytes.Buffer{}
+				writeYAMLBlock(entry, mapping, indent+"  ")
+				out.WriteString(indent + "- ")
+				out.Write(entry.Bytes()[len(indent)+2:])
+				continue
+			}
+			out.WriteString(indent + "-")
+			writeYAMLValue(out, item, indent)
+		}
+	}
+}
+
+// writeYAMLValue writes the value after a key or dash: scalars and empty
+// collections on the same line, anything else indented on the lines below
+func writeYAMLValue(out *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case *yamlMapping:
+		if len(v.keys) == 0 {
+			out.WriteString(" {}\n")
+			return
+		}
+		out.WriteString("\n")
+		writeYAMLBlock(out, v, indent+"  ")
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString(" []\n")
+			return
+		}
+		out.WriteString("\n")
+		writeYAMLBlock(out, v, indent+"  ")
+	default:
+		out.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+// yamlScalar formats a JSON scalar, quoting strings YAML would otherwise read differently
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprint(v)
+	case json.Number:
+		return v.String()
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no", "on", "off", "y", "n", "null":
+		default:
+			if plainYAMLString.MatchString(v) {
+				return v
+			}
+		}
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	}
+	return fmt.Sprint(value)
+}
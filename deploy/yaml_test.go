@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONToYAML(t *testing.T) {
+	out, err := jsonToYAML([]byte(`{"name":"myapp","replicas":3,"ready":true,"image":null,
+		"labels":{},"ports":[],"tags":["v1.2.0","latest","yes"],
+		"containers":[{"name":"web","args":["--port","8080"]},{"name":"worker","env":{"MODE":"queue"}}],
+		"message":"Back-off pulling image\n\"myapp:abc\""}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, `name: myapp
+replicas: 3
+ready: true
+image: null
+labels: {}
+ports: []
+tags:
+  - v1.2.0
+  - latest
+  - "yes"
+containers:
+  - name: web
+    args:
+      - "--port"
+      - "8080"
+  - name: worker
+    env:
+      MODE: queue
+message: "Back-off pulling image\n\"myapp:abc\""
+`, string(out))
+}
+
+func TestJSONToYAMLTopLevel(t *testing.T) {
+	out, _ := jsonToYAML([]byte(`[]`))
+	assert.Equal(t, "[]\n", string(out))
+	out, _ = jsonToYAML([]byte(`{}`))
+	assert.Equal(t, "{}\n", string(out))
+	out, _ = jsonToYAML([]byte(`"Running"`))
+	assert.Equal(t, "Running\n", string(out))
+
+	_, err := jsonToYAML([]byte(`{"name":`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package deploytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces tokens in recorded fixtures
+const Redacted = "REDACTED"
+
+// Fixture is a recording of Kubernetes API calls, in the order they were made
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded call
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a call's method, path with query, Content-Type and body. The endpoint is left out,
+// so the call can be replayed against any.
+type RecordedRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// RecordedResponse is the status code, Content-Type and body a call was answered with
+type RecordedResponse struct {
+	StatusCode  int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body"`
+}
+
+// LoadFixture reads a fixture saved by a Recorder
+func LoadFixture(path string) (*Fixture, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &Fixture{}
+	err = json.Unmarshal(raw, fixture)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s is not valid: %s", path, err.Error())
+	}
+	return fixture, nil
+}
+
+// Recorder is an http.RoundTripper recording every call it sends, to save as a fixture. Bearer tokens are
+// scrubbed from what it records, along with anything in Redact. Bodies are recorded as they are read,
+// so a watch records the events read from it before it was closed.
+//
+//	recorder := &deploytest.Recorder{Transport: client.Transport}
+//	client.Transport = recorder
+//	...
+//	recorder.Save("testdata/rollout.json")
+type Recorder struct {
+	// Transport sends each call, defaulting to http.DefaultTransport
+	Transport http.RoundTripper
+	// Redact lists other secrets to scrub from requests and responses
+	Redact []string
+
+	mutex      sync.Mutex
+	recordings []*recording
+	tokens     []string
+}
+
+// recording is an interaction whose response body is still being read
+type recording struct {
+	interaction Interaction
+	body        *bytes.Buffer
+}
+
+// RoundTrip sends the request, recording it and its response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	body := ""
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		raw, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		body = string(raw)
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	rec := &recording{body: &bytes.Buffer{}}
+	rec.interaction.Request = RecordedRequest{
+		Method:      req.Method,
+		URL:         req.URL.RequestURI(),
+		ContentType: req.Header.Get("Content-Type"),
+		Body:        body,
+	}
+	rec.interaction.Response = RecordedResponse{StatusCode: res.StatusCode, ContentType: res.Header.Get("Content-Type")}
+	res.Body = &teeBody{ReadCloser: res.Body, recorder: r, body: rec.body}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.recordings = append(r.recordings, rec)
+	if token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "); token != "" {
+		r.tokens = append(r.tokens, token)
+	}
+	return res, nil
+}
+
+// Fixture is every call recorded so far, scrubbed of tokens
+func (r *Recorder) Fixture() *Fixture {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	secrets := append(append([]string{}, r.tokens...), r.Redact...)
+	pairs := []string{}
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, Redacted)
+		}
+	}
+	scrub := strings.NewReplacer(pairs...).Replace
+
+	fixture := &Fixture{Interactions: []Interaction{}}
+	for _, rec := range r.recordings {
+		interaction := rec.interaction
+		interaction.Request.URL = scrub(interaction.Request.URL)
+		interaction.Request.Body = scrub(interaction.Request.Body)
+		interaction.Response.Body = scrub(rec.body.String())
+		fixture.Interactions = append(fixture.Interactions, interaction)
+	}
+	return fixture
+}
+
+// Save writes the fixture to path
+func (r *Recorder) Save(path string) error {
+	raw, err := json.MarshalIndent(r.Fixture(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(raw, '\n'), 0644)
+}
+
+// teeBody records a response body as it is read
+type teeBody struct {
+	io.ReadCloser
+	recorder *Recorder
+	body     *bytes.Buffer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.recorder.mutex.Lock()
+	t.body.Write(p[:n])
+	t.recorder.mutex.Unlock()
+	return n, err
+}
+
+// Replayer is an http.RoundTripper answering calls from a fixture, without sending them. Each call is answered
+// by the first interaction not yet played with the same method and URL, which must have been sent the same body.
+// Any endpoint can be used, as only the path and query are compared.
+//
+//	fixture, err := deploytest.LoadFixture("testdata/rollout.json")
+//	deployer := &deploy.KubernetesDeployer{Client: deploytest.NewReplayer(fixture).Client(), Endpoint: "kubernetes.test", ...}
+type Replayer struct {
+	mutex    sync.Mutex
+	fixture  *Fixture
+	unplayed []bool
+}
+
+// NewReplayer replays the fixture from the start
+func NewReplayer(fixture *Fixture) *Replayer {
+	unplayed := make([]bool, len(fixture.Interactions))
+	for i := range unplayed {
+		unplayed[i] = true
+	}
+	return &Replayer{fixture: fixture, unplayed: unplayed}
+}
+
+// Client is an http.Client replaying the fixture
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip answers the call with its recorded response, or fails when none was recorded
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		raw, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = string(raw)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, interaction := range r.fixture.Interactions {
+		recorded := interaction.Request
+		if !r.unplayed[i] || recorded.Method != req.Method || recorded.URL != req.URL.RequestURI() {
+			continue
+		}
+		if recorded.Body != body {
+			return nil, fmt.Errorf("%s %s was recorded with body %s, not %s", req.Method, recorded.URL, recorded.Body, body)
+		}
+
+		r.unplayed[i] = false
+		res := &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}
+		if interaction.Response.ContentType != "" {
+			res.Header.Set("Content-Type", interaction.Response.ContentType)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL.RequestURI())
+}
+
+// Unplayed lists the interactions not replayed yet, e.g. to check a test made every call it was recorded making
+func (r *Replayer) Unplayed() []Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := []Interaction{}
+	for i, interaction := range r.fixture.Interactions {
+		if r.unplayed[i] {
+			result = append(result, interaction)
+		}
+	}
+	return result
+}
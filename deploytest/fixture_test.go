@@ -0,0 +1,164 @@
+package deploytest
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "record the fixtures in testdata again")
+
+func TestReplayRollout(t *testing.T) {
+	path := filepath.Join("testdata", "rollout.json")
+	if *update {
+		server := NewServer()
+		server.Token = "secret"
+		defer server.Close()
+		server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 2)
+		recorder := &Recorder{Transport: server.Client().Transport}
+		rollout(t, withClient(server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container"), &http.Client{Transport: recorder}))
+		assert.Nil(t, recorder.Save(path))
+	}
+
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(fixture)
+	rollout(t, mockReplayedClusterNamespace(replayer.Client()))
+	assert.Equal(t, 0, len(replayer.Unplayed()))
+}
+
+func TestRecordingScrubsTokens(t *testing.T) {
+	server := NewServer()
+	server.Token = "secret"
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+	recorder := &Recorder{Transport: server.Client().Transport, Redact: []string{"artifactory.myorg.com"}}
+	cluster := withClient(server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container"), &http.Client{Transport: recorder})
+
+	_, err := cluster.GetDeployment()
+	assert.Nil(t, err)
+	assert.Nil(t, cluster.Deploy("bbb222"))
+
+	dir, _ := ioutil.TempDir("", "fixture")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixture.json")
+	assert.Nil(t, recorder.Save(path))
+	raw, _ := ioutil.ReadFile(path)
+	assert.False(t, strings.Contains(string(raw), "secret"))
+	assert.False(t, strings.Contains(string(raw), "artifactory.myorg.com"))
+
+	fixture, err := LoadFixture(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(fixture.Interactions))
+	patch := fixture.Interactions[1]
+	assert.Equal(t, http.MethodPatch, patch.Request.Method)
+	assert.Equal(t, "/apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment", patch.Request.URL)
+	assert.Equal(t, StrategicMergePatch, patch.Request.ContentType)
+	assert.Contains(t, patch.Request.Body, "REDACTED:5010/myapp:bbb222")
+	assert.Equal(t, http.StatusOK, patch.Response.StatusCode)
+}
+
+func TestRecordingKeepsWatchEventsRead(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+	recorder := &Recorder{Transport: server.Client().Transport}
+	deployer := withClient(server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container"), &http.Client{Transport: recorder}).DeployMaker.(*deploy.KubernetesDeployer)
+
+	stop := make(chan struct{})
+	changes := make(chan *deploy.Deployment, 10)
+	go deployer.Watch(stop, changes)
+	<-changes
+	deployer.Deploy("bbb222")
+	for deployment := range changes {
+		if deployment.Metadata.Generation == 2 {
+			break
+		}
+	}
+	close(stop)
+
+	watches := 0
+	for _, interaction := range recorder.Fixture().Interactions {
+		if strings.Contains(interaction.Request.URL, "watch=") {
+			watches++
+			assert.Contains(t, interaction.Response.Body, `"type":"MODIFIED"`)
+		}
+	}
+	assert.Equal(t, 1, watches)
+}
+
+func TestReplayErrors(t *testing.T) {
+	fixture := &Fixture{Interactions: []Interaction{{
+		Request:  RecordedRequest{Method: http.MethodPatch, URL: "/apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment", Body: `{"spec":{}}`},
+		Response: RecordedResponse{StatusCode: http.StatusOK, Body: `{}`},
+	}}}
+	cluster := mockReplayedClusterNamespace(NewReplayer(fixture).Client())
+
+	_, err := cluster.GetDeployment()
+	assert.Contains(t, err.Error(), "no recorded response for GET /apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment")
+
+	err = cluster.Deploy("bbb222")
+	assert.Contains(t, err.Error(), `was recorded with body {"spec":{}}`)
+}
+
+// rollout deploys a new tag, and checks the deployment, pods and history that result
+func rollout(t *testing.T, cluster *deploy.KubernetesClusterNamespace) {
+	image, err := cluster.DeployMaker.(*deploy.KubernetesDeployer).CurrentImage()
+	assert.Nil(t, err)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:aaa111", image)
+
+	assert.Nil(t, cluster.Deploy("bbb222"))
+
+	deployment, err := cluster.GetDeployment()
+	assert.Nil(t, err)
+	assert.True(t, deployment.RolloutComplete())
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:bbb222", deployment.ContainerImage("myapp-container"))
+
+	podList, err := cluster.GetPodList()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(podList.Items))
+	for _, pod := range podList.Overview() {
+		assert.Equal(t, "bbb222", pod.Tag)
+		assert.True(t, pod.Ready)
+	}
+
+	revisions, err := cluster.History()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:aaa111", revisions[1].Image)
+}
+
+// MOCK DATA
+
+func mockReplayedClusterNamespace(client *http.Client) *deploy.KubernetesClusterNamespace {
+	return &deploy.KubernetesClusterNamespace{
+		Description:    "myapp",
+		DeploymentName: "myapp-deployment",
+		PodRetriever: &deploy.KubernetesPodListRetriever{
+			Client: client, Endpoint: "kubernetes.test", Namespace: "myapp", BearerTokenService: Token("token"),
+		},
+		EventRetriever: &deploy.KubernetesEventListRetriever{
+			Client: client, Endpoint: "kubernetes.test", Namespace: "myapp", BearerTokenService: Token("token"),
+		},
+		DeployMaker: &deploy.KubernetesDeployer{
+			Client: client, Endpoint: "kubernetes.test", Namespace: "myapp", BearerTokenService: Token("token"),
+			DeploymentName: "myapp-deployment", ContainerName: "myapp-container", ContainerImage: "artifactory.myorg.com:5010/myapp",
+		},
+	}
+}
+
+func withClient(cluster *deploy.KubernetesClusterNamespace, client *http.Client) *deploy.KubernetesClusterNamespace {
+	cluster.PodRetriever.(*deploy.KubernetesPodListRetriever).Client = client
+	cluster.EventRetriever.(*deploy.KubernetesEventListRetriever).Client = client
+	cluster.DeployMaker.(*deploy.KubernetesDeployer).Client = client
+	return cluster
+}
@@ -0,0 +1,160 @@
+package deploytest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// objectMeta is the metadata every object the fake API server holds has
+type objectMeta struct {
+	Name              string                  `json:"name"`
+	Namespace         string                  `json:"namespace"`
+	UID               string                  `json:"uid"`
+	ResourceVersion   string                  `json:"resourceVersion"`
+	Generation        int64                   `json:"generation,omitempty"`
+	CreationTimestamp time.Time               `json:"creationTimestamp"`
+	Labels            map[string]string       `json:"labels,omitempty"`
+	Annotations       map[string]string       `json:"annotations,omitempty"`
+	OwnerReferences   []deploy.OwnerReference `json:"ownerReferences,omitempty"`
+}
+
+// podTemplate is the pod template of a Deployment or ReplicaSet
+type podTemplate struct {
+	Metadata struct {
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec podSpec `json:"spec"`
+}
+
+type podSpec struct {
+	Containers []deploy.DeploymentContainer `json:"containers"`
+}
+
+// hash names the ReplicaSet of the template, as the pod-template-hash label does
+func (t podTemplate) hash() string {
+	raw, _ := json.Marshal(t)
+	h := fnv.New32a()
+	h.Write(raw)
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+type deployment struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int        `json:"replicas,omitempty"`
+		Template podTemplate `json:"template"`
+	} `json:"spec"`
+	Status deploy.DeploymentStatus `json:"status"`
+
+	// rollout counts the rollouts started, so a stepping rollout stops once another replaces it
+	rollout int
+	// failedSteps counts the steps a new pod has been failing for, until the progress deadline
+	failedSteps int
+	exceeded    bool
+}
+
+func (d *deployment) desiredReplicas() int {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+type replicaSet struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int        `json:"replicas"`
+		Template podTemplate `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		Replicas      int `json:"replicas"`
+		ReadyReplicas int `json:"readyReplicas"`
+	} `json:"status"`
+}
+
+// revision is the number Kubernetes gave the ReplicaSet among its Deployment's
+func (r *replicaSet) revision() int64 {
+	var revision int64
+	fmt.Sscan(r.Metadata.Annotations[deploy.RevisionAnnotation], &revision)
+	return revision
+}
+
+type pod struct {
+	Metadata objectMeta       `json:"metadata"`
+	Spec     podSpec          `json:"spec"`
+	Status   deploy.PodStatus `json:"status"`
+}
+
+// ready is true when every container of the pod is ready
+func (p *pod) ready() bool {
+	for _, container := range p.Status.ContainerStatuses {
+		if !container.Ready {
+			return false
+		}
+	}
+	return len(p.Status.ContainerStatuses) > 0
+}
+
+// ownedBy is true when the kind of object with the name created the object with the owner references
+func ownedBy(owners []deploy.OwnerReference, kind string, name string) bool {
+	for _, owner := range owners {
+		if owner.Kind == kind && owner.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// imageID is the digest a node would report for the image, which is the same every time it is pulled
+func imageID(image string) string {
+	repository := image
+	if i := strings.Index(image, "@"); i >= 0 {
+		return "docker-pullable://" + image
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository = image[:i]
+	}
+	return fmt.Sprintf("docker-pullable://%s@sha256:%x", repository, sha256.Sum256([]byte(image)))
+}
+
+// imageRepository is the image without its tag or digest, as a KubernetesDeployer's ContainerImage
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// copyMap copies labels or annotations, so objects never share them
+func copyMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	result := map[string]string{}
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// status is the Kubernetes Status object of an error response
+func status(code int, reason string, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	}
+}
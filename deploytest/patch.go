@@ -0,0 +1,108 @@
+package deploytest
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Content types of the patches the fake API server applies
+const (
+	StrategicMergePatch = "application/strategic-merge-patch+json"
+	MergePatch          = "application/merge-patch+json"
+)
+
+// mergeKeys are the fields whose lists a strategic merge patch merges by a key, rather than replacing them
+var mergeKeys = map[string]string{
+	"containers":      "name",
+	"initContainers":  "name",
+	"env":             "name",
+	"ports":           "containerPort",
+	"volumes":         "name",
+	"volumeMounts":    "mountPath",
+	"ownerReferences": "uid",
+}
+
+// applyPatch applies a JSON merge patch, or a strategic merge patch, to the JSON of an object
+func applyPatch(original []byte, patch []byte, contentType string) ([]byte, error) {
+	object := map[string]interface{}{}
+	err := json.Unmarshal(original, &object)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]interface{}{}
+	err = json.Unmarshal(patch, &changes)
+	if err != nil {
+		return nil, fmt.Errorf("patch is not a JSON object: %s", err.Error())
+	}
+
+	switch contentType {
+	case StrategicMergePatch:
+		return json.Marshal(mergeObject(object, changes, true))
+	case MergePatch:
+		return json.Marshal(mergeObject(object, changes, false))
+	}
+	return nil, fmt.Errorf("unsupported patch type %q", contentType)
+}
+
+// mergeObject sets each field of patch on object, removing those set to null and merging nested objects.
+// Strategically, lists of objects with a merge key are merged by it too.
+func mergeObject(object map[string]interface{}, patch map[string]interface{}, strategic bool) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			original, ok := object[key].(map[string]interface{})
+			if !ok {
+				original = map[string]interface{}{}
+			}
+			object[key] = mergeObject(original, value, strategic)
+		case []interface{}:
+			original, ok := object[key].([]interface{})
+			mergeKey, keyed := mergeKeys[key]
+			if strategic && ok && keyed {
+				object[key] = mergeList(original, value, mergeKey)
+			} else {
+				object[key] = value
+			}
+		default:
+			object[key] = value
+		}
+	}
+	return object
+}
+
+// mergeList merges each item of patch into the item of list with the same mergeKey, appending those without one.
+// An item with `"$patch": "delete"` removes the item it matches.
+func mergeList(list []interface{}, patch []interface{}, mergeKey string) []interface{} {
+	for _, value := range patch {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			list = append(list, value)
+			continue
+		}
+
+		found := -1
+		for i, original := range list {
+			if original, ok := original.(map[string]interface{}); ok && fmt.Sprint(original[mergeKey]) == fmt.Sprint(item[mergeKey]) {
+				found = i
+				break
+			}
+		}
+
+		switch {
+		case item["$patch"] == "delete":
+			if found >= 0 {
+				list = append(list[:found], list[found+1:]...)
+			}
+		case found >= 0:
+			list[found] = mergeObject(list[found].(map[string]interface{}), item, true)
+		default:
+			list = append(list, item)
+		}
+	}
+	return list
+}
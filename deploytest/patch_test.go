@@ -0,0 +1,36 @@
+package deploytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrategicMergePatchMergesContainersByName(t *testing.T) {
+	original := `{"metadata":{"name":"myapp","annotations":{"a":"1","b":"2"}},
+		"spec":{"template":{"spec":{"containers":[{"name":"myapp","image":"myapp:aaa111"},{"name":"sidecar","image":"proxy:1"}]}}}}`
+	patch := `{"metadata":{"annotations":{"a":null,"c":"3"}},
+		"spec":{"template":{"spec":{"containers":[{"name":"myapp","image":"myapp:bbb222"},{"name":"sidecar","$patch":"delete"},{"name":"logger","image":"logger:1"}]}}}}`
+
+	patched, err := applyPatch([]byte(original), []byte(patch), StrategicMergePatch)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"metadata":{"name":"myapp","annotations":{"b":"2","c":"3"}},
+		"spec":{"template":{"spec":{"containers":[{"name":"myapp","image":"myapp:bbb222"},{"name":"logger","image":"logger:1"}]}}}}`, string(patched))
+}
+
+func TestMergePatchReplacesLists(t *testing.T) {
+	original := `{"spec":{"replicas":1,"template":{"spec":{"containers":[{"name":"myapp","image":"myapp:aaa111"},{"name":"sidecar","image":"proxy:1"}]}}}}`
+	patch := `{"spec":{"replicas":3,"template":{"spec":{"containers":[{"name":"myapp","image":"myapp:bbb222"}]}}}}`
+
+	patched, err := applyPatch([]byte(original), []byte(patch), MergePatch)
+	assert.Nil(t, err)
+	assert.JSONEq(t, patch, string(patched))
+}
+
+func TestPatchErrors(t *testing.T) {
+	_, err := applyPatch([]byte(`{}`), []byte(`[]`), StrategicMergePatch)
+	assert.Contains(t, err.Error(), "patch is not a JSON object")
+
+	_, err = applyPatch([]byte(`{}`), []byte(`{}`), "application/json-patch+json")
+	assert.EqualError(t, err, `unsupported patch type "application/json-patch+json"`)
+}
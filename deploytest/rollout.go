@@ -0,0 +1,319 @@
+package deploytest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Failure is how the pods of an image fail to start
+type Failure string
+
+// Failures the fake API server can simulate, named after the reason their containers wait with
+const (
+	CrashLoop        Failure = "CrashLoopBackOff"
+	ImagePullFailure Failure = "ImagePullBackOff"
+)
+
+// ProgressDeadlineSteps is how many steps a rollout waits on a failing pod before
+// its deployment reports ProgressDeadlineExceeded
+const ProgressDeadlineSteps = 3
+
+// startRollout moves the deployment towards its template and replicas, a pod at a time. Without a StepInterval,
+// the rollout finishes, or exceeds its progress deadline, before startRollout returns.
+func (s *Server) startRollout(d *deployment) {
+	d.rollout++
+	d.failedSteps = 0
+	d.exceeded = false
+	s.updateStatus(d)
+
+	if s.StepInterval <= 0 {
+		for s.step(d) {
+		}
+		return
+	}
+
+	go func(rollout int) {
+		ticker := time.NewTicker(s.StepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+
+			s.mutex.Lock()
+			more := d.rollout == rollout && s.step(d)
+			s.mutex.Unlock()
+			if !more {
+				return
+			}
+		}
+	}(d.rollout)
+}
+
+// step moves the rollout on by one pod, like a rolling update with a surge of one and none unavailable.
+// It returns false once there is nothing left to do.
+func (s *Server) step(d *deployment) bool {
+	current := s.currentReplicaSet(d)
+	newPods, oldPods := s.podsOf(d, current)
+	desired := d.desiredReplicas()
+
+	failing := []*pod{}
+	for _, p := range newPods {
+		if !p.ready() {
+			failing = append(failing, p)
+		}
+	}
+
+	switch {
+	case d.exceeded:
+		return false
+	case len(newPods) > desired:
+		s.deletePod(newPods[len(newPods)-1])
+	case len(failing) > 0:
+		for _, p := range failing {
+			s.restart(p)
+		}
+		d.failedSteps++
+		if d.failedSteps >= ProgressDeadlineSteps {
+			d.exceeded = true
+		}
+	case len(newPods) < desired:
+		if s.addPod(current).ready() && len(oldPods) > 0 {
+			s.deletePod(oldPods[0])
+		}
+	case len(oldPods) > 0:
+		s.deletePod(oldPods[0])
+	default:
+		return false
+	}
+
+	s.updateReplicaSets(d)
+	s.updateStatus(d)
+	return !d.exceeded
+}
+
+// currentReplicaSet is the ReplicaSet with the deployment's pod template
+func (s *Server) currentReplicaSet(d *deployment) *replicaSet {
+	return s.replicaSets[key(d.Metadata.Namespace, d.Metadata.Name+"-"+d.Spec.Template.hash())]
+}
+
+// replicaSetsOf lists the ReplicaSets of the deployment, by name
+func (s *Server) replicaSetsOf(d *deployment) []*replicaSet {
+	result := []*replicaSet{}
+	for _, r := range s.replicaSets {
+		if r.Metadata.Namespace == d.Metadata.Namespace && ownedBy(r.Metadata.OwnerReferences, "Deployment", d.Metadata.Name) {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Metadata.Name < result[j].Metadata.Name })
+	return result
+}
+
+// podsOf lists the pods of the current ReplicaSet and those of the deployment's older ReplicaSets, each by name
+func (s *Server) podsOf(d *deployment, current *replicaSet) (newPods []*pod, oldPods []*pod) {
+	for _, r := range s.replicaSetsOf(d) {
+		for _, p := range s.sortedPods(d.Metadata.Namespace) {
+			if !ownedBy(p.Metadata.OwnerReferences, "ReplicaSet", r.Metadata.Name) {
+				continue
+			}
+			if r == current {
+				newPods = append(newPods, p)
+			} else {
+				oldPods = append(oldPods, p)
+			}
+		}
+	}
+	return newPods, oldPods
+}
+
+// rolloutReplicaSet makes the ReplicaSet for the deployment's pod template the next revision,
+// creating it unless an earlier revision had the same template, as a rollback does
+func (s *Server) rolloutReplicaSet(d *deployment) {
+	var revision int64
+	for _, r := range s.replicaSetsOf(d) {
+		if r.revision() > revision {
+			revision = r.revision()
+		}
+	}
+
+	current := s.currentReplicaSet(d)
+	if current == nil {
+		current = &replicaSet{}
+		current.Metadata = s.newMeta(d.Metadata.Namespace, d.Metadata.Name+"-"+d.Spec.Template.hash())
+		current.Metadata.Labels = copyMap(d.Spec.Template.Metadata.Labels)
+		current.Metadata.OwnerReferences = []deploy.OwnerReference{{Kind: "Deployment", Name: d.Metadata.Name}}
+		current.Spec.Template = d.Spec.Template
+		current.Spec.Template.Metadata.Labels = copyMap(d.Spec.Template.Metadata.Labels)
+		current.Spec.Template.Metadata.Annotations = copyMap(d.Spec.Template.Metadata.Annotations)
+		s.replicaSets[key(current.Metadata.Namespace, current.Metadata.Name)] = current
+	} else if current.revision() == revision {
+		return
+	}
+
+	current.Metadata.Annotations = map[string]string{deploy.RevisionAnnotation: fmt.Sprint(revision + 1)}
+	if current.Metadata.ResourceVersion != "" {
+		s.record(modified, "replicasets", &current.Metadata, current)
+	}
+	if d.Metadata.Annotations == nil {
+		d.Metadata.Annotations = map[string]string{}
+	}
+	d.Metadata.Annotations[deploy.RevisionAnnotation] = fmt.Sprint(revision + 1)
+	s.updateReplicaSets(d)
+}
+
+// updateReplicaSets sets the replicas each ReplicaSet of the deployment wants and has, recording those that changed
+func (s *Server) updateReplicaSets(d *deployment) {
+	current := s.currentReplicaSet(d)
+	for _, r := range s.replicaSetsOf(d) {
+		replicas := 0
+		if r == current {
+			replicas = d.desiredReplicas()
+		}
+		had, hadReady, wanted := r.Status.Replicas, r.Status.ReadyReplicas, r.Spec.Replicas
+
+		r.Spec.Replicas = &replicas
+		r.Status.Replicas, r.Status.ReadyReplicas = 0, 0
+		for _, p := range s.pods {
+			if p.Metadata.Namespace == r.Metadata.Namespace && ownedBy(p.Metadata.OwnerReferences, "ReplicaSet", r.Metadata.Name) {
+				r.Status.Replicas++
+				if p.ready() {
+					r.Status.ReadyReplicas++
+				}
+			}
+		}
+
+		switch {
+		case r.Metadata.ResourceVersion == "":
+			s.record(added, "replicasets", &r.Metadata, r)
+		case wanted == nil || *wanted != replicas || had != r.Status.Replicas || hadReady != r.Status.ReadyReplicas:
+			s.record(modified, "replicasets", &r.Metadata, r)
+		}
+	}
+}
+
+// updateStatus sets the status of the deployment from its pods, recording it when it changed
+func (s *Server) updateStatus(d *deployment) {
+	current := s.currentReplicaSet(d)
+	newPods, oldPods := s.podsOf(d, current)
+	desired := d.desiredReplicas()
+
+	status := deploy.DeploymentStatus{
+		ObservedGeneration: d.Metadata.Generation,
+		Replicas:           len(newPods) + len(oldPods),
+		UpdatedReplicas:    len(newPods),
+	}
+	for _, p := range append(newPods, oldPods...) {
+		if p.ready() {
+			status.ReadyReplicas++
+		}
+	}
+	status.AvailableReplicas = status.ReadyReplicas
+	if status.Replicas > status.AvailableReplicas {
+		status.UnavailableReplicas = status.Replicas - status.AvailableReplicas
+	}
+
+	available := deploy.DeploymentCondition{Type: "Available", Status: "True", Reason: "MinimumReplicasAvailable", Message: "Deployment has minimum availability."}
+	if status.AvailableReplicas < desired {
+		available = deploy.DeploymentCondition{Type: "Available", Status: "False", Reason: "MinimumReplicasUnavailable", Message: "Deployment does not have minimum availability."}
+	}
+	name := d.Metadata.Name
+	if current != nil {
+		name = current.Metadata.Name
+	}
+	progressing := deploy.DeploymentCondition{Type: "Progressing", Status: "True", Reason: "ReplicaSetUpdated", Message: fmt.Sprintf("ReplicaSet %q is progressing.", name)}
+	switch {
+	case d.exceeded:
+		progressing = deploy.DeploymentCondition{Type: "Progressing", Status: "False", Reason: "ProgressDeadlineExceeded", Message: fmt.Sprintf("ReplicaSet %q has timed out progressing.", name)}
+	case status.UpdatedReplicas == desired && status.Replicas == desired && status.AvailableReplicas == desired:
+		progressing = deploy.DeploymentCondition{Type: "Progressing", Status: "True", Reason: "NewReplicaSetAvailable", Message: fmt.Sprintf("ReplicaSet %q has successfully progressed.", name)}
+	}
+	status.Conditions = []deploy.DeploymentCondition{available, progressing}
+
+	if fmt.Sprint(status) != fmt.Sprint(d.Status) {
+		d.Status = status
+		s.record(modified, "deployments", &d.Metadata, d)
+	}
+}
+
+// addPod starts a pod of the ReplicaSet, failing when its image has been told to
+func (s *Server) addPod(r *replicaSet) *pod {
+	s.names++
+	p := &pod{Spec: r.Spec.Template.Spec}
+	p.Metadata = s.newMeta(r.Metadata.Namespace, fmt.Sprintf("%s-%05d", r.Metadata.Name, s.names))
+	p.Metadata.Labels = copyMap(r.Spec.Template.Metadata.Labels)
+	p.Metadata.Annotations = copyMap(r.Spec.Template.Metadata.Annotations)
+	p.Metadata.OwnerReferences = []deploy.OwnerReference{{Kind: "ReplicaSet", Name: r.Metadata.Name}}
+
+	p.Status.Phase = "Running"
+	for _, container := range p.Spec.Containers {
+		status := deploy.PodContainerStatuses{Image: container.Image}
+		switch s.failures[container.Image] {
+		case CrashLoop:
+			status.ImageID = imageID(container.Image)
+			status.State.Waiting = &deploy.PodContainerStatusesStateWaiting{Reason: string(CrashLoop)}
+		case ImagePullFailure:
+			p.Status.Phase = "Pending"
+			status.State.Waiting = &deploy.PodContainerStatusesStateWaiting{Reason: string(ImagePullFailure)}
+			s.event(p, "Failed", fmt.Sprintf("Failed to pull image %q: manifest unknown", container.Image))
+		default:
+			status.ImageID = imageID(container.Image)
+			status.Ready = true
+			status.State.Running = &deploy.PodContainerStatusesStateRunning{StartedAt: time.Now().UTC().Truncate(time.Second)}
+		}
+		p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, status)
+	}
+
+	s.pods[key(p.Metadata.Namespace, p.Metadata.Name)] = p
+	s.record(added, "pods", &p.Metadata, p)
+	return p
+}
+
+// restart restarts the crashing containers of a failing pod, and tries pulling images again
+func (s *Server) restart(p *pod) {
+	for i, container := range p.Status.ContainerStatuses {
+		switch s.failures[container.Image] {
+		case CrashLoop:
+			p.Status.ContainerStatuses[i].RestartCount++
+			s.event(p, "BackOff", "Back-off restarting failed container")
+		case ImagePullFailure:
+			s.event(p, "Failed", fmt.Sprintf("Failed to pull image %q: manifest unknown", container.Image))
+		}
+	}
+	s.record(modified, "pods", &p.Metadata, p)
+}
+
+func (s *Server) deletePod(p *pod) {
+	delete(s.pods, key(p.Metadata.Namespace, p.Metadata.Name))
+	s.record(deleted, "pods", &p.Metadata, p)
+}
+
+// event records a warning about the pod, counting how often it repeats
+func (s *Server) event(p *pod, reason string, message string) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, e := range s.events {
+		if e.namespace == p.Metadata.Namespace && e.InvolvedObject.Name == p.Metadata.Name && e.Reason == reason {
+			s.events[i].Count++
+			s.events[i].LastTimestamp = now
+			return
+		}
+	}
+
+	e := namespacedEvent{namespace: p.Metadata.Namespace}
+	e.Metadata.Name = fmt.Sprintf("%s.%d", p.Metadata.Name, len(s.events)+1)
+	e.Metadata.CreationTimestamp = now
+	e.InvolvedObject = deploy.EventInvolvedObject{Kind: "Pod", Name: p.Metadata.Name}
+	e.Reason, e.Message, e.Type, e.Count = reason, message, "Warning", 1
+	e.FirstTimestamp, e.LastTimestamp = now, now
+	s.events = append(s.events, e)
+}
+
+// namespacedEvent is an Event with the namespace it was recorded in
+type namespacedEvent struct {
+	deploy.Event
+	namespace string
+}
@@ -0,0 +1,579 @@
+// Package deploytest runs a fake Kubernetes API server in memory, for testing code that deploys with the deploy package
+// end to end, offline.
+//
+//	server := deploytest.NewServer()
+//	defer server.Close()
+//	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 3)
+//	server.FailImage("artifactory.myorg.com:5010/myapp:bbb222", deploytest.CrashLoop)
+//
+//	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+//	err := cluster.Deploy("bbb222")
+//
+// It holds Deployments, ReplicaSets, Pods and Events. Deployments can be read, watched and changed with strategic merge
+// or JSON merge patches, and roll out to a new ReplicaSet a pod at a time when their pod template changes.
+// ReplicaSets and Pods can be read, listed a page at a time and watched, and Events listed.
+package deploytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Types of the events streamed to watches
+const (
+	added    = "ADDED"
+	modified = "MODIFIED"
+	deleted  = "DELETED"
+)
+
+// Server is a fake Kubernetes API server, served over TLS by an httptest.Server
+type Server struct {
+	*httptest.Server
+	// StepInterval is how often rollouts move on a pod. At zero, rollouts finish while the patch starting them is applied.
+	StepInterval time.Duration
+	// Token is the bearer token every request must have, when set
+	Token string
+
+	mutex           sync.Mutex
+	resourceVersion int64
+	names           int
+	deployments     map[string]*deployment
+	replicaSets     map[string]*replicaSet
+	pods            map[string]*pod
+	events          []namespacedEvent
+	logs            map[string]string
+	failures        map[string]Failure
+	requests        []string
+
+	// changes are every change made, for watches to stream, and changed is closed when another is made
+	changes []change
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// change is a change made to one object
+type change struct {
+	resourceVersion int64
+	namespace       string
+	resource        string
+	name            string
+	eventType       string
+	object          json.RawMessage
+}
+
+// NewServer starts a fake Kubernetes API server, holding nothing yet
+func NewServer() *Server {
+	s := &Server{
+		deployments: map[string]*deployment{},
+		replicaSets: map[string]*replicaSet{},
+		pods:        map[string]*pod{},
+		logs:        map[string]string{},
+		failures:    map[string]Failure{},
+		changed:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+// Close ends every watch and rollout, and shuts the server down
+func (s *Server) Close() {
+	s.mutex.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mutex.Unlock()
+	s.Server.Close()
+}
+
+// Endpoint is the host and port of the server, as the deploy package's clients take it
+func (s *Server) Endpoint() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// AddDeployment creates a deployment of one container, with its first ReplicaSet and every replica running
+func (s *Server) AddDeployment(namespace string, name string, containerName string, image string, replicas int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d := &deployment{}
+	d.Metadata = s.newMeta(namespace, name)
+	d.Metadata.Generation = 1
+	d.Metadata.Labels = map[string]string{"app": name}
+	d.Spec.Replicas = &replicas
+	d.Spec.Template.Metadata.Labels = map[string]string{"app": name}
+	d.Spec.Template.Spec.Containers = []deploy.DeploymentContainer{{Name: containerName, Image: image}}
+	s.deployments[key(namespace, name)] = d
+
+	s.rolloutReplicaSet(d)
+	s.record(added, "deployments", &d.Metadata, d)
+	for s.step(d) {
+	}
+}
+
+// FailImage makes the pods of the image fail to start from now on, so rollouts to it exceed their progress deadline
+func (s *Server) FailImage(image string, failure Failure) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[image] = failure
+}
+
+// SetLogs sets the logs served for a pod
+func (s *Server) SetLogs(namespace string, podName string, logs string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logs[key(namespace, podName)] = logs
+}
+
+// Deployment is the deployment as it is now
+func (s *Server) Deployment(namespace string, name string) (*deploy.Deployment, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.deployments[key(namespace, name)]
+	if !ok {
+		return nil, false
+	}
+	result := &deploy.Deployment{}
+	raw, _ := json.Marshal(d)
+	json.Unmarshal(raw, result)
+	return result, true
+}
+
+// Pods are the pods in the namespace now, by name
+func (s *Server) Pods(namespace string) []deploy.PodMetadataContainer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := []deploy.PodMetadataContainer{}
+	for _, p := range s.sortedPods(namespace) {
+		item := deploy.PodMetadataContainer{}
+		raw, _ := json.Marshal(p)
+		json.Unmarshal(raw, &item)
+		result = append(result, item)
+	}
+	return result
+}
+
+// Requests lists the method and path of every request served so far
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// ClusterNamespace connects to a deployment on the server with every client the deploy package has,
+// deploying the image of its container with other tags
+func (s *Server) ClusterNamespace(namespace string, deploymentName string, containerName string) *deploy.KubernetesClusterNamespace {
+	image := ""
+	if d, ok := s.Deployment(namespace, deploymentName); ok {
+		image = imageRepository(d.ContainerImage(containerName))
+	}
+
+	client, endpoint, token := s.Client(), s.Endpoint(), Token(s.Token)
+	return &deploy.KubernetesClusterNamespace{
+		Description:    namespace,
+		DeploymentName: deploymentName,
+		PodRetriever: &deploy.KubernetesPodListRetriever{
+			Client: client, Endpoint: endpoint, Namespace: namespace, BearerTokenService: token,
+		},
+		EventRetriever: &deploy.KubernetesEventListRetriever{
+			Client: client, Endpoint: endpoint, Namespace: namespace, BearerTokenService: token,
+		},
+		DeployMaker: &deploy.KubernetesDeployer{
+			Client: client, Endpoint: endpoint, Namespace: namespace, BearerTokenService: token,
+			DeploymentName: deploymentName, ContainerName: containerName, ContainerImage: image,
+		},
+	}
+}
+
+// Token is a bearer token that never changes
+type Token string
+
+// RetrieveToken returns the token
+func (t Token) RetrieveToken() string {
+	return string(t)
+}
+
+// ServeHTTP answers a request to the Kubernetes API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.mutex.Unlock()
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeJSON(w, http.StatusUnauthorized, status(http.StatusUnauthorized, "Unauthorized", "Unauthorized"))
+		return
+	}
+
+	namespace, resource, name, subresource, ok := parsePath(r.URL.Path)
+	query := r.URL.Query()
+	switch {
+	case !ok || !known(resource):
+		writeJSON(w, http.StatusNotFound, status(http.StatusNotFound, "NotFound", "the server could not find the requested resource"))
+	case r.Method == http.MethodGet && name == "" && query.Get("watch") == "true":
+		s.watch(w, r, namespace, resource)
+	case r.Method == http.MethodGet && name == "":
+		s.list(w, r, namespace, resource)
+	case r.Method == http.MethodGet && subresource == "" && resource != "events":
+		s.get(w, namespace, resource, name)
+	case r.Method == http.MethodGet && resource == "pods" && subresource == "log":
+		s.podLog(w, r, namespace, name)
+	case r.Method == http.MethodPatch && resource == "deployments" && subresource == "":
+		s.patchDeployment(w, r, namespace, name)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, status(http.StatusMethodNotAllowed, "MethodNotAllowed", "the server does not allow this method on the requested resource"))
+	}
+}
+
+// parsePath splits `/api/v1/namespaces/myapp/pods/mypod/log`, or the path of a resource in an API group,
+// into the namespace, resource, name and subresource
+func parsePath(path string) (namespace string, resource string, name string, subresource string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] != "namespaces" {
+			continue
+		}
+		rest := append(parts[i+2:], "", "")
+		return parts[i+1], rest[0], rest[1], rest[2], len(parts) <= i+5
+	}
+	return "", "", "", "", false
+}
+
+func known(resource string) bool {
+	switch resource {
+	case "deployments", "replicasets", "pods", "events":
+		return true
+	}
+	return false
+}
+
+// objects are the JSON of each object of the resource in the namespace, by name
+func (s *Server) objects(namespace string, resource string) ([]string, map[string]json.RawMessage) {
+	objects := map[string]json.RawMessage{}
+	add := func(objectNamespace string, name string, object interface{}) {
+		if objectNamespace == namespace {
+			objects[name], _ = json.Marshal(object)
+		}
+	}
+
+	switch resource {
+	case "deployments":
+		for _, d := range s.deployments {
+			add(d.Metadata.Namespace, d.Metadata.Name, d)
+		}
+	case "replicasets":
+		for _, r := range s.replicaSets {
+			add(r.Metadata.Namespace, r.Metadata.Name, r)
+		}
+	case "pods":
+		for _, p := range s.pods {
+			add(p.Metadata.Namespace, p.Metadata.Name, p)
+		}
+	case "events":
+		for _, e := range s.events {
+			add(e.namespace, e.Metadata.Name, e.Event)
+		}
+	}
+
+	names := []string{}
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, objects
+}
+
+// list writes the objects of the resource, narrowed by a `metadata.name=` field selector and paged by limit and continue
+func (s *Server) list(w http.ResponseWriter, r *http.Request, namespace string, resource string) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	names, objects := s.objects(namespace, resource)
+	metadata := deploy.ListMetadata{ResourceVersion: strconv.FormatInt(s.resourceVersion, 10)}
+	s.mutex.Unlock()
+
+	items := []json.RawMessage{}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	for _, name := range names {
+		if !selected(query.Get("fieldSelector"), name) || (query.Get("continue") != "" && name <= query.Get("continue")) {
+			continue
+		}
+		if limit > 0 && len(items) == limit {
+			metadata.Continue = lastName(items)
+			break
+		}
+		items = append(items, objects[name])
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind":     listKind(resource),
+		"metadata": metadata,
+		"items":    items,
+	})
+}
+
+// lastName is the name of the last object, which the next page starts after
+func lastName(items []json.RawMessage) string {
+	object := &struct {
+		Metadata objectMeta `json:"metadata"`
+	}{}
+	json.Unmarshal(items[len(items)-1], object)
+	return object.Metadata.Name
+}
+
+func selected(fieldSelector string, name string) bool {
+	return fieldSelector == "" || fieldSelector == "metadata.name="+name
+}
+
+func listKind(resource string) string {
+	switch resource {
+	case "deployments":
+		return "DeploymentList"
+	case "replicasets":
+		return "ReplicaSetList"
+	case "pods":
+		return "PodList"
+	}
+	return "EventList"
+}
+
+// get writes one object
+func (s *Server) get(w http.ResponseWriter, namespace string, resource string, name string) {
+	s.mutex.Lock()
+	_, objects := s.objects(namespace, resource)
+	s.mutex.Unlock()
+
+	object, ok := objects[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, status(http.StatusNotFound, "NotFound", fmt.Sprintf("%s %q not found", resource, name)))
+		return
+	}
+	writeJSON(w, http.StatusOK, object)
+}
+
+// podLog writes the logs set for the pod, only the last tailLines of them when asked
+func (s *Server) podLog(w http.ResponseWriter, r *http.Request, namespace string, name string) {
+	s.mutex.Lock()
+	_, ok := s.pods[key(namespace, name)]
+	logs := s.logs[key(namespace, name)]
+	s.mutex.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, status(http.StatusNotFound, "NotFound", fmt.Sprintf("pods %q not found", name)))
+		return
+	}
+	if tail, err := strconv.Atoi(r.URL.Query().Get("tailLines")); err == nil {
+		lines := strings.SplitAfter(strings.TrimSuffix(logs, "\n"), "\n")
+		if tail < len(lines) {
+			lines = lines[len(lines)-tail:]
+		}
+		logs = strings.Join(lines, "")
+		if logs != "" && !strings.HasSuffix(logs, "\n") {
+			logs += "\n"
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(logs))
+}
+
+// watch streams the changes made to the resource after the resourceVersion asked for, until the client goes away,
+// timeoutSeconds pass or the server closes. Without a resourceVersion, every object is sent as ADDED first.
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, namespace string, resource string) {
+	query := r.URL.Query()
+	var timeout <-chan time.Time
+	if seconds, err := strconv.Atoi(query.Get("timeoutSeconds")); err == nil && seconds > 0 {
+		timeout = time.After(time.Duration(seconds) * time.Second)
+	}
+
+	s.mutex.Lock()
+	from, err := strconv.ParseInt(query.Get("resourceVersion"), 10, 64)
+	pending := []change{}
+	if err != nil || from == 0 {
+		names, objects := s.objects(namespace, resource)
+		for _, name := range names {
+			pending = append(pending, change{name: name, eventType: added, object: objects[name]})
+		}
+		from = s.resourceVersion
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		for _, c := range pending {
+			if !selected(query.Get("fieldSelector"), c.name) {
+				continue
+			}
+			if encoder.Encode(map[string]interface{}{"type": c.eventType, "object": c.object}) != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+
+		s.mutex.Lock()
+		pending = []change{}
+		for _, c := range s.changes {
+			if c.resourceVersion > from && c.namespace == namespace && c.resource == resource {
+				pending = append(pending, c)
+				from = c.resourceVersion
+			}
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+		if len(pending) > 0 {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// patchDeployment applies a patch to a deployment, rolling it out when its pod template or replicas changed
+func (s *Server) patchDeployment(w http.ResponseWriter, r *http.Request, namespace string, name string) {
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, status(http.StatusBadRequest, "BadRequest", err.Error()))
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != StrategicMergePatch && contentType != MergePatch {
+		writeJSON(w, http.StatusUnsupportedMediaType, status(http.StatusUnsupportedMediaType, "UnsupportedMediaType", fmt.Sprintf("the body of the request was in an unknown format: %s", contentType)))
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d, ok := s.deployments[key(namespace, name)]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, status(http.StatusNotFound, "NotFound", fmt.Sprintf("deployments %q not found", name)))
+		return
+	}
+
+	original, _ := json.Marshal(d)
+	patched, err := applyPatch(original, raw, contentType)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, status(http.StatusBadRequest, "BadRequest", err.Error()))
+		return
+	}
+	next := &deployment{}
+	err = json.Unmarshal(patched, next)
+	if err == nil {
+		err = validate(next)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, status(http.StatusUnprocessableEntity, "Invalid", fmt.Sprintf("Deployment %q is invalid: %s", name, err.Error())))
+		return
+	}
+
+	// a patch cannot change who the deployment is, nor its status
+	next.Metadata.Name, next.Metadata.Namespace, next.Metadata.UID = d.Metadata.Name, d.Metadata.Namespace, d.Metadata.UID
+	next.Metadata.Generation, next.Metadata.CreationTimestamp = d.Metadata.Generation, d.Metadata.CreationTimestamp
+	next.Status, next.rollout, next.failedSteps, next.exceeded = d.Status, d.rollout, d.failedSteps, d.exceeded
+	templateChanged := next.Spec.Template.hash() != d.Spec.Template.hash()
+	scaled := next.desiredReplicas() != d.desiredReplicas()
+	if templateChanged || scaled {
+		next.Metadata.Generation++
+	}
+	*d = *next
+
+	if templateChanged {
+		s.rolloutReplicaSet(d)
+	}
+	s.record(modified, "deployments", &d.Metadata, d)
+	if templateChanged || scaled {
+		s.startRollout(d)
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// validate checks what the API server would refuse to roll out
+func validate(d *deployment) error {
+	if d.Spec.Replicas != nil && *d.Spec.Replicas < 0 {
+		return fmt.Errorf("spec.replicas: Invalid value: %d: must be greater than or equal to 0", *d.Spec.Replicas)
+	}
+	if len(d.Spec.Template.Spec.Containers) == 0 {
+		return fmt.Errorf("spec.template.spec.containers: Required value")
+	}
+	for i, container := range d.Spec.Template.Spec.Containers {
+		if container.Name == "" {
+			return fmt.Errorf("spec.template.spec.containers[%d].name: Required value", i)
+		}
+		if container.Image == "" {
+			return fmt.Errorf("spec.template.spec.containers[%d].image: Required value", i)
+		}
+	}
+	return nil
+}
+
+// record gives the object the next resource version, and keeps the change for watches
+func (s *Server) record(eventType string, resource string, metadata *objectMeta, object interface{}) {
+	s.resourceVersion++
+	metadata.ResourceVersion = strconv.FormatInt(s.resourceVersion, 10)
+	raw, _ := json.Marshal(object)
+	s.changes = append(s.changes, change{
+		resourceVersion: s.resourceVersion,
+		namespace:       metadata.Namespace,
+		resource:        resource,
+		name:            metadata.Name,
+		eventType:       eventType,
+		object:          raw,
+	})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// newMeta is the metadata of a new object
+func (s *Server) newMeta(namespace string, name string) objectMeta {
+	s.names++
+	return objectMeta{
+		Name:              name,
+		Namespace:         namespace,
+		UID:               fmt.Sprintf("00000000-0000-0000-0000-%012d", s.names),
+		CreationTimestamp: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// sortedPods are the pods in the namespace, by name
+func (s *Server) sortedPods(namespace string) []*pod {
+	pods := []*pod{}
+	for _, p := range s.pods {
+		if p.Metadata.Namespace == namespace {
+			pods = append(pods, p)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Metadata.Name < pods[j].Metadata.Name })
+	return pods
+}
+
+func key(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,262 @@
+package deploytest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployRollsOut(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 3)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+
+	err := cluster.Deploy("bbb222")
+	assert.Nil(t, err)
+
+	deployment, err := cluster.GetDeployment()
+	assert.Nil(t, err)
+	assert.True(t, deployment.RolloutComplete())
+	assert.Equal(t, int64(2), deployment.Metadata.Generation)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:bbb222", deployment.ContainerImage("myapp-container"))
+
+	podList, err := cluster.GetPodList()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(podList.Items))
+	for _, pod := range podList.Overview() {
+		assert.Equal(t, "bbb222", pod.Tag)
+		assert.True(t, pod.Ready)
+		assert.True(t, strings.HasPrefix(pod.Digest, "sha256:"))
+	}
+
+	revisions, err := cluster.History()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, int64(2), revisions[0].Number)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:bbb222", revisions[0].Image)
+	assert.Equal(t, 3, revisions[0].Replicas)
+	assert.Equal(t, 0, revisions[1].Replicas)
+}
+
+func TestRollbackReusesReplicaSet(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 2)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+	cluster.Deploy("bbb222")
+
+	err := cluster.Rollback(deploy.DeployRequest{User: "alice"}, 0)
+	assert.Nil(t, err)
+
+	revisions, _ := cluster.History()
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, int64(3), revisions[0].Number)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp:aaa111", revisions[0].Image)
+	deployment, _ := server.Deployment("myapp", "myapp-deployment")
+	assert.Equal(t, "3", deployment.Metadata.Annotations[deploy.RevisionAnnotation])
+}
+
+func TestCrashLoopExceedsProgressDeadline(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 3)
+	server.FailImage("artifactory.myorg.com:5010/myapp:bbb222", CrashLoop)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+
+	err := cluster.Deploy("bbb222")
+	assert.Nil(t, err)
+	deployment, err := cluster.DeployMaker.(*deploy.KubernetesDeployer).WaitForRollout(time.Second, time.Millisecond)
+	assert.EqualError(t, err, "rollout of myapp-deployment exceeded its progress deadline")
+	assert.True(t, deployment.RolloutFailed())
+	assert.Equal(t, 3, deployment.Status.AvailableReplicas)
+	assert.Equal(t, 1, deployment.Status.UpdatedReplicas)
+
+	// the old pods keep serving while the new one crashes
+	pods := map[string][]deploy.PodItem{}
+	podList, _ := cluster.GetPodList()
+	for _, pod := range podList.Overview() {
+		pods[pod.Tag] = append(pods[pod.Tag], pod)
+	}
+	assert.Equal(t, 3, len(pods["aaa111"]))
+	assert.Equal(t, 1, len(pods["bbb222"]))
+	assert.Equal(t, "CrashLoopBackOff", pods["bbb222"][0].Reason)
+	assert.Equal(t, ProgressDeadlineSteps, pods["bbb222"][0].Restarts)
+
+	events, err := cluster.GetEventList()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, "BackOff", events.Items[0].Reason)
+	assert.Equal(t, ProgressDeadlineSteps, events.Items[0].Count)
+}
+
+func TestImagePullFailure(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+	server.FailImage("artifactory.myorg.com:5010/myapp:zzz999", ImagePullFailure)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+
+	cluster.Deploy("zzz999")
+	pods := server.Pods("myapp")
+	assert.Equal(t, 2, len(pods))
+	pulling := pods[1]
+	if pulling.Status.Phase != "Pending" {
+		pulling = pods[0]
+	}
+	assert.Equal(t, "Pending", pulling.Status.Phase)
+	assert.Equal(t, "ImagePullBackOff", pulling.Status.ContainerStatuses[0].State.Waiting.Reason)
+
+	events, _ := cluster.GetEventList()
+	assert.Equal(t, "Failed", events.Items[0].Reason)
+	assert.Equal(t, `Failed to pull image "artifactory.myorg.com:5010/myapp:zzz999": manifest unknown`, events.Items[0].Message)
+	deployment, _ := server.Deployment("myapp", "myapp-deployment")
+	assert.True(t, deployment.RolloutFailed())
+}
+
+func TestWatchFollowsRollout(t *testing.T) {
+	server := NewServer()
+	server.StepInterval = 2 * time.Millisecond
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 3)
+	deployer := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container").DeployMaker.(*deploy.KubernetesDeployer)
+
+	stop := make(chan struct{})
+	changes := make(chan *deploy.Deployment, 100)
+	go deployer.Watch(stop, changes)
+	defer close(stop)
+	assert.True(t, (<-changes).RolloutComplete())
+
+	err := deployer.Deploy("bbb222")
+	assert.Nil(t, err)
+
+	updated := map[int]bool{}
+	for deployment := range changes {
+		updated[deployment.Status.UpdatedReplicas] = true
+		if deployment.Metadata.Generation == 2 && deployment.RolloutComplete() {
+			break
+		}
+	}
+	assert.Equal(t, map[int]bool{0: true, 1: true, 2: true, 3: true}, updated)
+}
+
+func TestPodsArePaged(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 5)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+	cluster.PodRetriever.(*deploy.KubernetesPodListRetriever).PageSize = 2
+
+	podList, err := cluster.GetPodList()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(podList.Items))
+
+	lists := 0
+	for _, request := range server.Requests() {
+		if request == "GET /api/v1/namespaces/myapp/pods" {
+			lists++
+		}
+	}
+	assert.Equal(t, 3, lists)
+}
+
+func TestNamespaceCacheFollowsDeploy(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 2)
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+
+	cache := &deploy.NamespaceCache{Client: server.Client(), Endpoint: server.Endpoint(), Namespace: "myapp", BearerTokenService: Token("")}
+	synced := make(chan deploy.CacheEvent, 100)
+	cache.AddEventHandler(func(event deploy.CacheEvent) {
+		if event.Kind == deploy.KindDeployment && event.Type == deploy.CacheModified {
+			synced <- event
+		}
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	assert.True(t, cache.WaitForSync(stop))
+	assert.Equal(t, 2, len(cache.PodsWithTag("aaa111").Items))
+
+	cluster.Deploy("bbb222")
+	for {
+		event := <-synced
+		if event.Object.(*deploy.Deployment).RolloutComplete() {
+			break
+		}
+	}
+	for len(cache.PodsWithTag("aaa111").Items) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 2, len(cache.PodsWithTag("bbb222").Items))
+}
+
+func TestPodLogs(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+	name := server.Pods("myapp")[0].Metadata.Name
+	server.SetLogs("myapp", name, "starting\nlistening on :8080\nready\n")
+	retriever := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container").PodRetriever.(*deploy.KubernetesPodListRetriever)
+
+	logs, err := retriever.PodLogs(name, "myapp-container", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "listening on :8080\nready\n", logs)
+
+	_, err = retriever.PodLogs("missing", "myapp-container", 2)
+	assert.Contains(t, err.Error(), "/pods/missing/log?container=myapp-container&tailLines=2 in namespace myapp: received 404")
+}
+
+func TestTokenIsRequired(t *testing.T) {
+	server := NewServer()
+	server.Token = "secret"
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+
+	cluster := server.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+	_, err := cluster.GetDeployment()
+	assert.Nil(t, err)
+
+	cluster.DeployMaker.(*deploy.KubernetesDeployer).BearerTokenService = Token("stolen")
+	_, err = cluster.GetDeployment()
+	assert.Contains(t, err.Error(), ": received 401")
+}
+
+func TestPatchIsChecked(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 1)
+	url := server.URL + "/apis/apps/v1/namespaces/myapp/deployments/"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"myapp-deployment", "application/json-patch+json", `[]`, http.StatusUnsupportedMediaType},
+		{"myapp-deployment", StrategicMergePatch, `[]`, http.StatusBadRequest},
+		{"myapp-deployment", StrategicMergePatch, `{"spec":{"template":{"spec":{"containers":[{"name":"sidecar"}]}}}}`, http.StatusUnprocessableEntity},
+		{"missing", StrategicMergePatch, `{}`, http.StatusNotFound},
+		{"myapp-deployment", MergePatch, `{"spec":{"replicas":2}}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPatch, url+test.name, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		res, err := server.Client().Do(req)
+		assert.Nil(t, err)
+		res.Body.Close()
+		assert.Equal(t, test.code, res.StatusCode, test.body)
+	}
+
+	// scaling is not a new revision
+	deployment, _ := server.Deployment("myapp", "myapp-deployment")
+	assert.True(t, deployment.RolloutComplete())
+	assert.Equal(t, 2, deployment.Status.ReadyReplicas)
+	assert.Equal(t, "1", deployment.Metadata.Annotations[deploy.RevisionAnnotation])
+}
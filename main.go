@@ -2,110 +2,36 @@ package main
 
 import (
 	"crypto/tls"
-	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/Unity-Technologies/kubernetes-deploy/cli"
 	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
 	"github.com/joho/godotenv"
 )
 
+// The kubernetes-deploy command line. Run `go run main.go help` to list its commands.
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
+	// .env is optional, the variables may already be set, e.g. in CI
+	godotenv.Load()
 
 	client := &http.Client{
 		Timeout: time.Second * 30,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		Transport: &deploy.RetryTransport{
+			Transport: &deploy.RateLimitTransport{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				},
+				Limiter: &deploy.RateLimiter{QPS: deploy.DefaultQPS, Burst: deploy.DefaultBurst},
+			},
 		},
 	}
 
-	tokenProvider := new(sampleBearerTokenProvider)
-
-	cluster := deploy.KubernetesClusterNamespace{
-		Description: os.Getenv("DESCRIPTION"),
-		PodRetriever: &deploy.KubernetesPodListRetriever{
-			Client:             client,
-			Endpoint:           os.Getenv("KUBERNETES_ENDPOINT"),
-			Namespace:          os.Getenv("KUBERNETES_NAMESPACE"),
-			BearerTokenService: tokenProvider,
-		},
-		DeployMaker: &deploy.KubernetesDeployer{
-			Client:             client,
-			Endpoint:           os.Getenv("KUBERNETES_ENDPOINT"),
-			Namespace:          os.Getenv("KUBERNETES_NAMESPACE"),
-			BearerTokenService: tokenProvider,
-			DeploymentName:     os.Getenv("KUBERNETES_DEPLOYMENT_NAME"),
-			ContainerName:      os.Getenv("KUBERNETES_DEPLOYMENT_CONTAINERNAME"),
-			ContainerImage:     os.Getenv("KUBERNETES_DEPLOYMENT_IMAGE_PREFIX"),
-		},
+	c := &cli.CLI{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Client: client,
 	}
-
-	command, containerTag := pickCommand(os.Args)
-
-	if command == "ls" {
-		// Get a list of pods and their status
-		podList, err := cluster.GetPodList()
-		if err != nil {
-			fmt.Printf("Unable to retrieve pod list due to %s", err.Error())
-			return
-		}
-
-		printStatus(podList, "")
-	}
-
-	if command == "deploy" {
-		// Deploy container named KUBERNETES_DEPLOYMENT_IMAGE_PREFIX:tag
-		err := cluster.Deploy(containerTag)
-		if err != nil {
-			fmt.Printf("Unable to deploy %q due to %s", containerTag, err.Error())
-			return
-		}
-
-		podList, _ := cluster.GetPodList()
-		printStatus(podList, containerTag)
-	}
-}
-
-// Sample BearerTokenRetriever
-type sampleBearerTokenProvider struct{}
-
-func (*sampleBearerTokenProvider) RetrieveToken() string {
-	return os.Getenv("KUBERNETES_ENDPOINT_BEARER_TOKEN")
-}
-
-//
-// Helpers
-//
-
-// printStatus runs through all pods in a deployment, and displays their status.
-func printStatus(podList *deploy.PodList, desiredImageTag string) {
-	now := time.Now()
-
-	overview := podList.Overview()
-	for _, overview := range overview {
-		fmt.Printf("`%s` image has been *%s* for %.1f hours.\n",
-			overview.Tag,
-			overview.Status,
-			now.Sub(overview.Created).Hours())
-	}
-}
-
-// pickCommand supports `deploy <hash>` otherwise defaults to `ls`
-func pickCommand(osArgs []string) (string, string) {
-	args := osArgs[1:]
-
-	command := "ls"
-	tag := ""
-
-	if len(args) == 2 && args[0] == "deploy" {
-		command = args[0]
-		tag = args[1]
-	}
-
-	return command, tag
+	os.Exit(c.Run(os.Args[1:]))
 }
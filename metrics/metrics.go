@@ -0,0 +1,394 @@
+// Package metrics counts deploys, rollouts and Kubernetes API calls as Prometheus collectors.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Buckets for durations in seconds
+var (
+	APILatencyBuckets     = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	DeployDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200}
+)
+
+// Metrics holds every collector. It is a prometheus.Collector itself, so it can be registered on an
+// existing prometheus.Registry, or served on its own registry on /metrics for Prometheus to scrape.
+//
+//	m := metrics.NewMetrics()
+//	client.Transport = m.Transport(client.Transport)
+//	m.Instrument("staging", cluster)
+//	http.Handle("/metrics", m)
+type Metrics struct {
+	Deploys             *prometheus.CounterVec
+	DeployDuration      *prometheus.HistogramVec
+	Rollbacks           *prometheus.CounterVec
+	RolloutDuration     *prometheus.HistogramVec
+	APIRequests         *prometheus.CounterVec
+	APIRequestDuration  *prometheus.HistogramVec
+	TokenRefreshFailure *prometheus.CounterVec
+
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	mutex sync.Mutex
+	// rollouts are the rollouts followed through a NamespaceCache, by environment.
+	// A later deploy of an environment takes the place of one still rolling out.
+	rollouts map[string]*followedRollout
+	// caches are the caches telling the rollouts about changed deployments
+	caches map[*deploy.NamespaceCache]bool
+}
+
+// followedRollout is a rollout timed from the deployment changes its cluster namespace's cache sees
+type followedRollout struct {
+	cache      *deploy.NamespaceCache
+	deployment string
+	image      string
+	patched    time.Time
+	deadline   time.Time
+}
+
+// NewMetrics creates every collector, and a registry holding them for ServeHTTP
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Deploys: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubernetes_deploy_attempts_total",
+			Help: "Deploy and rollback attempts, by environment, action and result.",
+		}, []string{"environment", "action", "result"}),
+		DeployDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kubernetes_deploy_duration_seconds",
+			Help:    "How long deploys and rollbacks took, including any rollout hooks.",
+			Buckets: DeployDurationBuckets,
+		}, []string{"environment", "action"}),
+		Rollbacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubernetes_deploy_rollbacks_total",
+			Help: "Rollbacks, by environment and result.",
+		}, []string{"environment", "result"}),
+		RolloutDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kubernetes_deploy_rollout_duration_seconds",
+			Help:    "How long rollouts took from the patch until they finished, by environment and result.",
+			Buckets: DeployDurationBuckets,
+		}, []string{"environment", "result"}),
+		APIRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubernetes_deploy_api_requests_total",
+			Help: "Kubernetes API requests, by verb, resource and status code.",
+		}, []string{"verb", "resource", "code"}),
+		APIRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kubernetes_deploy_api_request_duration_seconds",
+			Help:    "Kubernetes API request latency, by verb and resource.",
+			Buckets: APILatencyBuckets,
+		}, []string{"verb", "resource"}),
+		TokenRefreshFailure: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubernetes_deploy_token_refresh_failures_total",
+			Help: "Bearer token retrievals that returned no token, by environment.",
+		}, []string{"environment"}),
+		registry: prometheus.NewRegistry(),
+		rollouts: map[string]*followedRollout{},
+		caches:   map[*deploy.NamespaceCache]bool{},
+	}
+	m.registry.MustRegister(m)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// Describe sends the descriptions of every collector, for prometheus.Collector
+func (m *Metrics) Describe(descriptions chan<- *prometheus.Desc) {
+	for _, collector := range m.collectors() {
+		collector.Describe(descriptions)
+	}
+}
+
+// Collect sends the current value of every collector, for prometheus.Collector
+func (m *Metrics) Collect(metrics chan<- prometheus.Metric) {
+	for _, collector := range m.collectors() {
+		collector.Collect(metrics)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.Deploys, m.DeployDuration, m.Rollbacks, m.RolloutDuration,
+		m.APIRequests, m.APIRequestDuration, m.TokenRefreshFailure}
+}
+
+// ServeHTTP serves every collector in the Prometheus exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// Instrument counts the deploys, rollbacks and token refresh failures of a cluster namespace as the environment,
+// alongside its existing Auditor, and times the rollout of each deploy without making more API calls.
+// A deploy that waits for its rollout, because the cluster namespace has rollout hooks, is timed when the wait is over.
+// Otherwise the rollout is timed from the deployment changes seen by the cluster namespace's Cache, up to the
+// hooks' RolloutTimeout. Without either, the rollout is not timed. Each deploy is looked at as it happens,
+// so hooks and a Cache can be set before or after Instrument.
+func (m *Metrics) Instrument(environment string, cluster *deploy.KubernetesClusterNamespace) {
+	auditor := m.Auditor(environment)
+	if cluster.Auditor != nil {
+		auditor = deploy.MultiAuditor{cluster.Auditor, auditor}
+	}
+	cluster.Auditor = auditor
+	m.instrumentTokens(environment, cluster)
+
+	cluster.Hooks.AfterPatch = append(cluster.Hooks.AfterPatch, m.followRolloutHook(environment))
+	cluster.Hooks.AfterRollout = append(cluster.Hooks.AfterRollout, m.rolloutHook(environment))
+}
+
+// Auditor counts each deploy attempt as the environment
+func (m *Metrics) Auditor(environment string) deploy.DeployAuditor {
+	return &auditor{metrics: m, environment: environment}
+}
+
+type auditor struct {
+	metrics     *Metrics
+	environment string
+}
+
+// AuditDeploy counts the attempt and records its duration
+func (a *auditor) AuditDeploy(record deploy.DeployAuditRecord) error {
+	a.metrics.Deploys.WithLabelValues(a.environment, record.Action, record.Result).Inc()
+	a.metrics.DeployDuration.WithLabelValues(a.environment, record.Action).Observe(record.DurationSeconds)
+	if record.Action == deploy.AuditActionRollback {
+		a.metrics.Rollbacks.WithLabelValues(a.environment, record.Result).Inc()
+	}
+	return nil
+}
+
+// instrumentTokens wraps the token retriever of each Kubernetes component of the cluster namespace
+func (m *Metrics) instrumentTokens(environment string, cluster *deploy.KubernetesClusterNamespace) {
+	wrap := func(retriever *deploy.BearerTokenRetriever) {
+		if *retriever != nil {
+			*retriever = m.TokenRetriever(environment, *retriever)
+		}
+	}
+	if component, ok := cluster.PodRetriever.(*deploy.KubernetesPodListRetriever); ok {
+		wrap(&component.BearerTokenService)
+	}
+	if component, ok := cluster.EventRetriever.(*deploy.KubernetesEventListRetriever); ok {
+		wrap(&component.BearerTokenService)
+	}
+	if component, ok := cluster.ServiceClient.(*deploy.KubernetesServiceClient); ok {
+		wrap(&component.BearerTokenService)
+	}
+	if component, ok := cluster.DeployMaker.(*deploy.KubernetesDeployer); ok {
+		wrap(&component.BearerTokenService)
+	}
+}
+
+// followRolloutHook follows the rollout through the cache of the cluster namespace, when it has one
+// and the deploy does not wait for the rollout itself
+func (m *Metrics) followRolloutHook(environment string) deploy.DeployHook {
+	return func(ctx *deploy.DeployContext) error {
+		hooks := ctx.Cluster.Hooks
+		if _, ok := ctx.Deployer.(deploy.RolloutWaiter); ok && len(hooks.AfterRolloutSuccess)+len(hooks.AfterRolloutFailure) > 0 {
+			return nil
+		}
+		cache := ctx.Cluster.Cache
+		if cache == nil {
+			return nil
+		}
+
+		deploymentName := ctx.Cluster.DeploymentName
+		if target, ok := ctx.Deployer.(deploy.DeployTarget); ok {
+			_, deploymentName = target.Location()
+		}
+		timeout := hooks.RolloutTimeout
+		if timeout == 0 {
+			timeout = 10 * time.Minute
+		}
+
+		m.mutex.Lock()
+		m.rollouts[environment] = &followedRollout{
+			cache:      cache,
+			deployment: deploymentName,
+			image:      ctx.Request.Image,
+			patched:    ctx.Patched,
+			deadline:   ctx.Patched.Add(timeout),
+		}
+		follows := m.caches[cache]
+		m.caches[cache] = true
+		m.mutex.Unlock()
+
+		if !follows {
+			cache.AddEventHandler(func(event deploy.CacheEvent) {
+				m.deploymentChanged(cache, event)
+			})
+		}
+		return nil
+	}
+}
+
+// deploymentChanged records the followed rollouts of a deployment the cache saw change, once they have finished
+func (m *Metrics) deploymentChanged(cache *deploy.NamespaceCache, event deploy.CacheEvent) {
+	deployment, ok := event.Object.(*deploy.Deployment)
+	if event.Kind != deploy.KindDeployment || !ok {
+		return
+	}
+
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for environment, rollout := range m.rollouts {
+		if rollout.cache != cache || rollout.deployment != event.Name {
+			continue
+		}
+		result := rollout.result(deployment, now)
+		if result == "" {
+			continue
+		}
+		delete(m.rollouts, environment)
+		m.RolloutDuration.WithLabelValues(environment, result).Observe(now.Sub(rollout.patched).Seconds())
+	}
+}
+
+// result is how the rollout ended given the deployment now, or empty while it is still going
+func (r *followedRollout) result(deployment *deploy.Deployment, now time.Time) string {
+	switch {
+	case deployment.RolloutFailed() || now.After(r.deadline):
+		return deploy.AuditResultFailure
+	case deployment.RolloutComplete() && r.rolledOutImage(deployment):
+		return deploy.AuditResultSuccess
+	}
+	return ""
+}
+
+// rolledOutImage is true when the deployment runs the image deployed, so an earlier finished rollout is not mistaken for it
+func (r *followedRollout) rolledOutImage(deployment *deploy.Deployment) bool {
+	if r.image == "" {
+		return true
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Image == r.image {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutHook records how long the rollout the deploy waited for took since the patch
+func (m *Metrics) rolloutHook(environment string) deploy.DeployHook {
+	return func(ctx *deploy.DeployContext) error {
+		result := deploy.AuditResultSuccess
+		if ctx.Err != nil {
+			result = deploy.AuditResultFailure
+		}
+		m.RolloutDuration.WithLabelValues(environment, result).Observe(time.Since(ctx.Patched).Seconds())
+		return nil
+	}
+}
+
+// TokenRetriever counts the times retriever returns no token as refresh failures of the environment
+func (m *Metrics) TokenRetriever(environment string, retriever deploy.BearerTokenRetriever) deploy.BearerTokenRetriever {
+	return &tokenRetriever{metrics: m, environment: environment, retriever: retriever}
+}
+
+type tokenRetriever struct {
+	metrics     *Metrics
+	environment string
+	retriever   deploy.BearerTokenRetriever
+}
+
+// RetrieveToken retrieves the token, counting a failure when there is none
+func (t *tokenRetriever) RetrieveToken() string {
+	token := t.retriever.RetrieveToken()
+	if token == "" {
+		t.metrics.TokenRefreshFailure.WithLabelValues(t.environment).Inc()
+	}
+	return token
+}
+
+// Transport counts and times each Kubernetes API request sent through next, defaulting to http.DefaultTransport
+func (m *Metrics) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{metrics: m, next: next}
+}
+
+type transport struct {
+	metrics *Metrics
+	next    http.RoundTripper
+}
+
+// RoundTrip sends the request, recording its verb, resource, status code and latency
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, resource := APIVerb(req), APIResource(req.URL.Path)
+	started := time.Now()
+	res, err := t.next.RoundTrip(req)
+	t.metrics.APIRequestDuration.WithLabelValues(verb, resource).Observe(time.Since(started).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	t.metrics.APIRequests.WithLabelValues(verb, resource, code).Inc()
+	return res, err
+}
+
+// APIVerb is the Kubernetes verb of a request, e.g. list, get, watch or patch
+func APIVerb(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" {
+			return "watch"
+		}
+		if _, name := splitAPIPath(req.URL.Path); name == "" {
+			return "list"
+		}
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	}
+	return strings.ToLower(req.Method)
+}
+
+// APIResource is the resource of a request path, with any subresource, e.g. `pods` or `pods/log`
+func APIResource(path string) string {
+	resource, _ := splitAPIPath(path)
+	return resource
+}
+
+// splitAPIPath splits `/api/v1/namespaces/myapp/pods/mypod/log` into `pods/log` and `mypod`
+func splitAPIPath(path string) (resource string, name string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	namespaced := false
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "namespaces" {
+			parts, namespaced = parts[i+2:], true
+			break
+		}
+	}
+	// outside a namespace, the resource follows /api/v1 or /apis/group/version
+	if !namespaced && len(parts) > 0 && parts[0] == "api" {
+		parts = parts[minInt(2, len(parts)):]
+	} else if !namespaced && len(parts) > 0 && parts[0] == "apis" {
+		parts = parts[minInt(3, len(parts)):]
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return "unknown", ""
+	}
+
+	resource = parts[0]
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+	if len(parts) > 2 {
+		resource += "/" + parts[2]
+	}
+	return resource, name
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/Unity-Technologies/kubernetes-deploy/deploytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	m := NewMetrics()
+	client := &http.Client{Transport: m.Transport(server.Client().Transport)}
+	client.Get(server.URL + "/api/v1/namespaces/myapp-development/pods")
+	client.Get(server.URL + "/api/v1/namespaces/myapp-development/pods")
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/apis/extensions/v1beta1/namespaces/myapp-development/deployments/myapp-deployment", nil)
+	client.Do(req)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.APIRequests.WithLabelValues("list", "pods", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.APIRequests.WithLabelValues("patch", "deployments", "409")))
+	assert.Equal(t, uint64(2), histogramCount(m.APIRequestDuration, "list", "pods"))
+
+	server.Close()
+	client.Get(server.URL + "/api/v1/namespaces/myapp-development/pods/myapp-deployment-1-abcde")
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.APIRequests.WithLabelValues("get", "pods", "error")))
+}
+
+func TestAPIVerbAndResource(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		path     string
+		verb     string
+		resource string
+	}{
+		{http.MethodGet, "/api/v1/namespaces/myapp/pods", "list", "pods"},
+		{http.MethodGet, "/api/v1/namespaces/myapp/pods/mypod/log?tailLines=10", "get", "pods/log"},
+		{http.MethodGet, "/apis/extensions/v1beta1/namespaces/myapp/deployments?watch=true", "watch", "deployments"},
+		{http.MethodPatch, "/apis/extensions/v1beta1/namespaces/myapp/deployments/mydeployment", "patch", "deployments"},
+		{http.MethodPost, "/apis/batch/v1/namespaces/myapp/jobs", "create", "jobs"},
+		{http.MethodDelete, "/apis/batch/v1/namespaces/myapp/jobs/myjob", "delete", "jobs"},
+		{http.MethodGet, "/api/v1/nodes/mynode", "get", "nodes"},
+		{http.MethodGet, "/apis/apps/v1/deployments", "list", "deployments"},
+		{http.MethodGet, "/", "list", "unknown"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		assert.Equal(t, tt.verb, APIVerb(req), tt.path)
+		assert.Equal(t, tt.resource, APIResource(req.URL.Path), tt.path)
+	}
+}
+
+func TestInstrumentCountsDeploys(t *testing.T) {
+	m := NewMetrics()
+	audited := &MockAuditor{}
+	cluster := &deploy.KubernetesClusterNamespace{DeployMaker: &MockDeployer{}, Auditor: audited}
+	m.Instrument("staging", cluster)
+
+	assert.Nil(t, cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"}))
+	cluster.DeployMaker = &MockDeployer{err: fmt.Errorf("received 500")}
+	cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"})
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Deploys.WithLabelValues("staging", "deploy", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Deploys.WithLabelValues("staging", "deploy", "failure")))
+	assert.Equal(t, uint64(2), histogramCount(m.DeployDuration, "staging", "deploy"))
+	assert.Equal(t, 2, audited.records)
+	assert.Equal(t, 0, len(cluster.Hooks.AfterRolloutSuccess))
+}
+
+func TestInstrumentCountsRollbacks(t *testing.T) {
+	m := NewMetrics()
+	deployer := &MockDeployer{}
+	cluster := &deploy.KubernetesClusterNamespace{DeployMaker: deployer}
+	m.Instrument("production", cluster)
+
+	assert.Nil(t, cluster.Rollback(deploy.DeployRequest{}, 0))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Deploys.WithLabelValues("production", "rollback", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Rollbacks.WithLabelValues("production", "success")))
+}
+
+func TestInstrumentTimesAwaitedRollouts(t *testing.T) {
+	m := NewMetrics()
+	cluster := &deploy.KubernetesClusterNamespace{DeployMaker: &MockDeployer{}}
+	m.Instrument("staging", cluster)
+
+	// without rollout hooks the deploy does not wait, and there is no cache to follow the rollout with
+	assert.Nil(t, cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"}))
+	assert.Equal(t, uint64(0), histogramCount(m.RolloutDuration, "staging", "success"))
+
+	// rollout hooks added after Instrument make the deploy wait, and the wait is timed
+	cluster.Hooks.AfterRolloutSuccess = []deploy.DeployHook{func(ctx *deploy.DeployContext) error { return nil }}
+	assert.Nil(t, cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"}))
+	assert.Equal(t, uint64(1), histogramCount(m.RolloutDuration, "staging", "success"))
+
+	// a failed patch is not a rollout
+	cluster.DeployMaker = &MockDeployer{err: fmt.Errorf("received 500")}
+	cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"})
+	assert.Equal(t, uint64(0), histogramCount(m.RolloutDuration, "staging", "failure"))
+
+	cluster.DeployMaker = &MockDeployer{rolloutErr: fmt.Errorf("timed out")}
+	cluster.DeployWithRequest(deploy.DeployRequest{Tag: "ddd444"})
+	assert.Equal(t, uint64(1), histogramCount(m.RolloutDuration, "staging", "failure"))
+}
+
+func TestInstrumentTimesRolloutsFromCache(t *testing.T) {
+	kubernetes := deploytest.NewServer()
+	defer kubernetes.Close()
+	kubernetes.StepInterval = 10 * time.Millisecond
+	kubernetes.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 2)
+
+	cluster := kubernetes.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+	m := NewMetrics()
+	m.Instrument("staging", cluster)
+
+	cache := &deploy.NamespaceCache{Client: kubernetes.Client(), Endpoint: kubernetes.Endpoint(), Namespace: "myapp", BearerTokenService: deploytest.Token(kubernetes.Token)}
+	stop := make(chan struct{})
+	defer close(stop)
+	go cache.Run(stop)
+	cache.WaitForSync(stop)
+	cluster.Cache = cache
+
+	requests := len(kubernetes.Requests())
+	assert.Nil(t, cluster.DeployWithRequest(deploy.DeployRequest{Tag: "bbb222"}))
+	for i := 0; i < 200 && histogramCount(m.RolloutDuration, "staging", "success") == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), histogramCount(m.RolloutDuration, "staging", "success"))
+
+	// the deployment was only read once, for the audit record, and never polled for the rollout
+	gets := 0
+	for _, request := range kubernetes.Requests()[requests:] {
+		if strings.HasPrefix(request, "GET /apis/extensions/v1beta1/namespaces/myapp/deployments/myapp-deployment") {
+			gets++
+		}
+	}
+	assert.Equal(t, 1, gets)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	assert.Equal(t, 0, len(m.rollouts))
+}
+
+func TestInstrumentCountsTokenFailures(t *testing.T) {
+	m := NewMetrics()
+	deployer := &deploy.KubernetesDeployer{BearerTokenService: &deploy.EnvironmentVariableToken{Variable: "METRICS_TEST_MISSING_TOKEN"}}
+	podRetriever := &deploy.KubernetesPodListRetriever{BearerTokenService: &MockToken{token: "abc"}}
+	cluster := &deploy.KubernetesClusterNamespace{DeployMaker: deployer, PodRetriever: podRetriever}
+	m.Instrument("staging", cluster)
+
+	assert.Equal(t, "", deployer.BearerTokenService.RetrieveToken())
+	assert.Equal(t, "abc", podRetriever.BearerTokenService.RetrieveToken())
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.TokenRefreshFailure.WithLabelValues("staging")))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := NewMetrics()
+	m.Auditor("staging").AuditDeploy(deploy.DeployAuditRecord{Action: deploy.AuditActionDeploy, Result: deploy.AuditResultSuccess, DurationSeconds: 12})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "# TYPE kubernetes_deploy_duration_seconds histogram\n")
+	assert.Contains(t, w.Body.String(), "kubernetes_deploy_attempts_total{action=\"deploy\",environment=\"staging\",result=\"success\"} 1\n")
+	assert.Contains(t, w.Body.String(), "kubernetes_deploy_duration_seconds_bucket{action=\"deploy\",environment=\"staging\",le=\"30\"} 1\n")
+}
+
+func TestMetricsRegisterOnAnotherRegistry(t *testing.T) {
+	m := NewMetrics()
+	m.Deploys.WithLabelValues("staging", "deploy", "success").Inc()
+
+	registry := prometheus.NewRegistry()
+	assert.Nil(t, registry.Register(m))
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(families))
+	assert.Equal(t, "kubernetes_deploy_attempts_total", families[0].GetName())
+}
+
+//
+// MOCK DATA
+//
+
+// MockDeployer deploys by returning err, and waits for its rollout by returning rolloutErr.
+// Its history has two revisions.
+type MockDeployer struct {
+	err        error
+	rolloutErr error
+}
+
+func (d *MockDeployer) Deploy(containerTag string) error {
+	return d.err
+}
+
+func (d *MockDeployer) WaitForRollout(timeout time.Duration, interval time.Duration) (*deploy.Deployment, error) {
+	return &deploy.Deployment{}, d.rolloutErr
+}
+
+func (d *MockDeployer) History() ([]deploy.Revision, error) {
+	return []deploy.Revision{{Number: 2, Image: "myapp:ccc333"}, {Number: 1, Image: "myapp:aaa111"}}, nil
+}
+
+type MockAuditor struct {
+	records int
+}
+
+func (a *MockAuditor) AuditDeploy(record deploy.DeployAuditRecord) error {
+	a.records++
+	return nil
+}
+
+type MockToken struct {
+	token string
+}
+
+func (t *MockToken) RetrieveToken() string {
+	return t.token
+}
+
+// histogramCount is how many values the histogram observed with the label values
+func histogramCount(histogram *prometheus.HistogramVec, labelValues ...string) uint64 {
+	metric := &dto.Metric{}
+	histogram.WithLabelValues(labelValues...).(prometheus.Metric).Write(metric)
+	return metric.GetHistogram().GetSampleCount()
+}
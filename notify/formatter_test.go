@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownPodOverview(t *testing.T) {
+	markdown := &Markdown{Now: mockNow}
+	out, err := markdown.PodOverview("myapp", mockPods())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "*myapp*\n"+
+		"`abc123` image has been *Running* for 2.0 hours.\n"+
+		"`def456` image has been *CrashLoopBackOff* for 0.5 hours.\n", string(out))
+}
+
+func TestMarkdownRollout(t *testing.T) {
+	out, _ := (&Markdown{}).Rollout(mockDeployment(false))
+	assert.Equal(t, "`myapp-deployment` rollout *in progress*: 1 of 3 updated, 1 ready, 2 available.\n", string(out))
+
+	out, _ = (&Markdown{}).Rollout(mockDeployment(true))
+	assert.Equal(t, "`myapp-deployment` rollout *failed*: 1 of 3 updated, 1 ready, 2 available.\n", string(out))
+}
+
+func TestMarkdownDeployResult(t *testing.T) {
+	out, _ := (&Markdown{}).DeployResult(mockRecord())
+	assert.Equal(t, "alice's deploy of `myimage:def456` to *staging/myapp*: *failure* after 12.5 seconds.\nreceived 500\n", string(out))
+}
+
+func TestSlackPodOverview(t *testing.T) {
+	out, err := (&Slack{Now: mockNow}).PodOverview("myapp", mockPods())
+	assert.Nil(t, err)
+
+	message := &slackMessage{}
+	assert.Nil(t, json.Unmarshal(out, message))
+	assert.Equal(t, "myapp", message.Text)
+	assert.Equal(t, "header", message.Blocks[0].Type)
+	assert.Equal(t, "plain_text", message.Blocks[0].Text.Type)
+	assert.Equal(t, "section", message.Blocks[1].Type)
+	assert.Equal(t, "mrkdwn", message.Blocks[1].Text.Type)
+	assert.Equal(t, "`abc123` image has been *Running* for 2.0 hours.\n"+
+		"`def456` image has been *CrashLoopBackOff* for 0.5 hours.", message.Blocks[1].Text.Text)
+}
+
+func TestSlackDeployResult(t *testing.T) {
+	out, _ := (&Slack{}).DeployResult(mockRecord())
+
+	message := &slackMessage{}
+	assert.Nil(t, json.Unmarshal(out, message))
+	assert.Equal(t, 2, len(message.Blocks))
+	assert.Equal(t, "context", message.Blocks[1].Type)
+	assert.Equal(t, "Previously `myimage:abc123`", message.Blocks[1].Elements[0].Text)
+}
+
+func TestTeamsDeployResult(t *testing.T) {
+	out, err := (&Teams{}).DeployResult(mockRecord())
+	assert.Nil(t, err)
+
+	message := &teamsMessage{}
+	assert.Nil(t, json.Unmarshal(out, message))
+	assert.Equal(t, "message", message.Type)
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", message.Attachments[0].ContentType)
+
+	card := message.Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+	assert.Equal(t, "alice's deploy of `myimage:def456` to **staging/myapp**: **failure** after 12.5 seconds.\nreceived 500", card.Body[0].Text)
+	assert.Equal(t, "Attention", card.Body[0].Color)
+	assert.True(t, card.Body[1].IsSubtle)
+}
+
+func TestTeamsPodOverview(t *testing.T) {
+	out, _ := (&Teams{Now: mockNow}).PodOverview("myapp", mockPods())
+
+	message := &teamsMessage{}
+	assert.Nil(t, json.Unmarshal(out, message))
+	body := message.Attachments[0].Content.Body
+	assert.Equal(t, 3, len(body))
+	assert.Equal(t, "Bolder", body[0].Weight)
+	assert.Equal(t, "`abc123` image has been **Running** for 2.0 hours.", body[1].Text)
+}
+
+//
+// MOCK DATA
+//
+
+var mockTime = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func mockNow() time.Time {
+	return mockTime
+}
+
+func mockPods() []deploy.PodItem {
+	return []deploy.PodItem{
+		{Name: "myapp-1", Status: "Running", Tag: "abc123", Created: mockTime.Add(-2 * time.Hour)},
+		{Name: "myapp-2", Status: "Running", Reason: "CrashLoopBackOff", Tag: "def456", Created: mockTime.Add(-30 * time.Minute)},
+	}
+}
+
+func mockDeployment(failed bool) *deploy.Deployment {
+	replicas := 3
+	deployment := &deploy.Deployment{}
+	deployment.Metadata.Name = "myapp-deployment"
+	deployment.Spec.Replicas = &replicas
+	deployment.Status = deploy.DeploymentStatus{Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 2}
+	if failed {
+		deployment.Status.Conditions = []deploy.DeploymentCondition{{Type: "Progressing", Status: "False", Reason: "ProgressDeadlineExceeded"}}
+	}
+	return deployment
+}
+
+func mockRecord() deploy.DeployAuditRecord {
+	return deploy.DeployAuditRecord{
+		Action:          deploy.AuditActionDeploy,
+		User:            "alice",
+		Cluster:         "staging",
+		Namespace:       "myapp",
+		OldImage:        "myimage:abc123",
+		NewImage:        "myimage:def456",
+		Result:          deploy.AuditResultFailure,
+		DurationSeconds: 12.5,
+		Error:           "received 500",
+	}
+}
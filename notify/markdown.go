@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Markdown renders deploy status as plain Markdown lines, e.g. for a terminal or a chat bot.
+type Markdown struct {
+	// Now defaults to time.Now, and is used to work out how long pods have been running.
+	Now func() time.Time
+}
+
+// PodOverview describes how long each pod has been on its image, under an optional title
+func (m *Markdown) PodOverview(title string, pods []deploy.PodItem) ([]byte, error) {
+	lines := podLines(pods, now(m.Now), "*")
+	return m.render(title, lines), nil
+}
+
+// Rollout describes how far the deployment's rollout has got
+func (m *Markdown) Rollout(deployment *deploy.Deployment) ([]byte, error) {
+	return m.render("", []string{rolloutLine(deployment, "*")}), nil
+}
+
+// DeployResult describes how a deploy attempt went
+func (m *Markdown) DeployResult(record deploy.DeployAuditRecord) ([]byte, error) {
+	return m.render("", []string{resultLine(record, "*")}), nil
+}
+
+func (m *Markdown) render(title string, lines []string) []byte {
+	if title != "" {
+		lines = append([]string{fmt.Sprintf("*%s*", title)}, lines...)
+	}
+	if len(lines) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// now is the clock's time, falling back to time.Now
+func now(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock()
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	chat := &MockChat{}
+	server := httptest.NewServer(chat)
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: server.Client(), URL: server.URL + "/webhook"}
+	assert.Nil(t, notifier.Notify([]byte(`{"text":"hello"}`)))
+	assert.Equal(t, "hello", chat.messages[0]["text"])
+
+	notifier.URL = server.URL + "/missing"
+	assert.EqualError(t, notifier.Notify([]byte(`{}`)), "received 404")
+}
+
+func TestSlackMessageEditsInPlace(t *testing.T) {
+	chat := &MockChat{}
+	server := httptest.NewServer(chat)
+	defer server.Close()
+
+	message := &SlackMessage{Client: server.Client(), Token: "xoxb-token", Channel: "#deploys", APIURL: server.URL}
+	assert.Nil(t, message.Notify([]byte(`{"text":"rolling out"}`)))
+	assert.Nil(t, message.Notify([]byte(`{"text":"rolled out"}`)))
+
+	assert.Equal(t, []string{"/chat.postMessage", "/chat.update"}, chat.paths)
+	assert.Equal(t, "#deploys", chat.messages[0]["channel"])
+	assert.Equal(t, "C123", chat.messages[1]["channel"])
+	assert.Equal(t, "1550000000.000100", chat.messages[1]["ts"])
+	assert.Equal(t, "rolled out", chat.messages[1]["text"])
+	assert.Equal(t, "Bearer xoxb-token", chat.authorization)
+}
+
+func TestSlackMessageError(t *testing.T) {
+	chat := &MockChat{slackError: "channel_not_found"}
+	server := httptest.NewServer(chat)
+	defer server.Close()
+
+	message := &SlackMessage{Client: server.Client(), Channel: "#missing", APIURL: server.URL}
+	assert.EqualError(t, message.Notify([]byte(`{"text":"hello"}`)), "slack chat.postMessage failed: channel_not_found")
+}
+
+func TestSlackResponseURLReplacesOriginal(t *testing.T) {
+	chat := &MockChat{}
+	server := httptest.NewServer(chat)
+	defer server.Close()
+
+	response := &SlackResponseURL{Client: server.Client(), URL: server.URL + "/webhook", InChannel: true}
+	response.Notify([]byte(`{"text":"deploying"}`))
+	response.Notify([]byte(`{"text":"deployed"}`))
+
+	assert.Nil(t, chat.messages[0]["replace_original"])
+	assert.Equal(t, "in_channel", chat.messages[0]["response_type"])
+	assert.Equal(t, true, chat.messages[1]["replace_original"])
+}
+
+func TestDeployNotifierAudits(t *testing.T) {
+	chat := &MockChat{}
+	server := httptest.NewServer(chat)
+	defer server.Close()
+
+	clusterNamespace := &deploy.KubernetesClusterNamespace{
+		Description: "staging",
+		DeployMaker: &mockDeployer{},
+		Auditor: &DeployNotifier{
+			Formatter: &Markdown{},
+			Notifier:  &mockTextNotifier{url: server.URL + "/webhook"},
+		},
+	}
+
+	assert.Nil(t, clusterNamespace.Deploy("abc123"))
+	assert.True(t, strings.HasPrefix(chat.messages[0]["text"].(string), "someone's deploy of `abc123` to *staging*: *success*"))
+}
+
+func TestFollowRollout(t *testing.T) {
+	cluster := &MockRolloutCluster{}
+	server := httptest.NewTLSServer(cluster)
+	defer server.Close()
+
+	chat := &MockChat{}
+	chatServer := httptest.NewServer(chat)
+	defer chatServer.Close()
+
+	deployer := &deploy.KubernetesDeployer{
+		Client:             server.Client(),
+		Endpoint:           strings.TrimPrefix(server.URL, "https://"),
+		Namespace:          "myapp-development",
+		DeploymentName:     "myapp-deployment",
+		BearerTokenService: &mockBearerToken{},
+	}
+	message := &SlackMessage{Client: chatServer.Client(), Channel: "#deploys", APIURL: chatServer.URL}
+
+	err := FollowRollout(deployer, &Slack{}, message, time.Second, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/chat.postMessage", "/chat.update", "/chat.update"}, chat.paths)
+	assert.Equal(t, "`myapp-deployment` rollout *complete*: 2 of 2 updated, 2 ready, 2 available.", chat.messages[2]["text"])
+}
+
+//
+// MOCK DATA
+//
+
+// MockChat records the messages posted to it, acting as both a webhook and the Slack Web API
+type MockChat struct {
+	mutex         sync.Mutex
+	paths         []string
+	messages      []map[string]interface{}
+	authorization string
+	slackError    string
+}
+
+func (c *MockChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if r.URL.Path == "/missing" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	raw, _ := ioutil.ReadAll(r.Body)
+	message := map[string]interface{}{}
+	json.Unmarshal(raw, &message)
+	c.paths = append(c.paths, r.URL.Path)
+	c.messages = append(c.messages, message)
+	c.authorization = r.Header.Get("Authorization")
+
+	if c.slackError != "" {
+		fmt.Fprintf(w, `{"ok":false,"error":%q}`, c.slackError)
+		return
+	}
+	w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1550000000.000100"}`))
+}
+
+// MockRolloutCluster serves a deployment that gains one ready replica each time it is fetched
+type MockRolloutCluster struct {
+	mutex sync.Mutex
+	ready int
+}
+
+func (c *MockRolloutCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(w, `{"metadata":{"name":"myapp-deployment","generation":1},"spec":{"replicas":2},
+		"status":{"observedGeneration":1,"replicas":2,"updatedReplicas":%d,"readyReplicas":%d,"availableReplicas":%d}}`,
+		c.ready, c.ready, c.ready)
+	if c.ready < 2 {
+		c.ready++
+	}
+}
+
+// mockTextNotifier posts Markdown payloads as the text of a message
+type mockTextNotifier struct {
+	url string
+}
+
+func (m *mockTextNotifier) Notify(payload []byte) error {
+	raw, _ := json.Marshal(map[string]string{"text": string(payload)})
+	return (&WebhookNotifier{Client: http.DefaultClient, URL: m.url}).Notify(raw)
+}
+
+type mockDeployer struct{}
+
+func (*mockDeployer) Deploy(tag string) error {
+	return nil
+}
+
+type mockBearerToken struct{}
+
+func (*mockBearerToken) RetrieveToken() string {
+	return "token"
+}
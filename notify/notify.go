@@ -0,0 +1,155 @@
+// Package notify renders deploy status for chat, and posts it to chat webhooks.
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Formatter represents any struct that renders deploy status as a chat message payload
+type Formatter interface {
+	PodOverview(title string, pods []deploy.PodItem) ([]byte, error)
+	Rollout(deployment *deploy.Deployment) ([]byte, error)
+	DeployResult(record deploy.DeployAuditRecord) ([]byte, error)
+}
+
+// Notifier represents any struct that can post a message payload to chat
+type Notifier interface {
+	Notify(payload []byte) error
+}
+
+// DeployNotifier posts the result of every deploy attempt to chat.
+// Set it as the Auditor of a cluster namespace, or add it to a deploy.MultiAuditor.
+type DeployNotifier struct {
+	Formatter Formatter
+	Notifier  Notifier
+}
+
+// AuditDeploy formats the deploy result and posts it
+func (d *DeployNotifier) AuditDeploy(record deploy.DeployAuditRecord) error {
+	payload, err := d.Formatter.DeployResult(record)
+	if err != nil {
+		return err
+	}
+	return d.Notifier.Notify(payload)
+}
+
+// FollowRollout polls the deployment every interval and posts its progress whenever it changes,
+// until the rollout completes, fails, or timeout passes. Use a Notifier that edits its message in place,
+// such as SlackMessage, to keep a single progress message up to date.
+func FollowRollout(deployer *deploy.KubernetesDeployer, formatter Formatter, notifier Notifier, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := deploy.DeploymentStatus{}
+	posted := false
+
+	for {
+		deployment, err := deployer.Get()
+		if err != nil {
+			return err
+		}
+
+		done := deployment.RolloutComplete() || deployment.RolloutFailed()
+		if !posted || deployment.Status.UpdatedReplicas != last.UpdatedReplicas ||
+			deployment.Status.ReadyReplicas != last.ReadyReplicas ||
+			deployment.Status.AvailableReplicas != last.AvailableReplicas || done {
+			payload, err := formatter.Rollout(deployment)
+			if err != nil {
+				return err
+			}
+			err = notifier.Notify(payload)
+			if err != nil {
+				return err
+			}
+			posted = true
+			last = deployment.Status
+		}
+
+		if deployment.RolloutFailed() {
+			return fmt.Errorf("rollout of %s exceeded its progress deadline", deployer.DeploymentName)
+		}
+		if deployment.RolloutComplete() {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timed out waiting for rollout of %s", deployer.DeploymentName)
+		}
+		time.Sleep(interval)
+	}
+}
+
+//
+// Helpers shared by the formatters
+//
+
+// podLines describes how long each pod has been on its image, with bold wrapped around the status
+func podLines(pods []deploy.PodItem, now time.Time, bold string) []string {
+	lines := []string{}
+	for _, pod := range pods {
+		status := pod.Status
+		if pod.Reason != "" {
+			status = pod.Reason
+		}
+		lines = append(lines, fmt.Sprintf("`%s` image has been %s%s%s for %.1f hours.",
+			pod.Tag,
+			bold, status, bold,
+			now.Sub(pod.Created).Hours()))
+	}
+	return lines
+}
+
+// rolloutLine summarises how far a rollout has got
+func rolloutLine(deployment *deploy.Deployment, bold string) string {
+	status := deployment.Status
+	state := "in progress"
+	switch {
+	case deployment.RolloutFailed():
+		state = "failed"
+	case deployment.RolloutComplete():
+		state = "complete"
+	}
+
+	return fmt.Sprintf("`%s` rollout %s%s%s: %d of %d updated, %d ready, %d available.",
+		deployment.Metadata.Name,
+		bold, state, bold,
+		status.UpdatedReplicas,
+		deployment.DesiredReplicas(),
+		status.ReadyReplicas,
+		status.AvailableReplicas)
+}
+
+// resultLine summarises a deploy attempt
+func resultLine(record deploy.DeployAuditRecord, bold string) string {
+	who := record.User
+	if who == "" {
+		who = "someone"
+	}
+
+	line := fmt.Sprintf("%s's %s of `%s` to %s%s%s: %s%s%s after %.1f seconds.",
+		who,
+		record.Action,
+		record.NewImage,
+		bold, clusterName(record), bold,
+		bold, record.Result, bold,
+		record.DurationSeconds)
+	if record.Error != "" {
+		line += "\n" + record.Error
+	}
+	return line
+}
+
+// clusterName is the cluster description, falling back to the namespace
+func clusterName(record deploy.DeployAuditRecord) string {
+	names := []string{}
+	for _, name := range []string{record.Cluster, record.Namespace} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown cluster"
+	}
+	return strings.Join(names, "/")
+}
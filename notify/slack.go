@@ -0,0 +1,209 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Slack renders deploy status as Slack Block Kit messages, with plain text for notifications.
+type Slack struct {
+	// Now defaults to time.Now, and is used to work out how long pods have been running.
+	Now func() time.Time
+}
+
+// slackMessage is a Slack message made of blocks. Text is shown in notifications.
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slackBlock is a header, section or context block
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// slackText is a plain_text or mrkdwn text object
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// PodOverview lists how long each pod has been on its image, under a header
+func (s *Slack) PodOverview(title string, pods []deploy.PodItem) ([]byte, error) {
+	lines := podLines(pods, now(s.Now), "*")
+	message := slackMessage{Text: title}
+	if title != "" {
+		message.Blocks = append(message.Blocks, slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: title}})
+	}
+	if len(lines) == 0 {
+		lines = []string{"No pods found."}
+	}
+	message.Blocks = append(message.Blocks, slackSection(strings.Join(lines, "\n")))
+	if message.Text == "" {
+		message.Text = lines[0]
+	}
+	return json.Marshal(message)
+}
+
+// Rollout describes how far the deployment's rollout has got
+func (s *Slack) Rollout(deployment *deploy.Deployment) ([]byte, error) {
+	line := rolloutLine(deployment, "*")
+	return json.Marshal(slackMessage{Text: line, Blocks: []slackBlock{slackSection(line)}})
+}
+
+// DeployResult describes how a deploy attempt went, with the previous image for context
+func (s *Slack) DeployResult(record deploy.DeployAuditRecord) ([]byte, error) {
+	line := resultLine(record, "*")
+	message := slackMessage{Text: line, Blocks: []slackBlock{slackSection(line)}}
+	if record.OldImage != "" {
+		message.Blocks = append(message.Blocks, slackBlock{
+			Type:     "context",
+			Elements: []slackText{{Type: "mrkdwn", Text: fmt.Sprintf("Previously `%s`", record.OldImage)}},
+		})
+	}
+	return json.Marshal(message)
+}
+
+func slackSection(text string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}}
+}
+
+// SlackMessage posts a message to a Slack channel with a bot token, then edits that same message
+// with every later payload. It suits progress updates, e.g. from FollowRollout.
+type SlackMessage struct {
+	Client  *http.Client
+	Token   string
+	Channel string
+	// APIURL defaults to https://slack.com/api
+	APIURL string
+
+	mutex   sync.Mutex
+	channel string
+	ts      string
+}
+
+// slackResponse is the part of a Slack Web API response needed to edit a message later
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// Notify posts the payload the first time, and updates the posted message after that
+func (s *SlackMessage) Notify(payload []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	method := "chat.postMessage"
+	fields := map[string]interface{}{"channel": s.Channel}
+	if s.ts != "" {
+		method = "chat.update"
+		fields = map[string]interface{}{"channel": s.channel, "ts": s.ts}
+	}
+
+	raw, err := withFields(payload, fields)
+	if err != nil {
+		return err
+	}
+
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = "https://slack.com/api"
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", apiURL, method), bytes.NewBuffer(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", s.Token))
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("received %v", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	response := &slackResponse{}
+	err = json.Unmarshal(body, response)
+	if err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("slack %s failed: %s", method, response.Error)
+	}
+
+	if s.ts == "" {
+		s.channel, s.ts = response.Channel, response.TS
+	}
+	return nil
+}
+
+// SlackResponseURL replies to a slash command through its response_url.
+// The first payload is posted as a new message, and later payloads replace it.
+type SlackResponseURL struct {
+	Client *http.Client
+	URL    string
+	// InChannel shows the reply to everyone in the channel, not just the user who ran the command.
+	InChannel bool
+	// ReplaceOriginal replaces the original message with the first payload too, e.g. the message whose button was clicked.
+	ReplaceOriginal bool
+
+	mutex  sync.Mutex
+	posted bool
+}
+
+// Notify posts the payload to the response URL
+func (s *SlackResponseURL) Notify(payload []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fields := map[string]interface{}{}
+	if s.InChannel {
+		fields["response_type"] = "in_channel"
+	}
+	if s.posted || s.ReplaceOriginal {
+		fields["replace_original"] = true
+	}
+	raw, err := withFields(payload, fields)
+	if err != nil {
+		return err
+	}
+
+	err = (&WebhookNotifier{Client: s.Client, URL: s.URL}).Notify(raw)
+	if err != nil {
+		return err
+	}
+	s.posted = true
+	return nil
+}
+
+// withFields adds top level fields to a JSON message payload
+func withFields(payload []byte, fields map[string]interface{}) ([]byte, error) {
+	message := map[string]interface{}{}
+	err := json.Unmarshal(payload, &message)
+	if err != nil {
+		return nil, fmt.Errorf("payload is not a JSON message: %s", err.Error())
+	}
+	for key, value := range fields {
+		message[key] = value
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Teams renders deploy status as Microsoft Teams Adaptive Cards, ready to post to an incoming webhook.
+type Teams struct {
+	// Now defaults to time.Now, and is used to work out how long pods have been running.
+	Now func() time.Time
+}
+
+// teamsMessage wraps a card the way Teams incoming webhooks expect
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []teamsTextBlock `json:"body"`
+}
+
+type teamsTextBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Wrap     bool   `json:"wrap"`
+	Weight   string `json:"weight,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Color    string `json:"color,omitempty"`
+	IsSubtle bool   `json:"isSubtle,omitempty"`
+}
+
+// PodOverview lists how long each pod has been on its image, under a title
+func (t *Teams) PodOverview(title string, pods []deploy.PodItem) ([]byte, error) {
+	body := []teamsTextBlock{}
+	if title != "" {
+		body = append(body, teamsTextBlock{Type: "TextBlock", Text: title, Wrap: true, Weight: "Bolder", Size: "Medium"})
+	}
+	for _, line := range podLines(pods, now(t.Now), "**") {
+		body = append(body, teamsText(line))
+	}
+	return teamsCardMessage(body)
+}
+
+// Rollout describes how far the deployment's rollout has got
+func (t *Teams) Rollout(deployment *deploy.Deployment) ([]byte, error) {
+	block := teamsText(rolloutLine(deployment, "**"))
+	if deployment.RolloutFailed() {
+		block.Color = "Attention"
+	}
+	return teamsCardMessage([]teamsTextBlock{block})
+}
+
+// DeployResult describes how a deploy attempt went, coloured by its result
+func (t *Teams) DeployResult(record deploy.DeployAuditRecord) ([]byte, error) {
+	block := teamsText(resultLine(record, "**"))
+	switch record.Result {
+	case deploy.AuditResultSuccess:
+		block.Color = "Good"
+	case deploy.AuditResultFailure:
+		block.Color = "Attention"
+	default:
+		block.Color = "Warning"
+	}
+
+	body := []teamsTextBlock{block}
+	if record.OldImage != "" {
+		body = append(body, teamsTextBlock{Type: "TextBlock", Text: fmt.Sprintf("Previously `%s`", record.OldImage), Wrap: true, IsSubtle: true})
+	}
+	return teamsCardMessage(body)
+}
+
+func teamsText(text string) teamsTextBlock {
+	return teamsTextBlock{Type: "TextBlock", Text: text, Wrap: true}
+}
+
+func teamsCardMessage(body []teamsTextBlock) ([]byte, error) {
+	return json.Marshal(teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.2",
+				Body:    body,
+			},
+		}},
+	})
+}
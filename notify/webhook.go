@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// WebhookNotifier posts each payload as a new message to an incoming webhook, e.g. for Slack or Teams.
+// Incoming webhooks cannot edit messages; use SlackMessage or SlackResponseURL for that.
+type WebhookNotifier struct {
+	Client *http.Client
+	URL    string
+}
+
+// Notify posts the payload to the webhook
+func (w *WebhookNotifier) Notify(payload []byte) error {
+	res, err := w.Client.Post(w.URL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("received %v", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers used to sign requests for HMACAuth
+const (
+	KeyHeader       = "X-Deploy-Key"
+	TimestampHeader = "X-Deploy-Timestamp"
+	SignatureHeader = "X-Deploy-Signature"
+)
+
+// Authenticator represents any struct that can check who sent a request.
+// The user it returns is recorded as the user of deploys and rollbacks.
+type Authenticator interface {
+	Authenticate(r *http.Request) (user string, err error)
+}
+
+// APIKeys authenticates requests carrying a static key, as `Authorization: Bearer <key>`.
+// It maps each key to the user it belongs to.
+type APIKeys map[string]string
+
+// Authenticate looks up the user for the request's key
+func (a APIKeys) Authenticate(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", fmt.Errorf("missing API key")
+	}
+	key := strings.TrimPrefix(header, "Bearer ")
+
+	for candidate, user := range a {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return user, nil
+		}
+	}
+	return "", fmt.Errorf("unknown API key")
+}
+
+// HMACAuth authenticates requests signed with a shared secret, see SignRequest.
+// Secrets maps each key id to its secret, and the key id is recorded as the user.
+// Each signature is only accepted once, so a captured request cannot be replayed.
+type HMACAuth struct {
+	Secrets map[string]string
+	// MaxSkew is how old, or how far in the future, a signed request may be. Defaults to 5 minutes.
+	MaxSkew time.Duration
+	// MaxBodyBytes is the largest body read to check a signature. Defaults to 1MiB.
+	MaxBodyBytes int64
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	// seen holds the signatures already accepted, until their timestamp is too old to be accepted again
+	mutex sync.Mutex
+	seen  map[string]time.Time
+}
+
+// Authenticate checks the request's signature and timestamp
+func (h *HMACAuth) Authenticate(r *http.Request) (string, error) {
+	keyID := r.Header.Get(KeyHeader)
+	secret, ok := h.Secrets[keyID]
+	if keyID == "" || !ok {
+		return "", fmt.Errorf("unknown key %q", keyID)
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("missing or invalid %s", TimestampHeader)
+	}
+
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	maxSkew := h.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 5 * time.Minute
+	}
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return "", fmt.Errorf("request timestamp is too far from now")
+	}
+
+	maxBodyBytes := h.MaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = 1 << 20
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBodyBytes)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return "", fmt.Errorf("request body is unreadable or larger than %d bytes", maxBodyBytes)
+	}
+
+	expected := signature(secret, r.Header.Get(TimestampHeader), r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SignatureHeader))) {
+		return "", fmt.Errorf("invalid signature")
+	}
+	if !h.firstUse(expected, time.Unix(timestamp, 0).Add(maxSkew), now) {
+		return "", fmt.Errorf("request has already been used")
+	}
+	return keyID, nil
+}
+
+// firstUse records the signature until expires, reporting whether it had not been seen before.
+// Signatures past their expiry are forgotten, as their timestamp is then refused anyway.
+func (h *HMACAuth) firstUse(signature string, expires time.Time, now time.Time) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for seen, seenExpires := range h.seen {
+		if now.After(seenExpires) {
+			delete(h.seen, seen)
+		}
+	}
+	if _, ok := h.seen[signature]; ok {
+		return false
+	}
+	if h.seen == nil {
+		h.seen = map[string]time.Time{}
+	}
+	h.seen[signature] = expires
+	return true
+}
+
+// SignRequest adds the headers HMACAuth checks. Call it once the request's body is set.
+func SignRequest(r *http.Request, keyID string, secret string) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(KeyHeader, keyID)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(SignatureHeader, signature(secret, timestamp, r.Method, r.URL.RequestURI(), body))
+	return nil
+}
+
+// AnyAuthenticator accepts a request when any of its authenticators do, e.g. API keys for scripts
+// and HMAC signatures for bots.
+type AnyAuthenticator []Authenticator
+
+// Authenticate tries each authenticator in turn, returning the last error when none accept the request
+func (a AnyAuthenticator) Authenticate(r *http.Request) (string, error) {
+	err := fmt.Errorf("no authenticators configured")
+	for _, authenticator := range a {
+		var user string
+		user, err = authenticator.Authenticate(r)
+		if err == nil {
+			return user, nil
+		}
+	}
+	return "", err
+}
+
+// signature is the hex HMAC-SHA256 of the timestamp, method, path and body, one per line
+func signature(secret string, timestamp string, method string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", timestamp, method, path)
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads the request body and puts it back, so it can still be read later
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	return body, nil
+}
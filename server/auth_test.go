@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys := APIKeys{"secret-key": "deploybot"}
+
+	req := httptest.NewRequest(http.MethodGet, "/environments", nil)
+	req.Header.Set("Authorization", "Bearer secret-key")
+	user, err := keys.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "deploybot", user)
+
+	req.Header.Set("Authorization", "Bearer wrong-key")
+	_, err = keys.Authenticate(req)
+	assert.EqualError(t, err, "unknown API key")
+
+	req.Header.Del("Authorization")
+	_, err = keys.Authenticate(req)
+	assert.EqualError(t, err, "missing API key")
+}
+
+func TestHMACAuth(t *testing.T) {
+	auth := &HMACAuth{Secrets: map[string]string{"ci": "shhh"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/environments/staging/deploy", bytes.NewBufferString(`{"tag":"abc123"}`))
+	assert.Nil(t, SignRequest(req, "ci", "shhh"))
+
+	user, err := auth.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", user)
+
+	// the body can still be read by the handler
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"tag":"abc123"}`, string(body))
+}
+
+func TestHMACAuthRejectsTamperedBody(t *testing.T) {
+	auth := &HMACAuth{Secrets: map[string]string{"ci": "shhh"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/environments/staging/deploy", bytes.NewBufferString(`{"tag":"abc123"}`))
+	SignRequest(req, "ci", "shhh")
+	req.Body = ioutil.NopCloser(bytes.NewBufferString(`{"tag":"evil"}`))
+
+	_, err := auth.Authenticate(req)
+	assert.EqualError(t, err, "invalid signature")
+}
+
+func TestHMACAuthRejectsReplayedRequests(t *testing.T) {
+	auth := &HMACAuth{Secrets: map[string]string{"ci": "shhh"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/environments/staging/deploy", bytes.NewBufferString(`{"tag":"abc123"}`))
+	SignRequest(req, "ci", "shhh")
+	_, err := auth.Authenticate(req)
+	assert.Nil(t, err)
+
+	replayed := httptest.NewRequest(http.MethodPost, "/environments/staging/deploy", bytes.NewBufferString(`{"tag":"abc123"}`))
+	replayed.Header = req.Header
+	_, err = auth.Authenticate(replayed)
+	assert.EqualError(t, err, "request has already been used")
+
+	// once its timestamp is too old the signature is forgotten, as it is refused anyway
+	later := time.Now().Add(10 * time.Minute)
+	assert.True(t, auth.firstUse("v1=other", later.Add(5*time.Minute), later))
+	assert.Equal(t, 1, len(auth.seen))
+}
+
+func TestHMACAuthRejectsLargeBodies(t *testing.T) {
+	auth := &HMACAuth{Secrets: map[string]string{"ci": "shhh"}, MaxBodyBytes: 8}
+
+	req := httptest.NewRequest(http.MethodPost, "/environments/staging/deploy", bytes.NewBufferString(`{"tag":"abc123"}`))
+	SignRequest(req, "ci", "shhh")
+
+	_, err := auth.Authenticate(req)
+	assert.EqualError(t, err, "request body is unreadable or larger than 8 bytes")
+}
+
+func TestHMACAuthRejectsOldRequests(t *testing.T) {
+	auth := &HMACAuth{
+		Secrets: map[string]string{"ci": "shhh"},
+		Now:     func() time.Time { return time.Now().Add(10 * time.Minute) },
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/environments", nil)
+	SignRequest(req, "ci", "shhh")
+
+	_, err := auth.Authenticate(req)
+	assert.EqualError(t, err, "request timestamp is too far from now")
+}
+
+func TestHMACAuthUnknownKey(t *testing.T) {
+	auth := &HMACAuth{Secrets: map[string]string{"ci": "shhh"}}
+
+	req := httptest.NewRequest(http.MethodGet, "/environments", nil)
+	SignRequest(req, "someone", "shhh")
+
+	_, err := auth.Authenticate(req)
+	assert.EqualError(t, err, `unknown key "someone"`)
+}
+
+func TestAnyAuthenticator(t *testing.T) {
+	auth := AnyAuthenticator{APIKeys{"secret-key": "deploybot"}, &HMACAuth{Secrets: map[string]string{"ci": "shhh"}}}
+
+	req := httptest.NewRequest(http.MethodGet, "/environments", nil)
+	SignRequest(req, "ci", "shhh")
+	user, err := auth.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", user)
+
+	_, err = AnyAuthenticator{}.Authenticate(req)
+	assert.EqualError(t, err, "no authenticators configured")
+}
@@ -0,0 +1,305 @@
+// Package server exposes configured environments over a small REST API for deploy bots.
+//
+//	GET  /environments
+//	GET  /environments/<name>/pods
+//	POST /environments/<name>/approve     {"tag": "abc123"}
+//	POST /environments/<name>/deploy      {"tag": "abc123"}
+//	GET  /environments/<name>/status
+//	GET  /environments/<name>/status/stream   (Server-Sent Events)
+//	GET  /environments/<name>/history
+//	POST /environments/<name>/rollback    {"revision": 0}
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Server is an http.Handler for the REST API. Every request must pass Auth; without one, all requests are refused.
+type Server struct {
+	Environments *deploy.EnvironmentRegistry
+	Auth         Authenticator
+	// RolloutTimeout and RolloutInterval control status streams. They default to 10 minutes and 2 seconds.
+	RolloutTimeout  time.Duration
+	RolloutInterval time.Duration
+	// EventWriteTimeout is how long a status stream waits for the client to take each event, defaulting to 30 seconds.
+	// It stands in for the http.Server's WriteTimeout, which would otherwise end the stream.
+	EventWriteTimeout time.Duration
+	// ApprovalTTL is how long an approval of a tag counts towards deploying it. Defaults to 1 hour.
+	ApprovalTTL time.Duration
+
+	// approvals holds when each authenticated user approved a tag, by environment and tag
+	mutex     sync.Mutex
+	approvals map[string]map[string]time.Time
+}
+
+// Environment describes a configured environment.
+type Environment struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Pod is the state of a single pod.
+type Pod = deploy.PodItem
+
+// RolloutStatus is how far a deployment's rollout has got.
+type RolloutStatus = deploy.RolloutStatus
+
+// DeployRequest is the body of a deploy. Approvals are refused, as anyone could name approvers;
+// each approver approves the tag with an ApprovalRequest of their own instead.
+type DeployRequest struct {
+	Tag       string   `json:"tag"`
+	Approvals []string `json:"approvals,omitempty"`
+}
+
+// ApprovalRequest is the body of an approval, made by the approver.
+type ApprovalRequest struct {
+	Tag string `json:"tag"`
+}
+
+// RollbackRequest is the body of a rollback. Revision zero rolls back to the previous revision.
+type RollbackRequest struct {
+	Revision int64 `json:"revision"`
+}
+
+// Result is returned by deploys and rollbacks.
+type Result struct {
+	Environment string `json:"environment"`
+	Tag         string `json:"tag,omitempty"`
+	Revision    int64  `json:"revision,omitempty"`
+	Result      string `json:"result"`
+	// Approvals are who has approved the tag, in answer to an approval
+	Approvals []string `json:"approvals,omitempty"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP authenticates the request and routes it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Auth == nil {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("no authentication configured"))
+		return
+	}
+	user, err := s.Auth.Authenticate(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "environments" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if len(parts) == 1 {
+		s.route(w, r, http.MethodGet, s.listEnvironments)
+		return
+	}
+
+	cluster, err := s.Environments.Get(parts[1])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	action := strings.Join(parts[2:], "/")
+	switch action {
+	case "pods":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.pods(w, cluster) })
+	case "approve":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { s.approve(w, r, parts[1], user) })
+	case "deploy":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { s.deploy(w, r, parts[1], cluster, user) })
+	case "status":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.status(w, cluster) })
+	case "status/stream":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.streamStatus(w, r, cluster) })
+	case "history":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.history(w, cluster) })
+	case "rollback":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { s.rollback(w, r, parts[1], cluster, user) })
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+	}
+}
+
+// route only lets through requests with the given method
+func (s *Server) route(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	handler(w, r)
+}
+
+func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments := []Environment{}
+	for _, name := range s.Environments.Names() {
+		cluster, _ := s.Environments.Get(name)
+		environments = append(environments, Environment{Name: name, Description: cluster.Description})
+	}
+	writeJSON(w, http.StatusOK, environments)
+}
+
+func (s *Server) pods(w http.ResponseWriter, cluster *deploy.KubernetesClusterNamespace) {
+	podList, err := cluster.GetPodList()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	pods := podList.Overview()
+	if pods == nil {
+		pods = []Pod{}
+	}
+	writeJSON(w, http.StatusOK, pods)
+}
+
+func (s *Server) deploy(w http.ResponseWriter, r *http.Request, name string, cluster *deploy.KubernetesClusterNamespace, user string) {
+	body := &DeployRequest{}
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil || body.Tag == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be JSON with a tag"))
+		return
+	}
+	if len(body.Approvals) > 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("approvals cannot be given with a deploy, each approver must POST /environments/%s/approve", name))
+		return
+	}
+
+	err = cluster.DeployWithRequest(deploy.DeployRequest{Tag: body.Tag, User: user, Approvals: s.approvers(name, body.Tag), Context: r.Context()})
+	if err != nil {
+		writeError(w, deployErrorStatus(err), err)
+		return
+	}
+	s.clearApprovals(name, body.Tag)
+	writeJSON(w, http.StatusOK, Result{Environment: name, Tag: body.Tag, Result: deploy.AuditResultSuccess})
+}
+
+// approve records that the authenticated user approved deploying the tag to the environment
+func (s *Server) approve(w http.ResponseWriter, r *http.Request, name string, user string) {
+	body := &ApprovalRequest{}
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil || body.Tag == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be JSON with a tag"))
+		return
+	}
+
+	s.mutex.Lock()
+	if s.approvals == nil {
+		s.approvals = map[string]map[string]time.Time{}
+	}
+	key := approvalKey(name, body.Tag)
+	if s.approvals[key] == nil {
+		s.approvals[key] = map[string]time.Time{}
+	}
+	s.approvals[key][user] = time.Now()
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, Result{Environment: name, Tag: body.Tag, Result: "approved", Approvals: s.approvers(name, body.Tag)})
+}
+
+// approvers are the users who approved the tag within ApprovalTTL, sorted
+func (s *Server) approvers(name string, tag string) []string {
+	ttl := s.ApprovalTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users := []string{}
+	for user, approved := range s.approvals[approvalKey(name, tag)] {
+		if time.Since(approved) <= ttl {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// clearApprovals forgets the approvals of a tag once it is deployed, so each deploy needs its own
+func (s *Server) clearApprovals(name string, tag string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.approvals, approvalKey(name, tag))
+}
+
+func approvalKey(name string, tag string) string {
+	return name + "\x00" + tag
+}
+
+func (s *Server) status(w http.ResponseWriter, cluster *deploy.KubernetesClusterNamespace) {
+	deployment, err := cluster.GetDeployment()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rolloutStatus(deployment, cluster))
+}
+
+func (s *Server) history(w http.ResponseWriter, cluster *deploy.KubernetesClusterNamespace) {
+	revisions, err := cluster.History()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request, name string, cluster *deploy.KubernetesClusterNamespace, user string) {
+	body := &RollbackRequest{}
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be JSON"))
+		return
+	}
+
+	err = cluster.Rollback(deploy.DeployRequest{User: user, Context: r.Context()}, body.Revision)
+	if err != nil {
+		writeError(w, deployErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Result{Environment: name, Revision: body.Revision, Result: deploy.AuditResultSuccess})
+}
+
+// rolloutStatus summarises the deployment, including the image of the cluster's container when known
+func rolloutStatus(deployment *deploy.Deployment, cluster *deploy.KubernetesClusterNamespace) *RolloutStatus {
+	containerName := ""
+	if deployer, ok := cluster.DeployMaker.(*deploy.KubernetesDeployer); ok {
+		containerName = deployer.ContainerName
+	}
+	return deploy.NewRolloutStatus(deployment, containerName)
+}
+
+// deployErrorStatus picks the response code for a failed deploy or rollback
+func deployErrorStatus(err error) int {
+	switch deploy.AuditResult(err) {
+	case deploy.AuditResultDenied:
+		return http.StatusForbidden
+	case deploy.AuditResultAborted:
+		return http.StatusConflict
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/Unity-Technologies/kubernetes-deploy/deploytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListEnvironments(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `[{"name":"staging","description":"My Staging Cluster"}]`, res.Body.String())
+}
+
+func TestUnauthenticated(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	req := httptest.NewRequest(http.MethodGet, "/environments", nil)
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.JSONEq(t, `{"error":"missing API key"}`, res.Body.String())
+
+	res = httptest.NewRecorder()
+	(&Server{}).ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestUnknownEnvironment(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments/production/pods", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.JSONEq(t, `{"error":"unknown environment \"production\""}`, res.Body.String())
+}
+
+func TestPods(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments/staging/pods", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	pods := []Pod{}
+	json.Unmarshal(res.Body.Bytes(), &pods)
+	assert.Equal(t, 1, len(pods))
+	assert.Equal(t, "myapp-deployment-1-abcde", pods[0].Name)
+	assert.Equal(t, "ccc333", pods[0].Tag)
+}
+
+func TestDeploy(t *testing.T) {
+	server, cluster, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"environment":"staging","tag":"ddd444","result":"success"}`, res.Body.String())
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", cluster.patched)
+}
+
+func TestDeployDeniedByPolicy(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+	staging, _ := server.Environments.Get("staging")
+	staging.Policies = []deploy.DeployPolicy{&deploy.TagPatternPolicy{Pattern: regexp.MustCompile("^v")}}
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+}
+
+func TestDeployWithApprovals(t *testing.T) {
+	server, cluster, cleanUp := mockServer()
+	defer cleanUp()
+	server.Auth = APIKeys{"secret-key": "deploybot", "bob-key": "bob", "carol-key": "carol"}
+	staging, _ := server.Environments.Get("staging")
+	staging.Policies = []deploy.DeployPolicy{&deploy.ApprovalPolicy{Required: 2}}
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444","approvals":["bob","carol"]}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = mockRequestAs(server, "bob-key", http.MethodPost, "/environments/staging/approve", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"environment":"staging","tag":"ddd444","result":"approved","approvals":["bob"]}`, res.Body.String())
+	mockRequestAs(server, "carol-key", http.MethodPost, "/environments/staging/approve", `{"tag":"eee555"}`)
+
+	res = mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), "1 of 2 required approvals")
+
+	mockRequestAs(server, "carol-key", http.MethodPost, "/environments/staging/approve", `{"tag":"ddd444"}`)
+	res = mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", cluster.patched)
+
+	// the approvals were used up by the deploy
+	res = mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+}
+
+func TestApprovalsExpire(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+	server.ApprovalTTL = time.Millisecond
+
+	mockRequest(server, http.MethodPost, "/environments/staging/approve", `{"tag":"ddd444"}`)
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, []string{}, server.approvers("staging", "ddd444"))
+}
+
+func TestDeployBadRequest(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = mockRequest(server, http.MethodGet, "/environments/staging/deploy", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, http.MethodPost, res.Header().Get("Allow"))
+}
+
+func TestStatus(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments/staging/status", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"deployment":"myapp-deployment","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333",
+		"desiredReplicas":2,"updatedReplicas":0,"readyReplicas":0,"availableReplicas":0,"complete":false,"failed":false}`, res.Body.String())
+}
+
+func TestStatusStream(t *testing.T) {
+	server, cluster, cleanUp := mockServer()
+	defer cleanUp()
+	cluster.progress = true
+
+	res := mockRequest(server, http.MethodGet, "/environments/staging/status/stream", "")
+	assert.Equal(t, "text/event-stream", res.Header().Get("Content-Type"))
+
+	events := regexp.MustCompile(`event: (\w+)`).FindAllStringSubmatch(res.Body.String(), -1)
+	names := []string{}
+	for _, event := range events {
+		names = append(names, event[1])
+	}
+	assert.Equal(t, []string{EventStatus, EventStatus, EventComplete}, names)
+}
+
+func TestStatusStreamTimeout(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments/staging/status/stream", "")
+	assert.True(t, strings.Contains(res.Body.String(), "event: timeout\n"))
+}
+
+func TestStatusStreamOutlivesWriteTimeout(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+	server.RolloutTimeout = 200 * time.Millisecond
+	server.RolloutInterval = 10 * time.Millisecond
+
+	api := httptest.NewUnstartedServer(server)
+	api.Config.WriteTimeout = 50 * time.Millisecond
+	api.Start()
+	defer api.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, api.URL+"/environments/staging/status/stream", nil)
+	req.Header.Set("Authorization", "Bearer secret-key")
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(body), "event: timeout\n"))
+}
+
+func TestHistory(t *testing.T) {
+	server, _, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodGet, "/environments/staging/history", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	revisions := []deploy.Revision{}
+	json.Unmarshal(res.Body.Bytes(), &revisions)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, int64(2), revisions[0].Number)
+}
+
+func TestRollback(t *testing.T) {
+	server, cluster, cleanUp := mockServer()
+	defer cleanUp()
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/rollback", `{"revision":0}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:aaa111", cluster.patched)
+}
+
+func TestDeployEndToEnd(t *testing.T) {
+	kubernetes := deploytest.NewServer()
+	kubernetes.StepInterval = time.Millisecond
+	defer kubernetes.Close()
+	kubernetes.AddDeployment("myapp-staging", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp-docker-image:ccc333", 2)
+	kubernetes.FailImage("artifactory.myorg.com:5010/myapp-docker-image:eee555", deploytest.CrashLoop)
+
+	environments := &deploy.EnvironmentRegistry{}
+	environments.Register("staging", kubernetes.ClusterNamespace("myapp-staging", "myapp-deployment", "myapp-container"))
+	server := &Server{
+		Environments:    environments,
+		Auth:            APIKeys{"secret-key": "deploybot"},
+		RolloutTimeout:  time.Second,
+		RolloutInterval: time.Millisecond,
+	}
+
+	res := mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"ddd444"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = mockRequest(server, http.MethodGet, "/environments/staging/status/stream", "")
+	assert.True(t, strings.Contains(res.Body.String(), "event: complete\n"))
+	assert.True(t, strings.Contains(res.Body.String(), `"image":"artifactory.myorg.com:5010/myapp-docker-image:ddd444"`))
+
+	res = mockRequest(server, http.MethodPost, "/environments/staging/deploy", `{"tag":"eee555"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = mockRequest(server, http.MethodGet, "/environments/staging/status/stream", "")
+	assert.True(t, strings.Contains(res.Body.String(), "event: failed\n"))
+
+	res = mockRequest(server, http.MethodPost, "/environments/staging/rollback", `{"revision":0}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	revisions := []deploy.Revision{}
+	json.Unmarshal(mockRequest(server, http.MethodGet, "/environments/staging/history", "").Body.Bytes(), &revisions)
+	assert.Equal(t, 3, len(revisions))
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", revisions[0].Image)
+}
+
+//
+// MOCK DATA
+//
+
+// mockServer serves a staging environment backed by a mock Kubernetes API
+func mockServer() (*Server, *MockKubernetes, func()) {
+	cluster := &MockKubernetes{}
+	kubernetes := httptest.NewTLSServer(cluster)
+
+	config := deploy.EnvironmentConfig{
+		Description:    "My Staging Cluster",
+		Endpoint:       strings.TrimPrefix(kubernetes.URL, "https://"),
+		Namespace:      "myapp-staging",
+		DeploymentName: "myapp-deployment",
+		ContainerName:  "myapp-container",
+		ImagePrefix:    "artifactory.myorg.com:5010/myapp-docker-image",
+	}
+	environments := &deploy.EnvironmentRegistry{}
+	environments.Register("staging", config.Cluster(kubernetes.Client()))
+
+	server := &Server{
+		Environments:    environments,
+		Auth:            APIKeys{"secret-key": "deploybot"},
+		RolloutTimeout:  20 * time.Millisecond,
+		RolloutInterval: time.Millisecond,
+	}
+	return server, cluster, kubernetes.Close
+}
+
+func mockRequest(server *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	return mockRequestAs(server, "secret-key", method, path, body)
+}
+
+func mockRequestAs(server *Server, key string, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+key)
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	return res
+}
+
+// MockKubernetes serves pods, myapp-deployment and two of its ReplicaSets.
+// With progress set, one more replica becomes ready each time the deployment is fetched.
+type MockKubernetes struct {
+	mutex    sync.Mutex
+	patched  string
+	progress bool
+	ready    int
+}
+
+func (c *MockKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/pods"):
+		w.Write([]byte(`{"items":[{"metadata":{"name":"myapp-deployment-1-abcde"},"status":{"phase":"Running",
+			"containerStatuses":[{"image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333","ready":true}]}}]}`))
+	case strings.HasSuffix(r.URL.Path, "/replicasets"):
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"myapp-deployment-1","annotations":{"deployment.kubernetes.io/revision":"1"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:aaa111"}]}}}},
+			{"metadata":{"name":"myapp-deployment-2","annotations":{"deployment.kubernetes.io/revision":"2"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}}}
+		]}`))
+	case strings.Contains(r.URL.Path, "/deployments/"):
+		if r.Method == http.MethodPatch {
+			raw, _ := ioutil.ReadAll(r.Body)
+			patch := &deploy.Deployment{}
+			json.Unmarshal(raw, patch)
+			c.patched = patch.Spec.Template.Spec.Containers[0].Image
+		}
+		fmt.Fprintf(w, `{"metadata":{"name":"myapp-deployment","generation":1},"spec":{"replicas":2,
+			"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}},
+			"status":{"observedGeneration":1,"replicas":2,"updatedReplicas":%d,"readyReplicas":%d,"availableReplicas":%d}}`,
+			c.ready, c.ready, c.ready)
+		if c.progress && c.ready < 2 {
+			c.ready++
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
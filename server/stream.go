@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+)
+
+// Events sent on a status stream. Every event's data is a RolloutStatus, except error which is an error message.
+const (
+	EventStatus   = "status"
+	EventComplete = "complete"
+	EventFailed   = "failed"
+	EventTimeout  = "timeout"
+	EventError    = "error"
+)
+
+// streamStatus sends the rollout status as Server-Sent Events whenever it changes,
+// until the rollout completes, fails or times out, or the client goes away.
+// The stream outlives the http.Server's WriteTimeout, so each event is given its own write deadline instead.
+func (s *Server) streamStatus(w http.ResponseWriter, r *http.Request, cluster *deploy.KubernetesClusterNamespace) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	timeout, interval := s.RolloutTimeout, s.RolloutInterval
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+	writeTimeout := s.EventWriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	// a writer without deadlines, such as a ResponseRecorder, streams without them
+	controller := http.NewResponseController(w)
+	send := func(event string, data interface{}) {
+		controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+		writeEvent(w, event, data)
+		flusher.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+	w.WriteHeader(http.StatusOK)
+
+	var last *RolloutStatus
+	for {
+		deployment, err := cluster.GetDeployment()
+		if err != nil {
+			send(EventError, err.Error())
+			return
+		}
+
+		status := rolloutStatus(deployment, cluster)
+		final := ""
+		switch {
+		case status.Failed:
+			final = EventFailed
+		case status.Complete:
+			final = EventComplete
+		case !time.Now().Before(deadline):
+			final = EventTimeout
+		}
+		if final != "" {
+			send(final, status)
+			return
+		}
+
+		if last == nil || *last != *status {
+			send(EventStatus, status)
+			last = status
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event with JSON data
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	raw, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, raw)
+}
@@ -0,0 +1,323 @@
+// Package slack answers Slack slash commands and interactive buttons for configured environments.
+//
+//	/deploy <environment> <tag>
+//	/pods <environment>
+//
+// Successful deploys are posted with a Rollback button, which rolls back to the image that deploy replaced.
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/Unity-Technologies/kubernetes-deploy/notify"
+)
+
+// RollbackAction is the action_id of the Rollback button. Its value is a rollbackTarget in JSON.
+const RollbackAction = "rollback"
+
+// rollbackTarget is what a Rollback button undoes: the deploy of Deployed to an environment, which replaced Previous
+type rollbackTarget struct {
+	Environment string `json:"environment"`
+	Deployed    string `json:"deployed"`
+	Previous    string `json:"previous"`
+}
+
+// Handler is an http.Handler for the slash command and interactivity request URLs of a Slack app.
+// It answers within Slack's three second window, then carries on in the background,
+// posting the outcome to the request's response_url.
+type Handler struct {
+	Environments  *deploy.EnvironmentRegistry
+	SigningSecret string
+	// Client posts to response URLs
+	Client *http.Client
+	// Now defaults to time.Now, and is used to check request timestamps.
+	Now func() time.Time
+	// MaxBodyBytes is the largest body read to check a signature. Defaults to 1MiB.
+	MaxBodyBytes int64
+
+	wg sync.WaitGroup
+}
+
+// reply is an immediate response to a slash command
+type reply struct {
+	ResponseType string `json:"response_type,omitempty"`
+	Text         string `json:"text"`
+}
+
+// interaction is the part of a block_actions payload needed to handle a button
+type interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// ServeHTTP verifies the request came from Slack, then handles a slash command or a button click
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	maxBodyBytes := h.MaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = 1 << 20
+	}
+	body, err := verify(r, h.SigningSecret, maxBodyBytes, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if payload := values.Get("payload"); payload != "" {
+		h.interact(r.Context(), w, payload)
+		return
+	}
+	h.command(r.Context(), w, values)
+}
+
+// Wait blocks until background work from earlier requests has finished, e.g. before shutting down
+func (h *Handler) Wait() {
+	h.wg.Wait()
+}
+
+// command answers /deploy and /pods. A deploy is traced as part of the request in ctx.
+// Deploys are audited with the Slack user ID, which unlike the user name cannot be changed.
+func (h *Handler) command(ctx context.Context, w http.ResponseWriter, values url.Values) {
+	args := strings.Fields(values.Get("text"))
+	user := values.Get("user_id")
+	responder := &notify.SlackResponseURL{Client: h.Client, URL: values.Get("response_url"), ReplaceOriginal: true}
+
+	switch values.Get("command") {
+	case "/deploy":
+		if len(args) != 2 {
+			writeReply(w, "ephemeral", "Usage: `/deploy <environment> <tag>`")
+			return
+		}
+		cluster, err := h.Environments.Get(args[0])
+		if err != nil {
+			writeReply(w, "ephemeral", h.unknownEnvironment(args[0]))
+			return
+		}
+
+		writeReply(w, "in_channel", fmt.Sprintf("%s is deploying `%s` to *%s*…", mention(user), args[1], args[0]))
+		responder.InChannel = true
+		h.background(func() {
+			h.deploy(responder, args[0], cluster, deploy.DeployRequest{Tag: args[1], User: user, Context: ctx})
+		})
+
+	case "/pods":
+		if len(args) != 1 {
+			writeReply(w, "ephemeral", "Usage: `/pods <environment>`")
+			return
+		}
+		cluster, err := h.Environments.Get(args[0])
+		if err != nil {
+			writeReply(w, "ephemeral", h.unknownEnvironment(args[0]))
+			return
+		}
+
+		writeReply(w, "ephemeral", fmt.Sprintf("Looking up pods in *%s*…", args[0]))
+		h.background(func() {
+			h.pods(responder, args[0], cluster)
+		})
+
+	default:
+		writeReply(w, "ephemeral", fmt.Sprintf("Unknown command `%s`", values.Get("command")))
+	}
+}
+
+// interact handles a Rollback button, replacing the message it was clicked in with the outcome
+func (h *Handler) interact(ctx context.Context, w http.ResponseWriter, payload string) {
+	action := &interaction{}
+	err := json.Unmarshal([]byte(payload), action)
+	if err != nil {
+		http.Error(w, "payload is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	for _, button := range action.Actions {
+		if button.ActionID != RollbackAction {
+			continue
+		}
+
+		responder := &notify.SlackResponseURL{Client: h.Client, URL: action.ResponseURL, InChannel: true, ReplaceOriginal: true}
+		target, user := rollbackTarget{}, action.User.ID
+		err := json.Unmarshal([]byte(button.Value), &target)
+		if err != nil {
+			continue
+		}
+		h.background(func() {
+			h.rollback(ctx, responder, target, user)
+		})
+	}
+}
+
+// deploy deploys the request, offering to roll back to the image it replaced when it succeeds
+func (h *Handler) deploy(responder notify.Notifier, name string, cluster *deploy.KubernetesClusterNamespace, req deploy.DeployRequest) {
+	target := rollbackTarget{Environment: name, Deployed: req.Tag}
+	if imageNamer, ok := cluster.DeployMaker.(deploy.ImageNamer); ok {
+		target.Deployed = imageNamer.ImageName(req.Tag)
+	}
+	revisions, _ := cluster.History()
+	if len(revisions) > 0 {
+		target.Previous = revisions[0].Image
+	}
+
+	started := time.Now()
+	err := cluster.DeployWithRequest(req)
+
+	record := resultRecord(deploy.AuditActionDeploy, name, mention(req.User), req.Tag, started, err)
+	payload, _ := (&notify.Slack{}).DeployResult(record)
+	if err == nil && target.Previous != "" && target.Previous != target.Deployed {
+		payload, _ = withRollbackButton(payload, target)
+	}
+	responder.Notify(payload)
+}
+
+// rollback redeploys the image target's deploy replaced. It is refused once the environment runs anything but
+// the image that deploy put there, so a late or repeated click cannot undo a later deploy or the rollback itself.
+func (h *Handler) rollback(ctx context.Context, responder notify.Notifier, target rollbackTarget, user string) {
+	cluster, err := h.Environments.Get(target.Environment)
+	if err != nil {
+		payload, _ := json.Marshal(reply{Text: h.unknownEnvironment(target.Environment)})
+		responder.Notify(payload)
+		return
+	}
+
+	started := time.Now()
+	revision, err := rollbackRevision(cluster, target)
+	if err == nil {
+		err = cluster.Rollback(deploy.DeployRequest{User: user, Context: ctx}, revision)
+	}
+
+	record := resultRecord(deploy.AuditActionRollback, target.Environment, mention(user), target.Previous, started, err)
+	payload, _ := (&notify.Slack{}).DeployResult(record)
+	responder.Notify(payload)
+}
+
+// rollbackRevision is the newest earlier revision running target's previous image, while the environment still runs its deployed image
+func rollbackRevision(cluster *deploy.KubernetesClusterNamespace, target rollbackTarget) (int64, error) {
+	revisions, err := cluster.History()
+	if err != nil {
+		return 0, err
+	}
+	if len(revisions) == 0 || revisions[0].Image != target.Deployed {
+		return 0, fmt.Errorf("%s no longer runs %s", target.Environment, target.Deployed)
+	}
+
+	for _, revision := range revisions[1:] {
+		if revision.Image == target.Previous {
+			return revision.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("no revision of %s runs %s any more", target.Environment, target.Previous)
+}
+
+func (h *Handler) pods(responder notify.Notifier, name string, cluster *deploy.KubernetesClusterNamespace) {
+	podList, err := cluster.GetPodList()
+	if err != nil {
+		payload, _ := json.Marshal(reply{Text: fmt.Sprintf("Unable to retrieve pods in *%s* due to %s", name, err.Error())})
+		responder.Notify(payload)
+		return
+	}
+
+	payload, _ := (&notify.Slack{Now: h.Now}).PodOverview(fmt.Sprintf("Pods in %s", name), podList.Overview())
+	responder.Notify(payload)
+}
+
+// background runs work after the response has been sent, so slow deploys do not miss Slack's deadline
+func (h *Handler) background(work func()) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		work()
+	}()
+}
+
+func (h *Handler) unknownEnvironment(name string) string {
+	return fmt.Sprintf("Unknown environment `%s`. Try one of: %s", name, strings.Join(h.Environments.Names(), ", "))
+}
+
+// mention is how Slack shows a user ID as the user's current name
+func mention(user string) string {
+	return fmt.Sprintf("<@%s>", user)
+}
+
+// resultRecord describes a deploy or rollback for the formatter, the same way it is audited
+func resultRecord(action string, name string, user string, image string, started time.Time, err error) deploy.DeployAuditRecord {
+	record := deploy.DeployAuditRecord{
+		Action:          action,
+		User:            user,
+		Time:            started,
+		Cluster:         name,
+		NewImage:        image,
+		Result:          deploy.AuditResult(err),
+		DurationSeconds: time.Since(started).Seconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// withRollbackButton adds a Rollback button for target to a Slack message
+func withRollbackButton(payload []byte, target rollbackTarget) ([]byte, error) {
+	message := map[string]interface{}{}
+	err := json.Unmarshal(payload, &message)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, _ := message["blocks"].([]interface{})
+	message["blocks"] = append(blocks, map[string]interface{}{
+		"type": "actions",
+		"elements": []interface{}{map[string]interface{}{
+			"type":      "button",
+			"action_id": RollbackAction,
+			"value":     string(value),
+			"style":     "danger",
+			"text":      map[string]string{"type": "plain_text", "text": "Rollback"},
+			"confirm": map[string]interface{}{
+				"title":   map[string]string{"type": "plain_text", "text": "Roll back?"},
+				"text":    map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("Roll *%s* back to `%s`?", target.Environment, target.Previous)},
+				"confirm": map[string]string{"type": "plain_text", "text": "Rollback"},
+				"deny":    map[string]string{"type": "plain_text", "text": "Cancel"},
+			},
+		}},
+	})
+	return json.Marshal(message)
+}
+
+func writeReply(w http.ResponseWriter, responseType string, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply{ResponseType: responseType, Text: text})
+}
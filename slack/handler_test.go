@@ -0,0 +1,255 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployCommand(t *testing.T) {
+	handler, kubernetes, slack, cleanUp := mockHandler()
+	defer cleanUp()
+
+	res := mockCommand(handler, slack, "/deploy", "staging ddd444")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"response_type":"in_channel","text":"<@U1> is deploying `+"`ddd444`"+` to *staging*…"}`, res.Body.String())
+
+	handler.Wait()
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:ddd444", kubernetes.patched)
+
+	message := slack.messages[0]
+	assert.Equal(t, true, message["replace_original"])
+	assert.Equal(t, "in_channel", message["response_type"])
+	assert.True(t, strings.HasPrefix(message["text"].(string), "<@U1>'s deploy of `ddd444` to *staging*: *success*"))
+
+	blocks := message["blocks"].([]interface{})
+	button := blocks[len(blocks)-1].(map[string]interface{})["elements"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, RollbackAction, button["action_id"])
+	assert.JSONEq(t, `{"environment":"staging","deployed":"artifactory.myorg.com:5010/myapp-docker-image:ddd444",
+		"previous":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}`, button["value"].(string))
+}
+
+func TestDeployCommandFailure(t *testing.T) {
+	handler, kubernetes, slack, cleanUp := mockHandler()
+	defer cleanUp()
+	kubernetes.fail = true
+
+	mockCommand(handler, slack, "/deploy", "staging ddd444")
+	handler.Wait()
+
+	message := slack.messages[0]
+	assert.True(t, strings.Contains(message["text"].(string), "*failure*"))
+	assert.Equal(t, 1, len(message["blocks"].([]interface{})))
+}
+
+func TestDeployCommandUsage(t *testing.T) {
+	handler, _, slack, cleanUp := mockHandler()
+	defer cleanUp()
+
+	res := mockCommand(handler, slack, "/deploy", "staging")
+	assert.JSONEq(t, `{"response_type":"ephemeral","text":"Usage: `+"`/deploy <environment> <tag>`"+`"}`, res.Body.String())
+
+	res = mockCommand(handler, slack, "/deploy", "production abc123")
+	assert.True(t, strings.Contains(res.Body.String(), "Unknown environment `production`. Try one of: staging"))
+
+	handler.Wait()
+	assert.Equal(t, 0, len(slack.messages))
+}
+
+func TestPodsCommand(t *testing.T) {
+	handler, _, slack, cleanUp := mockHandler()
+	defer cleanUp()
+
+	res := mockCommand(handler, slack, "/pods", "staging")
+	assert.True(t, strings.Contains(res.Body.String(), `"response_type":"ephemeral"`))
+
+	handler.Wait()
+	assert.Equal(t, "Pods in staging", slack.messages[0]["text"])
+}
+
+func TestRollbackButton(t *testing.T) {
+	handler, kubernetes, slack, cleanUp := mockHandler()
+	defer cleanUp()
+
+	res := mockRollbackClick(handler, slack, "artifactory.myorg.com:5010/myapp-docker-image:ccc333")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	handler.Wait()
+	assert.Equal(t, "artifactory.myorg.com:5010/myapp-docker-image:aaa111", kubernetes.patched)
+	assert.True(t, strings.HasPrefix(slack.messages[0]["text"].(string),
+		"<@U2>'s rollback of `artifactory.myorg.com:5010/myapp-docker-image:aaa111` to *staging*: *success*"))
+	assert.Equal(t, true, slack.messages[0]["replace_original"])
+}
+
+func TestStaleRollbackButton(t *testing.T) {
+	handler, kubernetes, slack, cleanUp := mockHandler()
+	defer cleanUp()
+
+	// staging has moved on from the image this button's deploy put there
+	mockRollbackClick(handler, slack, "artifactory.myorg.com:5010/myapp-docker-image:ddd444")
+	handler.Wait()
+
+	assert.Equal(t, "", kubernetes.patched)
+	assert.True(t, strings.Contains(slack.messages[0]["text"].(string), "*failure*"))
+	assert.True(t, strings.Contains(slack.messages[0]["text"].(string), "staging no longer runs artifactory.myorg.com:5010/myapp-docker-image:ddd444"))
+}
+
+func TestInvalidSignature(t *testing.T) {
+	handler, _, _, cleanUp := mockHandler()
+	defer cleanUp()
+
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader("command=/pods&text=staging"))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(SignatureHeader, "v0=nope")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "invalid signature\n", res.Body.String())
+}
+
+func TestOversizedRequest(t *testing.T) {
+	handler, _, _, cleanUp := mockHandler()
+	defer cleanUp()
+	handler.MaxBodyBytes = 16
+
+	res := mockSlackRequest(handler, "command=/pods&text=staging", time.Now())
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "request body is unreadable or larger than 16 bytes\n", res.Body.String())
+}
+
+func TestReplayedRequest(t *testing.T) {
+	handler, _, _, cleanUp := mockHandler()
+	defer cleanUp()
+
+	res := mockSlackRequest(handler, "command=/pods&text=staging", time.Now().Add(-10*time.Minute))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "request timestamp is too far from now\n", res.Body.String())
+}
+
+//
+// MOCK DATA
+//
+
+func mockHandler() (*Handler, *MockKubernetes, *MockSlack, func()) {
+	kubernetes := &MockKubernetes{}
+	kubernetesServer := httptest.NewTLSServer(kubernetes)
+	slack := &MockSlack{}
+	slackServer := httptest.NewServer(slack)
+	slack.url = slackServer.URL
+
+	config := deploy.EnvironmentConfig{
+		Endpoint:       strings.TrimPrefix(kubernetesServer.URL, "https://"),
+		Namespace:      "myapp-staging",
+		DeploymentName: "myapp-deployment",
+		ContainerName:  "myapp-container",
+		ImagePrefix:    "artifactory.myorg.com:5010/myapp-docker-image",
+	}
+	environments := &deploy.EnvironmentRegistry{}
+	environments.Register("staging", config.Cluster(kubernetesServer.Client()))
+
+	handler := &Handler{Environments: environments, SigningSecret: "signing-secret", Client: slackServer.Client()}
+	return handler, kubernetes, slack, func() {
+		kubernetesServer.Close()
+		slackServer.Close()
+	}
+}
+
+func mockCommand(handler *Handler, slack *MockSlack, command string, text string) *httptest.ResponseRecorder {
+	body := url.Values{
+		"command":      {command},
+		"text":         {text},
+		"user_id":      {"U1"},
+		"user_name":    {"alice"},
+		"response_url": {slack.url},
+	}
+	return mockSlackRequest(handler, body.Encode(), time.Now())
+}
+
+// mockRollbackClick clicks the Rollback button of a deploy of deployed to staging, which replaced aaa111
+func mockRollbackClick(handler *Handler, slack *MockSlack, deployed string) *httptest.ResponseRecorder {
+	value, _ := json.Marshal(rollbackTarget{Environment: "staging", Deployed: deployed, Previous: "artifactory.myorg.com:5010/myapp-docker-image:aaa111"})
+	payload := fmt.Sprintf(`{"type":"block_actions","user":{"id":"U2"},"response_url":%q,
+		"actions":[{"action_id":"rollback","value":%q}]}`, slack.url, value)
+	return mockSlackRequest(handler, url.Values{"payload": {payload}}.Encode(), time.Now())
+}
+
+// mockSlackRequest signs the body the way Slack does
+func mockSlackRequest(handler *Handler, body string, at time.Time) *httptest.ResponseRecorder {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Signature("signing-secret", timestamp, []byte(body)))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+// MockSlack records the messages posted to response URLs
+type MockSlack struct {
+	mutex    sync.Mutex
+	url      string
+	messages []map[string]interface{}
+}
+
+func (s *MockSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	raw, _ := ioutil.ReadAll(r.Body)
+	message := map[string]interface{}{}
+	json.Unmarshal(raw, &message)
+	s.messages = append(s.messages, message)
+}
+
+// MockKubernetes serves pods, myapp-deployment and two of its ReplicaSets. Patches fail when fail is set.
+type MockKubernetes struct {
+	mutex   sync.Mutex
+	patched string
+	fail    bool
+}
+
+func (c *MockKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/pods"):
+		w.Write([]byte(`{"items":[{"metadata":{"name":"myapp-deployment-1-abcde"},"status":{"phase":"Running",
+			"containerStatuses":[{"image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333","ready":true}]}}]}`))
+	case strings.HasSuffix(r.URL.Path, "/replicasets"):
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"myapp-deployment-1","annotations":{"deployment.kubernetes.io/revision":"1"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:aaa111"}]}}}},
+			{"metadata":{"name":"myapp-deployment-2","annotations":{"deployment.kubernetes.io/revision":"2"},"ownerReferences":[{"kind":"Deployment","name":"myapp-deployment"}]},
+			 "spec":{"template":{"spec":{"containers":[{"name":"myapp-container","image":"artifactory.myorg.com:5010/myapp-docker-image:ccc333"}]}}}}
+		]}`))
+	case strings.Contains(r.URL.Path, "/deployments/"):
+		if r.Method == http.MethodPatch {
+			if c.fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			raw, _ := ioutil.ReadAll(r.Body)
+			patch := &deploy.Deployment{}
+			json.Unmarshal(raw, patch)
+			c.patched = patch.Spec.Template.Spec.Containers[0].Image
+		}
+		w.Write([]byte(`{"metadata":{"name":"myapp-deployment"}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,54 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers Slack signs each request with
+const (
+	SignatureHeader = "X-Slack-Signature"
+	TimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// verify reads the request body, up to maxBodyBytes, and checks Slack's signature over it.
+// Requests older than five minutes are refused so they cannot be replayed.
+func verify(r *http.Request, signingSecret string, maxBodyBytes int64, now time.Time) ([]byte, error) {
+	if signingSecret == "" {
+		return nil, fmt.Errorf("missing signing secret")
+	}
+
+	timestamp := r.Header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("missing or invalid %s", TimestampHeader)
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > 5*time.Minute || skew < -5*time.Minute {
+		return nil, fmt.Errorf("request timestamp is too far from now")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("request body is unreadable or larger than %d bytes", maxBodyBytes)
+	}
+
+	if !hmac.Equal([]byte(Signature(signingSecret, timestamp, body)), []byte(r.Header.Get(SignatureHeader))) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	return body, nil
+}
+
+// Signature is the value Slack sends in X-Slack-Signature for a request body
+func Signature(signingSecret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
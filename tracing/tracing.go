@@ -0,0 +1,145 @@
+// Package tracing records deploys as OpenTelemetry spans, within the trace of the request that asked for them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer NewTracer takes from its provider
+const InstrumentationName = "github.com/Unity-Technologies/kubernetes-deploy"
+
+// Tracer adapts an OpenTelemetry tracer to deploy.Tracer, so it can be given to a cluster namespace.
+//
+//	tracer := tracing.NewTracer(otel.GetTracerProvider())
+//	cluster.Tracer = tracer
+//	http.Handle("/", &tracing.Handler{Handler: apiServer, Tracer: tracer})
+type Tracer struct {
+	Tracer trace.Tracer
+}
+
+// NewTracer takes a tracer from provider, e.g. an SDK TracerProvider exporting its spans
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	return &Tracer{Tracer: provider.Tracer(InstrumentationName)}
+}
+
+// Start starts a span as a child of the span ctx carries, if any
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, deploy.Span) {
+	ctx, s := t.Tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+// span adapts an OpenTelemetry span to deploy.Span
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(attributeOf(key, value))
+}
+
+// RecordError records err as an event and marks the span as failed
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+// attributeOf converts a value to an attribute of the same type, or of its text otherwise
+func attributeOf(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case time.Duration:
+		return attribute.Float64(key, v.Seconds())
+	case []string:
+		return attribute.StringSlice(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
+
+// Handler serves each request within a server span, continuing the trace its headers carry.
+// The request's context carries the span and Tracer, so a deploy given that context is part
+// of the same trace, as are any spans started with deploy.StartSpan.
+type Handler struct {
+	Handler http.Handler
+	Tracer  *Tracer
+	// Propagator reads the trace context of each request, defaulting to W3C `traceparent` headers
+	Propagator propagation.TextMapPropagator
+}
+
+// ServeHTTP serves the request within a span recording its method, path and status code
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	propagator := h.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, s := h.Tracer.Tracer.Start(ctx, "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		),
+	)
+	defer s.End()
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.Handler.ServeHTTP(recorder, r.WithContext(deploy.ContextWithTracer(ctx, h.Tracer)))
+
+	s.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+	if recorder.status >= 500 {
+		s.SetStatus(codes.Error, http.StatusText(recorder.status))
+	}
+}
+
+// statusRecorder remembers the status code written, and still flushes, so event streams work through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to set deadlines
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Unity-Technologies/kubernetes-deploy/deploy"
+	"github.com/Unity-Technologies/kubernetes-deploy/deploytest"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+func TestDeployContinuesIncomingTrace(t *testing.T) {
+	kubernetes := deploytest.NewServer()
+	defer kubernetes.Close()
+	kubernetes.AddDeployment("myapp", "myapp-deployment", "myapp-container", "artifactory.myorg.com:5010/myapp:aaa111", 2)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	cluster := kubernetes.ClusterNamespace("myapp", "myapp-deployment", "myapp-container")
+	cluster.Tracer = tracer
+
+	handler := &Handler{Tracer: tracer, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := cluster.DeployWithRequest(deploy.DeployRequest{Tag: "bbb222", Context: r.Context()})
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})}
+	req := httptest.NewRequest(http.MethodPost, "/deploy", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		assert.Equal(t, incomingTraceID, s.SpanContext().TraceID().String())
+		spans[s.Name()] = s
+	}
+
+	server := spans["HTTP POST"]
+	assert.Equal(t, incomingSpanID, server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	deploySpan := spans["deploy"]
+	assert.Equal(t, server.SpanContext().SpanID(), deploySpan.Parent().SpanID())
+	assert.Contains(t, deploySpan.Attributes(), attribute.String("deploy.tag", "bbb222"))
+
+	patch := spans["patch"]
+	assert.Equal(t, deploySpan.SpanContext().SpanID(), patch.Parent().SpanID())
+	assert.Equal(t, patch.SpanContext().SpanID(), spans["token.retrieve"].Parent().SpanID())
+}
+
+func TestHandlerStartsTraceWithoutIncomingOne(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	handler := &Handler{Tracer: tracer, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, s := deploy.StartSpan(r.Context(), "lookup")
+		s.End()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	ended := recorder.Ended()
+	assert.Equal(t, 2, len(ended))
+	lookup, server := ended[0], ended[1]
+	assert.Equal(t, "lookup", lookup.Name())
+	assert.False(t, server.Parent().IsValid())
+	assert.Equal(t, server.SpanContext().SpanID(), lookup.Parent().SpanID())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Contains(t, server.Attributes(), attribute.String("url.path", "/status"))
+}
+
+func TestHandlerStillFlushes(t *testing.T) {
+	tracer := NewTracer(sdktrace.NewTracerProvider())
+	flushed := false
+	handler := &Handler{Tracer: tracer, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		flusher.Flush()
+		flushed = true
+	})}
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/status/stream", nil))
+	assert.True(t, flushed)
+	assert.True(t, res.Flushed)
+}
+
+func TestSpanAttributesAndErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, s := tracer.Start(deploy.ContextWithTracer(httptest.NewRequest(http.MethodGet, "/", nil).Context(), tracer), "rollout.wait")
+	s.SetAttribute("http.response.status_code", 200)
+	s.SetAttribute("deploy.user", "alice")
+	s.SetAttribute("deploy.wait", 90*time.Second)
+	s.SetAttribute("deploy.replicas", struct{ Ready int }{2})
+	s.RecordError(errors.New("timed out waiting for rollout of myapp"))
+	s.End()
+
+	ended := recorder.Ended()[0]
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.Int("http.response.status_code", 200),
+		attribute.String("deploy.user", "alice"),
+		attribute.Float64("deploy.wait", 90),
+		attribute.String("deploy.replicas", "{2}"),
+	}, ended.Attributes())
+	assert.Equal(t, codes.Error, ended.Status().Code)
+	assert.Equal(t, "timed out waiting for rollout of myapp", ended.Status().Description)
+	assert.Equal(t, "exception", ended.Events()[0].Name)
+}